@@ -0,0 +1,197 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	DefaultDamping       = 0.85
+	DefaultMaxIterations = 100
+	DefaultTolerance     = 1e-6
+	Unreachable          = -1
+)
+
+// Graph is a thread safe, directed graph of internal links where each
+// node is a url and each edge points from a page to a link found on it.
+type Graph struct {
+	mx    *sync.Mutex
+	edges map[string]map[string]struct{}
+}
+
+func NewGraph() *Graph {
+	return &Graph{
+		mx:    &sync.Mutex{},
+		edges: make(map[string]map[string]struct{}),
+	}
+}
+
+// AddEdges records links from the source page to each of the targets.
+func (g *Graph) AddEdges(source string, targets []string) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	g.addNode(source)
+	for _, target := range targets {
+		g.addNode(target)
+		// self links do not contribute to the link graph
+		if target == source {
+			continue
+		}
+		g.edges[source][target] = struct{}{}
+	}
+}
+
+func (g *Graph) addNode(url string) {
+	if _, ok := g.edges[url]; !ok {
+		g.edges[url] = make(map[string]struct{})
+	}
+}
+
+type Options struct {
+	// Damping is the probability of following a link rather than
+	// jumping to a random page, usually 0.85.
+	Damping       float64
+	MaxIterations int
+	Tolerance     float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Damping:       DefaultDamping,
+		MaxIterations: DefaultMaxIterations,
+		Tolerance:     DefaultTolerance,
+	}
+}
+
+type PageMetrics struct {
+	Url          string  `json:"url"`
+	ClickDepth   int     `json:"clickDepth"`
+	PageRank     float64 `json:"pageRank"`
+	InboundLinks int     `json:"inboundLinks"`
+	Orphan       bool    `json:"orphan"`
+}
+
+// Analyze computes the click depth from the nearest seed, the PageRank, the
+// number of inbound links and the orphan state of every page in the graph.
+func Analyze(g *Graph, seeds []string, opts Options) []PageMetrics {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	if len(g.edges) == 0 {
+		return nil
+	}
+
+	urls := make([]string, 0, len(g.edges))
+	for url := range g.edges {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	inbound := make(map[string]int, len(urls))
+	for _, targets := range g.edges {
+		for target := range targets {
+			inbound[target]++
+		}
+	}
+
+	depths := g.clickDepths(seeds)
+	ranks := g.pageRank(urls, opts)
+
+	isSeed := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		isSeed[seed] = true
+	}
+
+	metrics := make([]PageMetrics, 0, len(urls))
+	for _, url := range urls {
+		depth, ok := depths[url]
+		if !ok {
+			depth = Unreachable
+		}
+
+		metrics = append(metrics, PageMetrics{
+			Url:          url,
+			ClickDepth:   depth,
+			PageRank:     ranks[url],
+			InboundLinks: inbound[url],
+			Orphan:       !isSeed[url] && inbound[url] == 0,
+		})
+	}
+
+	return metrics
+}
+
+// clickDepths runs a breadth first search from the seeds and returns the
+// minimum number of clicks needed to reach each page from any of them.
+func (g *Graph) clickDepths(seeds []string) map[string]int {
+	depths := make(map[string]int)
+	var queue []string
+	for _, seed := range seeds {
+		if _, ok := g.edges[seed]; !ok {
+			continue
+		}
+		if _, ok := depths[seed]; ok {
+			continue
+		}
+		depths[seed] = 0
+		queue = append(queue, seed)
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for target := range g.edges[current] {
+			if _, visited := depths[target]; visited {
+				continue
+			}
+			depths[target] = depths[current] + 1
+			queue = append(queue, target)
+		}
+	}
+
+	return depths
+}
+
+// pageRank computes the PageRank of every page with the power iteration
+// method. The rank of pages without outbound links is spread evenly.
+func (g *Graph) pageRank(urls []string, opts Options) map[string]float64 {
+	n := float64(len(urls))
+	ranks := make(map[string]float64, len(urls))
+	for _, url := range urls {
+		ranks[url] = 1 / n
+	}
+
+	for i := 0; i < opts.MaxIterations; i++ {
+		var dangling float64
+		for _, url := range urls {
+			if len(g.edges[url]) == 0 {
+				dangling += ranks[url]
+			}
+		}
+
+		base := (1-opts.Damping)/n + opts.Damping*dangling/n
+		next := make(map[string]float64, len(urls))
+		for _, url := range urls {
+			next[url] += base
+			targets := g.edges[url]
+			for target := range targets {
+				next[target] += opts.Damping * ranks[url] / float64(len(targets))
+			}
+		}
+
+		var delta float64
+		for _, url := range urls {
+			delta += math.Abs(next[url] - ranks[url])
+		}
+
+		ranks = next
+		if delta < opts.Tolerance {
+			break
+		}
+	}
+
+	return ranks
+}
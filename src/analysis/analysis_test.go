@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type AnalysisTest struct {
+	graph *Graph
+}
+
+func TestAnalysis(t *testing.T) {
+	at := &AnalysisTest{}
+
+	t.Run("Test returns no metrics for empty graph", at.testReturnsNoMetricsForEmptyGraph)
+	t.Run("Test computes click depth from seed", at.testComputesClickDepthFromSeed)
+	t.Run("Test computes click depth from nearest seed", at.testComputesClickDepthFromNearestSeed)
+	t.Run("Test counts inbound links and orphans", at.testCountsInboundLinksAndOrphans)
+	t.Run("Test page rank favours linked to pages", at.testPageRankFavoursLinkedToPages)
+}
+
+func (at *AnalysisTest) setupTest(t *testing.T) {
+	// seed -> a -> b -> c, seed -> b, c -> b, d -> b
+	at.graph = NewGraph()
+	at.graph.AddEdges("seed", []string{"a", "b", "seed"})
+	at.graph.AddEdges("a", []string{"b"})
+	at.graph.AddEdges("b", []string{"c"})
+	at.graph.AddEdges("c", []string{"b"})
+	at.graph.AddEdges("d", []string{"b"})
+}
+
+func metricsByUrl(metrics []PageMetrics) map[string]PageMetrics {
+	result := make(map[string]PageMetrics)
+	for _, m := range metrics {
+		result[m.Url] = m
+	}
+	return result
+}
+
+func (at *AnalysisTest) testReturnsNoMetricsForEmptyGraph(t *testing.T) {
+	metrics := Analyze(NewGraph(), []string{"seed"}, DefaultOptions())
+
+	assert.Len(t, metrics, 0)
+}
+
+func (at *AnalysisTest) testComputesClickDepthFromSeed(t *testing.T) {
+	at.setupTest(t)
+
+	metrics := metricsByUrl(Analyze(at.graph, []string{"seed"}, DefaultOptions()))
+
+	assert.Len(t, metrics, 5)
+	assert.Equal(t, 0, metrics["seed"].ClickDepth)
+	assert.Equal(t, 1, metrics["a"].ClickDepth)
+	assert.Equal(t, 1, metrics["b"].ClickDepth)
+	assert.Equal(t, 2, metrics["c"].ClickDepth)
+	assert.Equal(t, Unreachable, metrics["d"].ClickDepth)
+}
+
+func (at *AnalysisTest) testComputesClickDepthFromNearestSeed(t *testing.T) {
+	at.setupTest(t)
+
+	metrics := metricsByUrl(Analyze(at.graph, []string{"seed", "d"}, DefaultOptions()))
+
+	assert.Equal(t, 0, metrics["seed"].ClickDepth)
+	assert.Equal(t, 0, metrics["d"].ClickDepth)
+	assert.Equal(t, 1, metrics["b"].ClickDepth)
+	assert.Equal(t, 2, metrics["c"].ClickDepth)
+	assert.False(t, metrics["d"].Orphan)
+}
+
+func (at *AnalysisTest) testCountsInboundLinksAndOrphans(t *testing.T) {
+	at.setupTest(t)
+
+	metrics := metricsByUrl(Analyze(at.graph, []string{"seed"}, DefaultOptions()))
+
+	assert.Equal(t, 0, metrics["seed"].InboundLinks)
+	assert.Equal(t, 4, metrics["b"].InboundLinks)
+	assert.Equal(t, 1, metrics["c"].InboundLinks)
+	assert.False(t, metrics["seed"].Orphan)
+	assert.False(t, metrics["b"].Orphan)
+	assert.True(t, metrics["d"].Orphan)
+}
+
+func (at *AnalysisTest) testPageRankFavoursLinkedToPages(t *testing.T) {
+	at.setupTest(t)
+
+	metrics := Analyze(at.graph, []string{"seed"}, DefaultOptions())
+	byUrl := metricsByUrl(metrics)
+
+	var total float64
+	for _, m := range metrics {
+		total += m.PageRank
+	}
+
+	assert.InDelta(t, 1.0, total, 1e-6)
+	assert.Greater(t, byUrl["b"].PageRank, byUrl["a"].PageRank)
+	assert.Greater(t, byUrl["b"].PageRank, byUrl["seed"].PageRank)
+	assert.Equal(t, byUrl["seed"].PageRank, byUrl["d"].PageRank)
+}
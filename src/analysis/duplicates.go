@@ -0,0 +1,200 @@
+package analysis
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// DefaultSimilarityThreshold is the similarity above which pages are near
+// duplicates unless configured otherwise, which allows their SimHashes to
+// differ by 6 bits.
+const DefaultSimilarityThreshold = 0.9
+
+// MinSimilarityThreshold is the lowest threshold pages are clustered with,
+// which allows their SimHashes to differ by 16 bits. Lower thresholds compare
+// most pages with each other, which is quadratic in the pages of a crawl.
+const MinSimilarityThreshold = 0.75
+
+// PageFingerprint identifies the content of a page.
+type PageFingerprint struct {
+	Url         string
+	ContentHash string
+	// SimHash is the SimHash of the visible text of the page, 0 if it has
+	// none.
+	SimHash uint64
+}
+
+// DuplicateGroup lists the pages with the same content.
+type DuplicateGroup struct {
+	ContentHash string   `json:"contentHash"`
+	Urls        []string `json:"urls"`
+}
+
+// NearDuplicateCluster lists the pages with similar content. Pages are in a
+// cluster if they're similar to another page of the cluster.
+type NearDuplicateCluster struct {
+	Urls []string `json:"urls"`
+	// Similarity is the lowest similarity between two pages found similar
+	// in the cluster, from 0 to 1.
+	Similarity float64 `json:"similarity"`
+}
+
+type Duplicates struct {
+	Exact          []DuplicateGroup       `json:"exact"`
+	NearDuplicates []NearDuplicateCluster `json:"nearDuplicates"`
+}
+
+// Similarity returns the share of the bits of the SimHashes that are equal.
+func Similarity(a uint64, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// FindDuplicates groups the pages with the same content hash and clusters
+// the pages whose SimHashes are at least as similar as the threshold. Pages
+// with the same content are in the same cluster, which only lists pages with
+// different contents. Thresholds below MinSimilarityThreshold are raised to
+// it.
+func FindDuplicates(pages []PageFingerprint, threshold float64) Duplicates {
+	if threshold < MinSimilarityThreshold {
+		threshold = MinSimilarityThreshold
+	}
+
+	duplicates := Duplicates{
+		Exact:          []DuplicateGroup{},
+		NearDuplicates: []NearDuplicateCluster{},
+	}
+
+	// group the pages by content, keeping the order of the pages
+	var contents []*content
+	byHash := make(map[string]*content)
+	for _, page := range pages {
+		if page.ContentHash == "" {
+			continue
+		}
+
+		c, ok := byHash[page.ContentHash]
+		if !ok {
+			c = &content{hash: page.ContentHash, simHash: page.SimHash, parent: len(contents), similarity: 1}
+			byHash[page.ContentHash] = c
+			contents = append(contents, c)
+		}
+		c.urls = append(c.urls, page.Url)
+	}
+
+	for _, c := range contents {
+		if len(c.urls) > 1 {
+			duplicates.Exact = append(duplicates.Exact, DuplicateGroup{ContentHash: c.hash, Urls: c.urls})
+		}
+	}
+
+	clusterSimilarContents(contents, threshold)
+
+	clusters := make(map[int]*NearDuplicateCluster)
+	var roots []int
+	for i, c := range contents {
+		root := find(contents, i)
+		if root == i && !c.joined {
+			continue
+		}
+
+		cluster, ok := clusters[root]
+		if !ok {
+			cluster = &NearDuplicateCluster{Similarity: contents[root].similarity}
+			clusters[root] = cluster
+			roots = append(roots, root)
+		}
+		cluster.Urls = append(cluster.Urls, c.urls...)
+	}
+
+	sort.Ints(roots)
+	for _, root := range roots {
+		duplicates.NearDuplicates = append(duplicates.NearDuplicates, *clusters[root])
+	}
+
+	return duplicates
+}
+
+// content is a distinct content among the pages, and a node of the disjoint
+// sets of similar contents.
+type content struct {
+	hash    string
+	simHash uint64
+	urls    []string
+
+	parent int
+	// joined is set once the content is found similar to another one
+	joined bool
+	// similarity is the lowest similarity found in the set, kept by its
+	// root
+	similarity float64
+}
+
+// clusterSimilarContents joins the sets of the contents whose SimHashes are
+// similar. As SimHashes differing by at most k bits have one of k+1 blocks
+// of bits in common, only the contents sharing a block are compared.
+func clusterSimilarContents(contents []*content, threshold float64) {
+	maxDistance := int((1 - threshold) * 64)
+	if maxDistance < 0 {
+		maxDistance = 0
+	}
+
+	blocks := maxDistance + 1
+	for block := 0; block < blocks; block++ {
+		start, end := block*64/blocks, (block+1)*64/blocks
+		mask := (uint64(1)<<(end-start) - 1) << start
+
+		buckets := make(map[uint64][]int)
+		for i, c := range contents {
+			// pages without text aren't similar to each other
+			if c.simHash == 0 {
+				continue
+			}
+			key := c.simHash & mask
+			buckets[key] = append(buckets[key], i)
+		}
+
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					a, b := contents[bucket[x]], contents[bucket[y]]
+					similarity := Similarity(a.simHash, b.simHash)
+					if similarity < threshold {
+						continue
+					}
+					union(contents, bucket[x], bucket[y], similarity)
+				}
+			}
+		}
+	}
+}
+
+func find(contents []*content, i int) int {
+	for contents[i].parent != i {
+		contents[i].parent = contents[contents[i].parent].parent
+		i = contents[i].parent
+	}
+	return i
+}
+
+// union joins the sets of the contents, keeping the lowest index as root so
+// that clusters are listed in the order of their first page.
+func union(contents []*content, a int, b int, similarity float64) {
+	contents[a].joined = true
+	contents[b].joined = true
+
+	rootA, rootB := find(contents, a), find(contents, b)
+	if rootB < rootA {
+		rootA, rootB = rootB, rootA
+	}
+
+	lowest := contents[rootA].similarity
+	if contents[rootB].similarity < lowest {
+		lowest = contents[rootB].similarity
+	}
+	if similarity < lowest {
+		lowest = similarity
+	}
+
+	contents[rootB].parent = rootA
+	contents[rootA].similarity = lowest
+}
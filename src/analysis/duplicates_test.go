@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DuplicatesTest struct {
+	pages []PageFingerprint
+}
+
+func TestDuplicates(t *testing.T) {
+	dt := &DuplicatesTest{}
+
+	t.Run("Test returns no duplicates for unique pages", dt.testReturnsNoDuplicatesForUniquePages)
+	t.Run("Test groups exact duplicates", dt.testGroupsExactDuplicates)
+	t.Run("Test clusters near duplicates above threshold", dt.testClustersNearDuplicatesAboveThreshold)
+	t.Run("Test threshold of one only clusters equal SimHashes", dt.testThresholdOfOneOnlyClustersEqualSimHashes)
+	t.Run("Test raises thresholds below minimum", dt.testRaisesThresholdsBelowMinimum)
+}
+
+func (dt *DuplicatesTest) setupTest(t *testing.T) {
+	dt.pages = []PageFingerprint{
+		{Url: "/a", ContentHash: "h1", SimHash: 0xff00ff00ff00ff00},
+		// same content as /a
+		{Url: "/a?print=1", ContentHash: "h1", SimHash: 0xff00ff00ff00ff00},
+		// 2 bits away from /a
+		{Url: "/b", ContentHash: "h2", SimHash: 0xff00ff00ff00ff03},
+		// 4 bits away from /b, 6 from /a
+		{Url: "/c", ContentHash: "h3", SimHash: 0xff00ff00ff00ff3f},
+		// unrelated
+		{Url: "/d", ContentHash: "h4", SimHash: 0x00ff00ff00ff00ff},
+		// not parsed
+		{Url: "/e"},
+		// no text
+		{Url: "/f", ContentHash: "h5"},
+		{Url: "/g", ContentHash: "h6"},
+	}
+}
+
+func (dt *DuplicatesTest) testReturnsNoDuplicatesForUniquePages(t *testing.T) {
+	duplicates := FindDuplicates([]PageFingerprint{
+		{Url: "/a", ContentHash: "h1", SimHash: 0xff00ff00ff00ff00},
+		{Url: "/b", ContentHash: "h2", SimHash: 0x00ff00ff00ff00ff},
+	}, DefaultSimilarityThreshold)
+
+	assert.Equal(t, Duplicates{Exact: []DuplicateGroup{}, NearDuplicates: []NearDuplicateCluster{}}, duplicates)
+}
+
+func (dt *DuplicatesTest) testGroupsExactDuplicates(t *testing.T) {
+	dt.setupTest(t)
+
+	duplicates := FindDuplicates(dt.pages, DefaultSimilarityThreshold)
+
+	assert.Equal(t, []DuplicateGroup{{ContentHash: "h1", Urls: []string{"/a", "/a?print=1"}}}, duplicates.Exact)
+}
+
+func (dt *DuplicatesTest) testClustersNearDuplicatesAboveThreshold(t *testing.T) {
+	dt.setupTest(t)
+
+	duplicates := FindDuplicates(dt.pages, DefaultSimilarityThreshold)
+
+	assert.Equal(t, []NearDuplicateCluster{{
+		Urls:       []string{"/a", "/a?print=1", "/b", "/c"},
+		Similarity: 1 - 6.0/64,
+	}}, duplicates.NearDuplicates)
+
+	// /c is only 4 bits away from /b
+	duplicates = FindDuplicates(dt.pages, 0.93)
+
+	assert.Equal(t, []NearDuplicateCluster{{
+		Urls:       []string{"/a", "/a?print=1", "/b", "/c"},
+		Similarity: 1 - 4.0/64,
+	}}, duplicates.NearDuplicates)
+
+	duplicates = FindDuplicates(dt.pages, 0.96)
+
+	assert.Equal(t, []NearDuplicateCluster{{
+		Urls:       []string{"/a", "/a?print=1", "/b"},
+		Similarity: 1 - 2.0/64,
+	}}, duplicates.NearDuplicates)
+}
+
+func (dt *DuplicatesTest) testThresholdOfOneOnlyClustersEqualSimHashes(t *testing.T) {
+	dt.setupTest(t)
+	dt.pages = append(dt.pages, PageFingerprint{Url: "/h", ContentHash: "h7", SimHash: 0x00ff00ff00ff00ff})
+
+	duplicates := FindDuplicates(dt.pages, 1)
+
+	assert.Equal(t, []NearDuplicateCluster{{Urls: []string{"/d", "/h"}, Similarity: 1}}, duplicates.NearDuplicates)
+}
+
+func (dt *DuplicatesTest) testRaisesThresholdsBelowMinimum(t *testing.T) {
+	pages := []PageFingerprint{
+		{Url: "/a", ContentHash: "h1", SimHash: 0xffffffffffffffff},
+		// 16 bits away from /a
+		{Url: "/b", ContentHash: "h2", SimHash: 0xffffffffffff0000},
+		// 17 bits away from /a
+		{Url: "/c", ContentHash: "h3", SimHash: 0x00007fffffffffff},
+	}
+
+	duplicates := FindDuplicates(pages, 0)
+
+	assert.Equal(t, []NearDuplicateCluster{{
+		Urls:       []string{"/a", "/b"},
+		Similarity: 1 - 16.0/64,
+	}}, duplicates.NearDuplicates)
+}
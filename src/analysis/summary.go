@@ -0,0 +1,50 @@
+package analysis
+
+import "sort"
+
+type Summary struct {
+	PageCount        int           `json:"pageCount"`
+	MaxClickDepth    int           `json:"maxClickDepth"`
+	ClickDepths      map[int]int   `json:"clickDepths"`
+	UnreachablePages int           `json:"unreachablePages"`
+	OrphanPages      []string      `json:"orphanPages"`
+	TopPages         []PageMetrics `json:"topPages"`
+}
+
+// Summarize aggregates page metrics into a site wide summary, listing the
+// given number of pages with the highest PageRank.
+func Summarize(pages []PageMetrics, top int) Summary {
+	summary := Summary{
+		PageCount:   len(pages),
+		ClickDepths: make(map[int]int),
+		OrphanPages: []string{},
+	}
+
+	for _, page := range pages {
+		if page.ClickDepth == Unreachable {
+			summary.UnreachablePages++
+		} else {
+			summary.ClickDepths[page.ClickDepth]++
+			if page.ClickDepth > summary.MaxClickDepth {
+				summary.MaxClickDepth = page.ClickDepth
+			}
+		}
+
+		if page.Orphan {
+			summary.OrphanPages = append(summary.OrphanPages, page.Url)
+		}
+	}
+
+	ranked := make([]PageMetrics, len(pages))
+	copy(ranked, pages)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].PageRank > ranked[j].PageRank
+	})
+
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	summary.TopPages = ranked
+
+	return summary
+}
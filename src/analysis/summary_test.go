@@ -0,0 +1,32 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	t.Run("Test summarizes page metrics", testSummarizesPageMetrics)
+}
+
+func testSummarizesPageMetrics(t *testing.T) {
+	pages := []PageMetrics{
+		{Url: "seed", ClickDepth: 0, PageRank: 0.2, InboundLinks: 1},
+		{Url: "a", ClickDepth: 1, PageRank: 0.1, InboundLinks: 1},
+		{Url: "b", ClickDepth: 1, PageRank: 0.5, InboundLinks: 3},
+		{Url: "c", ClickDepth: 2, PageRank: 0.15, InboundLinks: 1},
+		{Url: "d", ClickDepth: Unreachable, PageRank: 0.05, Orphan: true},
+	}
+
+	summary := Summarize(pages, 2)
+
+	assert.Equal(t, 5, summary.PageCount)
+	assert.Equal(t, 2, summary.MaxClickDepth)
+	assert.Equal(t, map[int]int{0: 1, 1: 2, 2: 1}, summary.ClickDepths)
+	assert.Equal(t, 1, summary.UnreachablePages)
+	assert.Equal(t, []string{"d"}, summary.OrphanPages)
+	assert.Len(t, summary.TopPages, 2)
+	assert.Equal(t, "b", summary.TopPages[0].Url)
+	assert.Equal(t, "seed", summary.TopPages[1].Url)
+}
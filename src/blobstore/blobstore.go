@@ -0,0 +1,69 @@
+// Package blobstore stores the bodies of crawled pages by their content, so
+// that the same body is only stored once.
+package blobstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned when getting a blob that isn't stored.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs under the hex encoded SHA-256 of their content.
+type BlobStore interface {
+	// Put stores the content unless it's already stored and returns its
+	// key.
+	Put(content []byte) (string, error)
+	// Get returns the content stored under the key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+}
+
+// Key returns the key of the content.
+func Key(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// validateKey returns an error unless the key could be the key of a content,
+// as keys are used in paths.
+func validateKey(key string) error {
+	if len(key) != sha256.Size*2 {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	return nil
+}
+
+// compress returns the content gzipped, as blobs are stored.
+func compress(content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func decompress(r io.Reader) ([]byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,87 @@
+package blobstore
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore stores blobs gzipped in a directory, in subdirectories named
+// after the first two characters of their key.
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore returns a store in the directory, which is created if it
+// doesn't exist.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key+".gz")
+}
+
+func (s *LocalStore) Put(content []byte) (string, error) {
+	key := Key(content)
+	path := s.path(key)
+
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+
+	compressed, err := compress(content)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	// blobs are written under a temporary name first so that concurrent
+	// puts of the same content never read a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tmp.Write(compressed); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return key, nil
+}
+
+func (s *LocalStore) Get(key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	compressed, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decompress(bytes.NewReader(compressed))
+}
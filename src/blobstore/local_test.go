@@ -0,0 +1,54 @@
+package blobstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("<html><body>page</body></html>")
+
+	t.Run("Test gets put content by its key", func(t *testing.T) {
+		key, err := s.Put(content)
+		assert.Nil(t, err)
+		assert.Equal(t, Key(content), key)
+
+		stored, err := s.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, content, stored)
+	})
+
+	t.Run("Test stores content once compressed", func(t *testing.T) {
+		key, _ := s.Put(content)
+		_, err := s.Put(content)
+		assert.Nil(t, err)
+
+		files, err := os.ReadDir(filepath.Join(dir, "blobs", key[:2]))
+		assert.Nil(t, err)
+		assert.Len(t, files, 1)
+		assert.Equal(t, key+".gz", files[0].Name())
+
+		compressed, _ := os.ReadFile(filepath.Join(dir, "blobs", key[:2], key+".gz"))
+		assert.Equal(t, []byte{0x1f, 0x8b}, compressed[:2])
+	})
+
+	t.Run("Test returns not found for missing content", func(t *testing.T) {
+		_, err := s.Get(Key([]byte("missing")))
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Test returns error on invalid key", func(t *testing.T) {
+		_, err := s.Get("../../etc/passwd")
+		assert.NotNil(t, err)
+		assert.NotEqual(t, ErrNotFound, err)
+	})
+}
@@ -0,0 +1,219 @@
+package blobstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures a store in a bucket of an S3 compatible object
+// storage.
+type S3Config struct {
+	// Endpoint is the base url of the storage, such as
+	// https://s3.eu-west-1.amazonaws.com. Buckets are addressed by path.
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region"`
+	// Prefix is prepended to the keys of the blobs, such as "snapshots/".
+	Prefix          string `json:"prefix,omitempty"`
+	AccessKeyId     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+}
+
+// Validate returns an error if the config is incomplete.
+func (c S3Config) Validate() error {
+	if c.Endpoint == "" || c.Bucket == "" || c.Region == "" {
+		return errors.New("s3 endpoint, bucket and region are required")
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid s3 endpoint %q", c.Endpoint)
+	}
+
+	if c.AccessKeyId == "" || c.SecretAccessKey == "" {
+		return errors.New("s3 credentials are required")
+	}
+
+	return nil
+}
+
+// S3Store stores blobs gzipped as objects of a bucket, signing its requests
+// with AWS Signature Version 4.
+type S3Store struct {
+	client *http.Client
+	config S3Config
+}
+
+// NewS3Store returns a store in the bucket of the config, requested with the
+// client.
+func NewS3Store(client *http.Client, config S3Config) (*S3Store, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &S3Store{client: client, config: config}, nil
+}
+
+func (s *S3Store) objectUrl(key string) string {
+	return s.config.Endpoint + "/" + s.config.Bucket + "/" + s.config.Prefix + key + ".gz"
+}
+
+func (s *S3Store) Put(content []byte) (string, error) {
+	key := Key(content)
+
+	resp, err := s.do(http.MethodHead, key, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return key, nil
+	case http.StatusNotFound, http.StatusForbidden:
+		// buckets without list permission deny heads of missing objects
+	default:
+		return "", fmt.Errorf("checking blob %s: %s", key, resp.Status)
+	}
+
+	compressed, err := compress(content)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err = s.do(http.MethodPut, key, compressed)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("storing blob %s: %s", key, resp.Status)
+	}
+
+	return key, nil
+}
+
+func (s *S3Store) Get(key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting blob %s: %s", key, resp.Status)
+	}
+
+	return decompress(resp.Body)
+}
+
+func (s *S3Store) do(method string, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectUrl(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+
+	signRequest(req, body, s.config, time.Now())
+	return s.client.Do(req)
+}
+
+// signRequest sets the headers authenticating the request with AWS
+// Signature Version 4, signing its host and the headers already set.
+func signRequest(req *http.Request, body []byte, config S3Config, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKeyId, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query sorted by name, escaped as signed.
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
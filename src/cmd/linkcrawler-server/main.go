@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -9,9 +10,13 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/alicansa/go-linkcrawler/blobstore"
 	"github.com/alicansa/go-linkcrawler/crawler"
 	"github.com/alicansa/go-linkcrawler/dal/postgres"
+	"github.com/alicansa/go-linkcrawler/secrets"
 	"github.com/alicansa/go-linkcrawler/server"
 )
 
@@ -19,6 +24,16 @@ type Main struct {
 	// HTTP server for handling HTTP communication.
 	HTTPServer *server.Server
 	DB         *postgres.DB
+
+	// FetchConfig configures the http clients of all crawl jobs, which may
+	// override it.
+	FetchConfig crawler.FetchConfig
+	// AddressGuard blocks crawling internal addresses but for the ones
+	// allowed by the operator.
+	AddressGuard *crawler.AddressGuard
+	// Snapshots are the stores crawl jobs may keep the bodies of their
+	// pages in, by name.
+	Snapshots map[string]blobstore.BlobStore
 }
 
 const (
@@ -27,6 +42,19 @@ const (
 	user     = "test_user"
 	password = "test_pw"
 	dbname   = "linkcrawler_db"
+
+	// credentialsKeyEnv names the environment variable holding the base64
+	// encoded key crawl job credentials are encrypted with
+	credentialsKeyEnv = "LINKCRAWLER_CREDENTIALS_KEY"
+
+	// the environment variables holding the credentials of the s3 snapshot
+	// store, unless set in its config
+	s3AccessKeyIdEnv     = "AWS_ACCESS_KEY_ID"
+	s3SecretAccessKeyEnv = "AWS_SECRET_ACCESS_KEY"
+
+	// the names crawl jobs select the snapshot stores by
+	localSnapshotStore = "local"
+	s3SnapshotStore    = "s3"
 )
 
 func main() {
@@ -78,7 +106,9 @@ func NewMain() *Main {
 		host, port, user, password, dbname)
 
 	return &Main{
-		DB: postgres.NewDB(dsn),
+		DB:          postgres.NewDB(dsn),
+		FetchConfig: crawler.DefaultFetchConfig(),
+		Snapshots:   make(map[string]blobstore.BlobStore),
 	}
 }
 
@@ -86,6 +116,44 @@ func NewMain() *Main {
 // calling this function.
 func (m *Main) Run(ctx context.Context) (err error) {
 
+	var port int
+	var fetchConfigPath string
+	var allowedAddresses string
+	var snapshotDir string
+	var snapshotS3ConfigPath string
+	var warcDir string
+	flag.IntVar(&port, "p", 0, "port number")
+	flag.StringVar(&fetchConfigPath, "fetch-config", "", "json file of the fetch config of crawl jobs")
+	flag.StringVar(&allowedAddresses, "allow-addresses", "",
+		"comma separated networks, addresses and hosts crawl jobs may connect to although internal")
+	flag.StringVar(&snapshotDir, "snapshot-dir", "", "directory crawl jobs may keep the bodies of their pages in")
+	flag.StringVar(&snapshotS3ConfigPath, "snapshot-s3-config", "",
+		"json file of the s3 bucket crawl jobs may keep the bodies of their pages in")
+	flag.StringVar(&warcDir, "warc-dir", "", "directory crawl jobs may archive their crawls in as WARC files")
+	flag.Parse()
+
+	if m.AddressGuard, err = crawler.NewAddressGuard(strings.Split(allowedAddresses, ",")); err != nil {
+		return err
+	}
+
+	if fetchConfigPath != "" {
+		if err := m.loadFetchConfig(fetchConfigPath); err != nil {
+			return err
+		}
+	}
+
+	if snapshotDir != "" {
+		if m.Snapshots[localSnapshotStore], err = blobstore.NewLocalStore(snapshotDir); err != nil {
+			return err
+		}
+	}
+
+	if snapshotS3ConfigPath != "" {
+		if err := m.loadS3SnapshotStore(snapshotS3ConfigPath); err != nil {
+			return err
+		}
+	}
+
 	//Connect to DB
 	if err := m.DB.Open(); err != nil {
 		return err
@@ -98,22 +166,36 @@ func (m *Main) Run(ctx context.Context) (err error) {
 	crawlJobRepo := postgres.NewCrawlJobRepository(m.DB)
 
 	//crawler creator
-	createCrawler := func(pe crawler.CrawlPolicyExecuter) crawler.WebCrawler {
-		httpClient := &http.Client{}
-		return crawler.NewCrawler(httpClient, pe)
+	createCrawler := func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler {
+		httpClient, err := m.FetchConfig.Merge(opts.Fetch).NewGuardedHTTPClient(m.AddressGuard)
+		if err != nil {
+			// both configs are validated before being used, so this is
+			// not expected
+			log.Printf("invalid fetch config, using defaults: %v", err)
+			httpClient, _ = crawler.DefaultFetchConfig().NewGuardedHTTPClient(m.AddressGuard)
+		}
+		return crawler.NewCrawler(httpClient, pe, opts)
+	}
+
+	// authenticated crawls are only accepted with a credentials key
+	var credentials *secrets.Cipher
+	if key := os.Getenv(credentialsKeyEnv); key != "" {
+		if credentials, err = secrets.NewCipherFromBase64(key); err != nil {
+			return fmt.Errorf("invalid %s: %w", credentialsKeyEnv, err)
+		}
 	}
 
 	//create handlers
-	linksHandler := server.NewLinksHandler(linkRepo)
-	crawlJobsHandler := server.NewCrawlJobHandler(crawlJobRepo, linkRepo, createCrawler)
+	linksHandler := server.NewLinksHandler(linkRepo, m.Snapshots)
+	crawlJobsHandler := server.NewCrawlJobHandler(
+		crawlJobRepo, linkRepo, createCrawler, credentials, m.AddressGuard, m.Snapshots, warcDir)
+
+	replayHandler := server.NewReplayHandler(linkRepo, crawlJobRepo, m.Snapshots)
 
 	//create server
-	m.HTTPServer = server.NewServer(linksHandler, crawlJobsHandler)
+	m.HTTPServer = server.NewServer(linksHandler, crawlJobsHandler, replayHandler)
 
 	// Start the HTTP server.
-	var port int
-	flag.IntVar(&port, "p", 0, "port number")
-	flag.Parse()
 	m.HTTPServer.Addr = ":" + strconv.Itoa(port)
 
 	if err := m.HTTPServer.Open(); err != nil {
@@ -124,3 +206,53 @@ func (m *Main) Run(ctx context.Context) (err error) {
 
 	return nil
 }
+
+// loadFetchConfig merges the fetch config in the json file into the default
+// one.
+func (m *Main) loadFetchConfig(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var fc crawler.FetchConfig
+	if err := json.Unmarshal(b, &fc); err != nil {
+		return fmt.Errorf("parsing fetch config %s: %w", path, err)
+	}
+
+	m.FetchConfig = m.FetchConfig.Merge(fc)
+	if err := m.FetchConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid fetch config %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadS3SnapshotStore adds the snapshot store of the s3 bucket configured in
+// the json file.
+func (m *Main) loadS3SnapshotStore(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config blobstore.S3Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		return fmt.Errorf("parsing s3 config %s: %w", path, err)
+	}
+
+	if config.AccessKeyId == "" {
+		config.AccessKeyId = os.Getenv(s3AccessKeyIdEnv)
+	}
+	if config.SecretAccessKey == "" {
+		config.SecretAccessKey = os.Getenv(s3SecretAccessKeyEnv)
+	}
+
+	store, err := blobstore.NewS3Store(&http.Client{Timeout: time.Minute}, config)
+	if err != nil {
+		return fmt.Errorf("invalid s3 config %s: %w", path, err)
+	}
+
+	m.Snapshots[s3SnapshotStore] = store
+	return nil
+}
@@ -0,0 +1,232 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// blockedNetworks are the ranges of addresses crawlers don't connect to, so
+// that crawl jobs can't reach the internal networks of the server.
+var blockedNetworks = []struct {
+	cidr   string
+	reason string
+}{
+	{"0.0.0.0/8", "unspecified"},
+	{"10.0.0.0/8", "private"},
+	{"100.64.0.0/10", "shared"},
+	{"127.0.0.0/8", "loopback"},
+	{"169.254.0.0/16", "link-local"},
+	{"172.16.0.0/12", "private"},
+	{"192.0.0.0/24", "reserved"},
+	{"192.168.0.0/16", "private"},
+	{"198.18.0.0/15", "reserved"},
+	{"224.0.0.0/4", "multicast"},
+	{"240.0.0.0/4", "reserved"},
+	{"::/128", "unspecified"},
+	{"::1/128", "loopback"},
+	{"64:ff9b::/96", "translated"},
+	{"fc00::/7", "private"},
+	{"fe80::/10", "link-local"},
+	{"ff00::/8", "multicast"},
+}
+
+// metadataAddresses are the addresses of cloud metadata services, which are
+// within the blocked networks but are worth a clearer error.
+var metadataAddresses = map[string]struct{}{
+	"169.254.169.254": {},
+	"100.100.100.200": {},
+	"fd00:ec2::254":   {},
+}
+
+// BlockedAddressError is returned when a crawler is refused a connection to
+// an address of the blocked networks.
+type BlockedAddressError struct {
+	// Host is the host name resolved to the address, if known.
+	Host   string
+	IP     net.IP
+	Reason string
+}
+
+func (e *BlockedAddressError) Error() string {
+	if e.Host != "" && e.Host != e.IP.String() {
+		return fmt.Sprintf("%s resolves to %s address %s, which is not allowed", e.Host, e.Reason, e.IP)
+	}
+	return fmt.Sprintf("%s address %s is not allowed", e.Reason, e.IP)
+}
+
+// AddressGuard blocks connections to loopback, link-local, private and
+// metadata addresses, unless they're allowed by the operator. Addresses are
+// checked once resolved, when connecting, so that a host name can't resolve
+// to a public address when checked and to an internal one when crawled.
+type AddressGuard struct {
+	networks []*net.IPNet
+	hosts    map[string]struct{}
+}
+
+// NewAddressGuard returns a guard allowing the given networks, addresses and
+// host names on top of the public addresses.
+func NewAddressGuard(allowlist []string) (*AddressGuard, error) {
+	guard := &AddressGuard{hosts: make(map[string]struct{})}
+
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			guard.networks = append(guard.networks, network)
+			continue
+		}
+
+		if ip := net.ParseIP(entry); ip != nil {
+			guard.networks = append(guard.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+
+		if strings.ContainsAny(entry, "/:") {
+			return nil, fmt.Errorf("invalid allowlist entry %q", entry)
+		}
+		guard.hosts[strings.ToLower(entry)] = struct{}{}
+	}
+
+	return guard, nil
+}
+
+// Check returns a *BlockedAddressError if the address isn't allowed.
+func (g *AddressGuard) Check(ip net.IP) error {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, network := range g.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	if _, ok := metadataAddresses[ip.String()]; ok {
+		return &BlockedAddressError{IP: ip, Reason: "metadata"}
+	}
+
+	for _, blocked := range parsedBlockedNetworks {
+		if blocked.network.Contains(ip) {
+			return &BlockedAddressError{IP: ip, Reason: blocked.reason}
+		}
+	}
+
+	return nil
+}
+
+// CheckUrl returns a *BlockedAddressError if the host of the url resolves to
+// an address that isn't allowed. Urls without a host and hosts that don't
+// resolve are left for the crawler to fail on.
+func (g *AddressGuard) CheckUrl(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	host := u.Hostname()
+	if g.allowsHost(host) {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return g.Check(ip)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	for _, addr := range addrs {
+		if err := g.Check(addr.IP); err != nil {
+			err.(*BlockedAddressError).Host = host
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *AddressGuard) allowsHost(host string) bool {
+	_, ok := g.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+	return ok
+}
+
+// control checks the address a dialer is about to connect to.
+func (g *AddressGuard) control(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("unexpected address %q", address)
+	}
+	return g.Check(ip)
+}
+
+// dialer is the interface of net.Dialer used by http transports and proxies.
+type dialer interface {
+	Dial(network string, address string) (net.Conn, error)
+	DialContext(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+// guardedDialer dials the allowed hosts with the dialer and checks the
+// address of every other connection.
+type guardedDialer struct {
+	dialer  *net.Dialer
+	guarded *net.Dialer
+	guard   *AddressGuard
+}
+
+func (g *AddressGuard) guardDialer(d *net.Dialer) *guardedDialer {
+	guarded := *d
+	guarded.Control = g.control
+	return &guardedDialer{dialer: d, guarded: &guarded, guard: g}
+}
+
+func (gd *guardedDialer) Dial(network string, address string) (net.Conn, error) {
+	return gd.DialContext(context.Background(), network, address)
+}
+
+func (gd *guardedDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err == nil && gd.guard.allowsHost(host) {
+		return gd.dialer.DialContext(ctx, network, address)
+	}
+
+	conn, err := gd.guarded.DialContext(ctx, network, address)
+
+	var blocked *BlockedAddressError
+	if errors.As(err, &blocked) {
+		blocked.Host = host
+		return nil, blocked
+	}
+	return conn, err
+}
+
+type blockedNetwork struct {
+	network *net.IPNet
+	reason  string
+}
+
+var parsedBlockedNetworks = func() []blockedNetwork {
+	networks := make([]blockedNetwork, 0, len(blockedNetworks))
+	for _, blocked := range blockedNetworks {
+		_, network, err := net.ParseCIDR(blocked.cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, blockedNetwork{network: network, reason: blocked.reason})
+	}
+	return networks
+}()
@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressGuardCheck(t *testing.T) {
+	guard, err := NewAddressGuard(nil)
+	assert.Nil(t, err)
+
+	for ip, reason := range map[string]string{
+		"127.0.0.1":       "loopback",
+		"::1":             "loopback",
+		"::ffff:10.1.2.3": "private",
+		"192.168.1.1":     "private",
+		"172.20.0.1":      "private",
+		"169.254.169.254": "metadata",
+		"169.254.1.1":     "link-local",
+		"fe80::1":         "link-local",
+		"fd00:ec2::254":   "metadata",
+		"0.0.0.0":         "unspecified",
+	} {
+		var blocked *BlockedAddressError
+		assert.True(t, errors.As(guard.Check(net.ParseIP(ip)), &blocked), ip)
+		assert.Equal(t, reason, blocked.Reason, ip)
+	}
+
+	for _, ip := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		assert.Nil(t, guard.Check(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestAddressGuardAllowlist(t *testing.T) {
+	_, err := NewAddressGuard([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err)
+
+	guard, err := NewAddressGuard([]string{"10.1.0.0/16", "192.168.1.10", " intranet.local ", ""})
+	assert.Nil(t, err)
+
+	assert.Nil(t, guard.Check(net.ParseIP("10.1.2.3")))
+	assert.Nil(t, guard.Check(net.ParseIP("192.168.1.10")))
+	assert.NotNil(t, guard.Check(net.ParseIP("10.2.0.1")))
+	assert.NotNil(t, guard.Check(net.ParseIP("192.168.1.11")))
+
+	assert.Nil(t, guard.CheckUrl(context.Background(), "http://intranet.local/"))
+	assert.Nil(t, guard.CheckUrl(context.Background(), "http://10.1.0.1:8080/"))
+	assert.NotNil(t, guard.CheckUrl(context.Background(), "http://[::1]/"))
+	assert.Nil(t, guard.CheckUrl(context.Background(), "test"))
+
+	err = guard.CheckUrl(context.Background(), "http://localhost/")
+	assert.EqualError(t, err, "localhost resolves to loopback address 127.0.0.1, which is not allowed")
+}
+
+func TestGuardedCrawl(t *testing.T) {
+	pe := NewPolicyExecutor("//a[@href]")
+
+	t.Run("Test records pages at blocked addresses without failing", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("blocked server was requested")
+		}))
+		defer server.Close()
+
+		guard, _ := NewAddressGuard(nil)
+		client, err := FetchConfig{}.NewGuardedHTTPClient(guard)
+		assert.Nil(t, err)
+
+		var pages []CrawledPage
+		c := NewCrawler(client, pe, CrawlOptions{})
+		_, err = c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error {
+			pages = append(pages, page)
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Len(t, pages, 1)
+		assert.Equal(t, 0, pages[0].StatusCode)
+		assert.Contains(t, pages[0].FetchError, "loopback address 127.0.0.1")
+	})
+
+	t.Run("Test blocks redirects from allowed hosts", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<html><a href='/redirect'>redirect</a><a href='/page'>page</a></html>`))
+		})
+		mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://127.0.0.1:"+port(t, r.Host)+"/internal", http.StatusFound)
+		})
+		mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+			t.Error("redirect to blocked address was followed")
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		guard, _ := NewAddressGuard([]string{"localhost"})
+		client, err := FetchConfig{}.NewGuardedHTTPClient(guard)
+		assert.Nil(t, err)
+
+		var mx sync.Mutex
+		pages := make(map[string]CrawledPage)
+		seed := "http://localhost:" + port(t, server.Listener.Addr().String())
+		c := NewCrawler(client, pe, CrawlOptions{})
+		_, err = c.Crawl([]string{seed}, func(links []Link) error { return nil }, func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, pages[seed+"/"].StatusCode)
+		assert.Equal(t, http.StatusOK, pages[seed+"/page"].StatusCode)
+		assert.Contains(t, pages[seed+"/redirect"].FetchError, "loopback address 127.0.0.1")
+	})
+
+	t.Run("Test checks hosts requested through a proxy", func(t *testing.T) {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("blocked host was requested through the proxy")
+		}))
+		defer proxy.Close()
+
+		guard, _ := NewAddressGuard([]string{"127.0.0.1"})
+		client, err := FetchConfig{Proxy: proxy.URL}.NewGuardedHTTPClient(guard)
+		assert.Nil(t, err)
+
+		_, err = client.Get("http://10.0.0.1/")
+		var blocked *BlockedAddressError
+		assert.True(t, errors.As(err, &blocked))
+	})
+
+	t.Run("Test checks hosts requested through a proxy of the environment", func(t *testing.T) {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Host == "10.0.0.1" {
+				t.Error("blocked host was requested through the proxy")
+			}
+		}))
+		defer proxy.Close()
+
+		t.Setenv("HTTP_PROXY", proxy.URL)
+		t.Setenv("NO_PROXY", "")
+
+		guard, _ := NewAddressGuard([]string{"127.0.0.1", "public.test"})
+		client, err := FetchConfig{}.NewGuardedHTTPClient(guard)
+		assert.Nil(t, err)
+
+		_, err = client.Get("http://10.0.0.1/")
+		var blocked *BlockedAddressError
+		assert.True(t, errors.As(err, &blocked))
+
+		// allowed hosts are still requested through the proxy
+		resp, err := client.Get("http://public.test/")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func port(t *testing.T, hostport string) string {
+	_, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alicansa/go-linkcrawler/warc"
+)
+
+// redactedHeaders are the request headers left out of WARC records, as they
+// hold the credentials of the crawl.
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// recordingReader keeps what's read from a response body for its WARC record,
+// and whether the body was read to its end.
+type recordingReader struct {
+	r   io.Reader
+	buf bytes.Buffer
+	eof bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf.Write(p[:n])
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// archiveExchange writes the request and response records of a fetch and
+// returns the id of the response record. The response body is recorded as
+// received, read to its end unless it's larger than the maximum body size.
+func (c *LinkCrawler) archiveExchange(resp *http.Response, body *recordingReader, oversized bool) (string, error) {
+	date := time.Now()
+
+	if !oversized {
+		remaining := c.Options.maxBodySize() - int64(body.buf.Len())
+		if remaining > 0 {
+			io.Copy(io.Discard, io.LimitReader(body, remaining))
+		}
+	}
+
+	// the request is the last one made, if redirects were followed
+	req := resp.Request
+	target := req.URL.String()
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.URL.Host)
+	header := req.Header.Clone()
+	for _, name := range redactedHeaders {
+		header.Del(name)
+	}
+	header.Write(&request)
+	request.WriteString("\r\n")
+
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&response)
+	response.WriteString("\r\n")
+	response.Write(body.buf.Bytes())
+
+	var truncated string
+	if !body.eof && resp.ContentLength != 0 {
+		truncated = "length"
+	}
+
+	responseId := warc.NewRecordId()
+	_, err := c.Options.Warc.Write(
+		warc.Record{
+			Type:         warc.Request,
+			TargetURI:    target,
+			Date:         date,
+			ContentType:  warc.HTTPRequestContentType,
+			ConcurrentTo: responseId,
+			Content:      request.Bytes(),
+		},
+		warc.Record{
+			Type:        warc.Response,
+			Id:          responseId,
+			TargetURI:   target,
+			Date:        date,
+			ContentType: warc.HTTPResponseContentType,
+			Truncated:   truncated,
+			Content:     response.Bytes(),
+		})
+
+	if err != nil {
+		return "", err
+	}
+
+	return responseId, nil
+}
+
+// archiveOutlinks writes the metadata record listing the links found on the
+// page, concurrent to its response record.
+func (c *LinkCrawler) archiveOutlinks(page CrawledPage) error {
+	if page.warcRecordId == "" || len(page.Links)+len(page.ExternalLinks) == 0 {
+		return nil
+	}
+
+	var fields bytes.Buffer
+	for _, links := range [][]Link{page.Links, page.ExternalLinks} {
+		for _, link := range links {
+			fmt.Fprintf(&fields, "outlink: %s\r\n", link.Url)
+		}
+	}
+
+	_, err := c.Options.Warc.Write(warc.Record{
+		Type:         warc.Metadata,
+		TargetURI:    page.Url,
+		ContentType:  warc.WarcFieldsContentType,
+		ConcurrentTo: page.warcRecordId,
+		Content:      fields.Bytes(),
+	})
+	return err
+}
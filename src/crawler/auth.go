@@ -0,0 +1,362 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+type AuthType string
+
+const (
+	NoAuth     AuthType = ""
+	BasicAuth  AuthType = "basic"
+	BearerAuth AuthType = "bearer"
+	FormAuth   AuthType = "form"
+)
+
+// AuthConfig configures how a crawler authenticates to the crawled site.
+// Credentials are only sent to the hosts of the config, which are the hosts
+// of the seeds unless listed.
+type AuthConfig struct {
+	Type     AuthType `json:"type,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Token    string   `json:"token,omitempty"`
+	// Cookies are set for the hosts before the crawl starts, whatever the
+	// type.
+	Cookies map[string]string `json:"cookies,omitempty"`
+	Form    *FormLogin        `json:"form,omitempty"`
+	// Hosts are the hosts credentials are sent to, such as example.com or
+	// example.com:8080, and whose responses asking for a login are logged
+	// in again.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// FormLogin describes a login form submitted before the crawl starts and
+// again whenever the site asks for a login.
+type FormLogin struct {
+	// LoginUrl is the page of the login form. Responses redirecting to
+	// it are taken as a request to log in again.
+	LoginUrl string `json:"loginUrl"`
+	// FormSelector is the css selector of the form, the first form of the
+	// page if empty.
+	FormSelector string `json:"formSelector,omitempty"`
+	// Fields maps css selectors of form fields to the values they're
+	// filled with. The other fields are submitted with their values.
+	Fields map[string]string `json:"fields"`
+}
+
+// Validate returns an error if the config is missing the credentials of its
+// type or a host isn't a host name with an optional port.
+func (ac AuthConfig) Validate() error {
+	for _, host := range ac.Hosts {
+		if u, err := url.Parse("//" + host); err != nil || host == "" || u.Host != host {
+			return fmt.Errorf("invalid auth host %q", host)
+		}
+	}
+
+	switch ac.Type {
+	case NoAuth:
+	case BasicAuth:
+		if ac.Username == "" {
+			return errors.New("basic auth requires a username")
+		}
+	case BearerAuth:
+		if ac.Token == "" {
+			return errors.New("bearer auth requires a token")
+		}
+	case FormAuth:
+		if ac.Form == nil || ac.Form.LoginUrl == "" {
+			return errors.New("form auth requires a login url")
+		}
+		if _, err := url.Parse(ac.Form.LoginUrl); err != nil {
+			return fmt.Errorf("invalid login url: %w", err)
+		}
+		if ac.Form.FormSelector != "" {
+			if _, err := cascadia.Compile(ac.Form.FormSelector); err != nil {
+				return fmt.Errorf("invalid form selector: %w", err)
+			}
+		}
+		for selector := range ac.Form.Fields {
+			if _, err := cascadia.Compile(selector); err != nil {
+				return fmt.Errorf("invalid field selector %q: %w", selector, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported auth type %q", ac.Type)
+	}
+	return nil
+}
+
+// IsZero reports whether the config doesn't authenticate at all.
+func (ac AuthConfig) IsZero() bool {
+	return ac.Type == NoAuth && len(ac.Cookies) == 0
+}
+
+// authenticator authenticates the requests of a crawler's client.
+type authenticator struct {
+	config AuthConfig
+	jar    http.CookieJar
+	// loginClient shares the jar of the crawler's client but not its
+	// authentication
+	loginClient *http.Client
+
+	mx sync.Mutex
+	// hosts are the lower case hosts the credentials are sent to
+	hosts map[string]struct{}
+	// logins counts the logins so that requests failing concurrently only
+	// log in once
+	logins int
+}
+
+// authenticate returns a copy of the client authenticating its requests as
+// configured and the authenticator to start before crawling.
+func authenticate(client *http.Client, config AuthConfig) (*http.Client, *authenticator) {
+	authenticated := *client
+	if authenticated.Jar == nil {
+		// a cookie jar never fails to be created without options
+		authenticated.Jar, _ = cookiejar.New(nil)
+	}
+
+	base := authenticated.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	loginClient := authenticated
+	loginClient.Transport = base
+
+	auth := &authenticator{
+		config:      config,
+		jar:         authenticated.Jar,
+		loginClient: &loginClient,
+	}
+	authenticated.Transport = &authTransport{base: base, auth: auth}
+	return &authenticated, auth
+}
+
+// start scopes the credentials to the configured hosts, or to the hosts of
+// the seeds, sets the configured cookies and logs in.
+func (a *authenticator) start(seeds []string) error {
+	hosts := a.config.Hosts
+	if len(hosts) == 0 {
+		for _, seed := range seeds {
+			seedUrl, err := url.Parse(seed)
+			if err != nil {
+				return err
+			}
+			hosts = append(hosts, seedUrl.Host)
+		}
+	}
+
+	a.mx.Lock()
+	a.hosts = make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		a.hosts[strings.ToLower(host)] = struct{}{}
+	}
+	a.mx.Unlock()
+
+	var cookies []*http.Cookie
+	for name, value := range a.config.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+	}
+	for host := range a.hosts {
+		// cookies without the secure attribute are sent over any scheme
+		a.jar.SetCookies(&url.URL{Scheme: "http", Host: host}, cookies)
+	}
+
+	if a.config.Type == FormAuth {
+		return a.relogin(0)
+	}
+	return nil
+}
+
+// session returns whether the credentials are sent to the host of the url
+// and the number of logins so far.
+func (a *authenticator) session(u *url.URL) (bool, int) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	_, ok := a.hosts[strings.ToLower(u.Host)]
+	return ok, a.logins
+}
+
+// relogin logs in unless another login happened since the given number of
+// logins.
+func (a *authenticator) relogin(logins int) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if a.logins != logins {
+		return nil
+	}
+
+	if err := a.login(); err != nil {
+		return err
+	}
+	a.logins++
+	return nil
+}
+
+// login submits the login form, storing the session cookies in the jar.
+func (a *authenticator) login() error {
+	form := a.config.Form
+	resp, err := a.loginClient.Get(form.LoginUrl)
+	if err != nil {
+		return fmt.Errorf("fetching login page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching login page: %s", resp.Status)
+	}
+
+	doc, err := html.Parse(resp.Body)
+	if err != nil {
+		return fmt.Errorf("parsing login page: %w", err)
+	}
+
+	action, values, err := fillLoginForm(doc, resp.Request.URL, form)
+	if err != nil {
+		return err
+	}
+
+	loginResp, err := a.loginClient.PostForm(action, values)
+	if err != nil {
+		return fmt.Errorf("submitting login form: %w", err)
+	}
+	loginResp.Body.Close()
+
+	if loginResp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("submitting login form: %s", loginResp.Status)
+	}
+	return nil
+}
+
+// fillLoginForm returns the url the login form is submitted to and its
+// values filled with the configured ones.
+func fillLoginForm(doc *html.Node, pageUrl *url.URL, login *FormLogin) (string, url.Values, error) {
+	formSelector := login.FormSelector
+	if formSelector == "" {
+		formSelector = "form"
+	}
+
+	form := cascadia.Query(doc, cascadia.MustCompile(formSelector))
+	if form == nil {
+		return "", nil, fmt.Errorf("login form %q not found", formSelector)
+	}
+
+	values := url.Values{}
+	for _, field := range cascadia.QueryAll(form, cascadia.MustCompile("input[name]")) {
+		if _, disabled := lookupAttr(field, "disabled"); disabled {
+			continue
+		}
+
+		switch strings.ToLower(selectAttr(field, "type")) {
+		case "submit", "button", "image", "reset", "file":
+			continue
+		case "checkbox", "radio":
+			if _, checked := lookupAttr(field, "checked"); !checked {
+				continue
+			}
+		}
+
+		values.Set(selectAttr(field, "name"), selectAttr(field, "value"))
+	}
+
+	for selector, value := range login.Fields {
+		field := cascadia.Query(form, cascadia.MustCompile(selector))
+		if field == nil {
+			return "", nil, fmt.Errorf("login field %q not found", selector)
+		}
+
+		name := selectAttr(field, "name")
+		if name == "" {
+			return "", nil, fmt.Errorf("login field %q has no name", selector)
+		}
+		values.Set(name, value)
+	}
+
+	action := pageUrl
+	if ref := selectAttr(form, "action"); ref != "" {
+		resolved, err := pageUrl.Parse(ref)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid login form action: %w", err)
+		}
+		action = resolved
+	}
+
+	return action.String(), values, nil
+}
+
+// needsLogin reports whether the response asks for the session to be
+// logged in again.
+func (a *authenticator) needsLogin(resp *http.Response) bool {
+	if a.config.Type != FormAuth {
+		return false
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return false
+	}
+
+	loginUrl, err := resp.Request.URL.Parse(a.config.Form.LoginUrl)
+	if err != nil {
+		return false
+	}
+
+	return location.Host == loginUrl.Host && location.Path == loginUrl.Path
+}
+
+// authTransport adds the credentials to requests to the crawled hosts and
+// logs in again when the site asks for it.
+type authTransport struct {
+	base http.RoundTripper
+	auth *authenticator
+}
+
+func (at *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	allowed, logins := at.auth.session(req.URL)
+	if !allowed {
+		return at.base.RoundTrip(req)
+	}
+
+	// a round tripper must not modify the request it's given
+	req = req.Clone(req.Context())
+	switch at.auth.config.Type {
+	case BasicAuth:
+		req.SetBasicAuth(at.auth.config.Username, at.auth.config.Password)
+	case BearerAuth:
+		req.Header.Set("Authorization", "Bearer "+at.auth.config.Token)
+	}
+
+	resp, err := at.base.RoundTrip(req)
+	if err != nil || !at.auth.needsLogin(resp) || req.Body != nil {
+		return resp, err
+	}
+
+	resp.Body.Close()
+	if err := at.auth.relogin(logins); err != nil {
+		return nil, err
+	}
+
+	// the cookies of the request were set by the client from the jar
+	// before the session was renewed
+	req.Header.Del("Cookie")
+	for _, cookie := range at.auth.jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	return at.base.RoundTrip(req)
+}
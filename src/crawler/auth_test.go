@@ -0,0 +1,242 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthConfigValidate(t *testing.T) {
+	assert.Nil(t, AuthConfig{}.Validate())
+	assert.Nil(t, AuthConfig{Type: BasicAuth, Username: "user"}.Validate())
+	assert.NotNil(t, AuthConfig{Type: BasicAuth}.Validate())
+	assert.NotNil(t, AuthConfig{Type: BearerAuth}.Validate())
+	assert.NotNil(t, AuthConfig{Type: FormAuth}.Validate())
+	assert.NotNil(t, AuthConfig{Type: FormAuth, Form: &FormLogin{
+		LoginUrl: "https://example.com/login",
+		Fields:   map[string]string{"input[": "user"},
+	}}.Validate())
+	assert.NotNil(t, AuthConfig{Type: "digest"}.Validate())
+
+	assert.Nil(t, AuthConfig{Type: BearerAuth, Token: "token", Hosts: []string{"example.com", "api.example.com:8080"}}.Validate())
+	assert.NotNil(t, AuthConfig{Type: BearerAuth, Token: "token", Hosts: []string{""}}.Validate())
+	assert.NotNil(t, AuthConfig{Type: BearerAuth, Token: "token", Hosts: []string{"https://example.com"}}.Validate())
+	assert.NotNil(t, AuthConfig{Type: BearerAuth, Token: "token", Hosts: []string{"example.com/path"}}.Validate())
+}
+
+func TestAuthenticatedCrawl(t *testing.T) {
+	pe := NewPolicyExecutor("//a[@href]")
+
+	t.Run("Test sends basic auth to the crawled host only", func(t *testing.T) {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _, ok := r.BasicAuth()
+			assert.False(t, ok)
+		}))
+		defer other.Close()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`<html><a href='/page'>page</a></html>`))
+		}))
+		defer server.Close()
+
+		c := NewCrawler(&http.Client{}, pe, CrawlOptions{
+			Auth: AuthConfig{Type: BasicAuth, Username: "user", Password: "secret"},
+		})
+		discoveredLinks, err := c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
+
+		assert.Nil(t, err)
+		assert.Len(t, discoveredLinks, 1)
+
+		_, err = c.Client.Get(other.URL)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Test sends basic auth to the hosts of every seed", func(t *testing.T) {
+		authenticated := func(w http.ResponseWriter, r *http.Request) {
+			if _, _, ok := r.BasicAuth(); !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`<html></html>`))
+		}
+		first := httptest.NewServer(http.HandlerFunc(authenticated))
+		defer first.Close()
+		second := httptest.NewServer(http.HandlerFunc(authenticated))
+		defer second.Close()
+
+		c := NewCrawler(&http.Client{}, pe, CrawlOptions{
+			Auth: AuthConfig{Type: BasicAuth, Username: "user", Password: "secret"},
+		})
+		var mx sync.Mutex
+		statusCodes := make(map[string]int)
+		_, err := c.Crawl([]string{first.URL, second.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			statusCodes[page.Url] = page.StatusCode
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int{first.URL + "/": 200, second.URL + "/": 200}, statusCodes)
+	})
+
+	t.Run("Test sends basic auth to the configured hosts only", func(t *testing.T) {
+		var mx sync.Mutex
+		var authorized []string
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			if _, _, ok := r.BasicAuth(); ok {
+				mx.Lock()
+				authorized = append(authorized, r.Host)
+				mx.Unlock()
+			}
+			w.Write([]byte(`<html></html>`))
+		}
+		seed := httptest.NewServer(http.HandlerFunc(handler))
+		defer seed.Close()
+		api := httptest.NewServer(http.HandlerFunc(handler))
+		defer api.Close()
+
+		apiUrl, _ := url.Parse(api.URL)
+		c := NewCrawler(&http.Client{}, pe, CrawlOptions{
+			Auth: AuthConfig{Type: BasicAuth, Username: "user", Password: "secret", Hosts: []string{apiUrl.Host}},
+		})
+		_, err := c.Crawl([]string{seed.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
+		assert.Nil(t, err)
+
+		_, err = c.Client.Get(api.URL)
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{apiUrl.Host}, authorized)
+	})
+
+	t.Run("Test sends bearer token and cookies", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("tenant")
+			if r.Header.Get("Authorization") != "Bearer token" || err != nil || cookie.Value != "acme" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`<html><a href='/page'>page</a></html>`))
+		}))
+		defer server.Close()
+
+		c := NewCrawler(&http.Client{}, pe, CrawlOptions{
+			Auth: AuthConfig{Type: BearerAuth, Token: "token", Cookies: map[string]string{"tenant": "acme"}},
+		})
+		var mx sync.Mutex
+		statusCodes := make(map[string]int)
+		_, err := c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			statusCodes[page.Url] = page.StatusCode
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int{server.URL + "/": 200, server.URL + "/page": 200}, statusCodes)
+	})
+
+	t.Run("Test logs in with form and again when redirected to login", func(t *testing.T) {
+		var mx sync.Mutex
+		logins := 0
+		sessions := make(map[string]bool)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`<html>
+					<form id='search' action='/search'><input name='q'></form>
+					<form id='login' action='/session' method='post'>
+						<input type='hidden' name='csrf' value='token'>
+						<input id='user' name='username'>
+						<input type='password' name='password'>
+						<input type='submit' name='go' value='Log in'>
+					</form>
+				</html>`))
+			}
+		})
+		mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+			mx.Lock()
+			defer mx.Unlock()
+			if r.PostFormValue("csrf") != "token" || r.PostFormValue("username") != "user" ||
+				r.PostFormValue("password") != "secret" || r.PostFormValue("go") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			logins++
+			session := string(rune('a' + logins))
+			sessions[session] = true
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: session, Path: "/"})
+			http.Redirect(w, r, "/", http.StatusFound)
+		})
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			mx.Lock()
+			cookie, err := r.Cookie("session")
+			valid := err == nil && sessions[cookie.Value]
+			if valid && r.URL.Path == "/expire" {
+				// the session expires while crawling
+				delete(sessions, cookie.Value)
+			}
+			mx.Unlock()
+
+			if !valid {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			switch r.URL.Path {
+			case "/":
+				w.Write([]byte(`<html><a href='/expire'>expire</a></html>`))
+			case "/expire":
+				w.Write([]byte(`<html><a href='/private'>private</a></html>`))
+			default:
+				w.Write([]byte(`<html></html>`))
+			}
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{
+			Auth: AuthConfig{Type: FormAuth, Form: &FormLogin{
+				LoginUrl:     server.URL + "/login",
+				FormSelector: "#login",
+				Fields:       map[string]string{"#user": "user", "input[type=password]": "secret"},
+			}},
+		})
+		var pages []CrawledPage
+		discoveredLinks, err := c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages = append(pages, page)
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]struct{}{server.URL + "/expire": {}, server.URL + "/private": {}}, discoveredLinks)
+		for _, page := range pages {
+			assert.Equal(t, http.StatusOK, page.StatusCode, page.Url)
+		}
+		assert.Equal(t, 2, logins)
+	})
+
+	t.Run("Test returns error if login form is missing", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<html></html>`))
+		}))
+		defer server.Close()
+
+		c := NewCrawler(&http.Client{}, pe, CrawlOptions{
+			Auth: AuthConfig{Type: FormAuth, Form: &FormLogin{LoginUrl: server.URL + "/login"}},
+		})
+		_, err := c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CanonicalizationConfig configures the rules rewriting the links of a crawl
+// before they're deduplicated, so that links to the same page with tracking
+// parameters or reordered queries are crawled and stored once. Parameters
+// are matched case insensitively by name or by glob, such as "utm_*".
+type CanonicalizationConfig struct {
+	// StripParams are removed from the links.
+	StripParams []string `json:"stripParams,omitempty"`
+	// SortParams sorts the query parameters by name.
+	SortParams bool `json:"sortParams,omitempty"`
+	// IgnoreParams are ignored when deduplicating links, but kept in the
+	// urls fetched.
+	IgnoreParams []string `json:"ignoreParams,omitempty"`
+	// LowercasePaths lowercases the paths of the links, for sites serving
+	// case insensitive paths.
+	LowercasePaths bool `json:"lowercasePaths,omitempty"`
+}
+
+// IsZero reports whether no rule is configured, in which case links aren't
+// rewritten.
+func (cc CanonicalizationConfig) IsZero() bool {
+	return len(cc.StripParams) == 0 && !cc.SortParams && len(cc.IgnoreParams) == 0 && !cc.LowercasePaths
+}
+
+// Validate returns an error if a parameter pattern is empty or isn't a valid
+// glob.
+func (cc CanonicalizationConfig) Validate() error {
+	for _, pattern := range append(append([]string(nil), cc.StripParams...), cc.IgnoreParams...) {
+		if strings.TrimSpace(pattern) == "" {
+			return errors.New("parameter patterns must not be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid parameter pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// canonicalize returns the url the link is fetched at and the canonical url
+// identifying it, which only differ by the ignored parameters.
+func (cc CanonicalizationConfig) canonicalize(rawUrl string) (string, string) {
+	if cc.IsZero() {
+		return rawUrl, rawUrl
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl, rawUrl
+	}
+
+	if cc.LowercasePaths {
+		u.Path = strings.ToLower(u.Path)
+		u.RawPath = strings.ToLower(u.RawPath)
+	}
+
+	var fetched, canonical []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		name := paramName(pair)
+		if matchParam(cc.StripParams, name) {
+			continue
+		}
+
+		fetched = append(fetched, pair)
+		if !matchParam(cc.IgnoreParams, name) {
+			canonical = append(canonical, pair)
+		}
+	}
+
+	if cc.SortParams {
+		sortParams(fetched)
+		sortParams(canonical)
+	}
+
+	u.RawQuery = strings.Join(fetched, "&")
+	fetchUrl := u.String()
+	u.RawQuery = strings.Join(canonical, "&")
+	return fetchUrl, u.String()
+}
+
+// canonicalLinks rewrites the links as configured, keeping the url they were
+// found at if it changed, and returns the unique ones.
+func (cc CanonicalizationConfig) canonicalLinks(links []Link) []Link {
+	if cc.IsZero() {
+		return links
+	}
+
+	var canonicalLinks []Link
+	seen := make(map[string]struct{}, len(links))
+	for _, link := range links {
+		fetchUrl, canonical := cc.canonicalize(link.Url)
+
+		if _, ok := seen[canonical]; ok {
+			continue
+		}
+		seen[canonical] = struct{}{}
+
+		if canonical != link.Url {
+			link.OriginalUrl = link.Url
+		}
+		if fetchUrl != canonical {
+			link.FetchUrl = fetchUrl
+		}
+		link.Url = canonical
+		canonicalLinks = append(canonicalLinks, link)
+	}
+	return canonicalLinks
+}
+
+// CanonicalSeeds returns the unique seeds of a crawl as rewritten by its
+// scope and canonicalization rules, which are the urls identifying the pages
+// crawled from them.
+func CanonicalSeeds(rawUrls []string, scope ScopeConfig, rules CanonicalizationConfig) ([]string, error) {
+	seeds, err := ScopedSeeds(rawUrls, scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	for _, seed := range seeds {
+		links = append(links, Link{Url: seed})
+	}
+
+	var canonicalSeeds []string
+	for _, link := range rules.canonicalLinks(links) {
+		canonicalSeeds = append(canonicalSeeds, link.Url)
+	}
+	return canonicalSeeds, nil
+}
+
+// paramName returns the unescaped and lowercased name of a query parameter.
+func paramName(pair string) string {
+	name, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+	return strings.ToLower(name)
+}
+
+func matchParam(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sortParams sorts the parameters by name, keeping the order of the values
+// of parameters with the same name.
+func sortParams(pairs []string) {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return paramName(pairs[i]) < paramName(pairs[j])
+	})
+}
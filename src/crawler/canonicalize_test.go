@@ -0,0 +1,164 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizationConfigValidate(t *testing.T) {
+	assert.Nil(t, CanonicalizationConfig{}.Validate())
+	assert.Nil(t, CanonicalizationConfig{StripParams: []string{"utm_*", "fbclid"}, IgnoreParams: []string{"ref"}}.Validate())
+
+	assert.NotNil(t, CanonicalizationConfig{StripParams: []string{""}}.Validate())
+	assert.NotNil(t, CanonicalizationConfig{IgnoreParams: []string{"utm_["}}.Validate())
+}
+
+func TestCanonicalize(t *testing.T) {
+
+	t.Run("Test leaves urls alone without rules", func(t *testing.T) {
+		fetchUrl, canonical := CanonicalizationConfig{}.canonicalize("https://example.com/A?b=1&a=2")
+
+		assert.Equal(t, "https://example.com/A?b=1&a=2", fetchUrl)
+		assert.Equal(t, "https://example.com/A?b=1&a=2", canonical)
+	})
+
+	t.Run("Test strips parameters by name and glob", func(t *testing.T) {
+		rules := CanonicalizationConfig{StripParams: []string{"utm_*", "FBCLID"}}
+
+		fetchUrl, canonical := rules.canonicalize("https://example.com/?utm_source=x&page=2&fbclid=1&UTM_medium=y")
+
+		assert.Equal(t, "https://example.com/?page=2", fetchUrl)
+		assert.Equal(t, "https://example.com/?page=2", canonical)
+	})
+
+	t.Run("Test sorts parameters and lowercases paths", func(t *testing.T) {
+		rules := CanonicalizationConfig{SortParams: true, LowercasePaths: true}
+
+		fetchUrl, canonical := rules.canonicalize("https://example.com/Docs/Page?b=1&a=2&b=0")
+
+		assert.Equal(t, "https://example.com/docs/page?a=2&b=1&b=0", fetchUrl)
+		assert.Equal(t, "https://example.com/docs/page?a=2&b=1&b=0", canonical)
+	})
+
+	t.Run("Test ignores parameters for dedupe only", func(t *testing.T) {
+		rules := CanonicalizationConfig{IgnoreParams: []string{"ref"}, StripParams: []string{"utm_*"}}
+
+		fetchUrl, canonical := rules.canonicalize("https://example.com/a?ref=home&id=1&utm_source=x")
+
+		assert.Equal(t, "https://example.com/a?ref=home&id=1", fetchUrl)
+		assert.Equal(t, "https://example.com/a?id=1", canonical)
+	})
+
+	t.Run("Test keeps the url links were found at", func(t *testing.T) {
+		rules := CanonicalizationConfig{IgnoreParams: []string{"ref"}, StripParams: []string{"utm_*"}}
+
+		links := rules.canonicalLinks([]Link{
+			{Url: "https://example.com/a"},
+			{Url: "https://example.com/b?utm_source=x"},
+			{Url: "https://example.com/b"},
+			{Url: "https://example.com/c?ref=home"},
+		})
+
+		assert.Equal(t, []Link{
+			{Url: "https://example.com/a"},
+			{Url: "https://example.com/b", OriginalUrl: "https://example.com/b?utm_source=x"},
+			{Url: "https://example.com/c", OriginalUrl: "https://example.com/c?ref=home", FetchUrl: "https://example.com/c?ref=home"},
+		}, links)
+	})
+}
+
+func TestCanonicalSeeds(t *testing.T) {
+	seeds, err := CanonicalSeeds(
+		[]string{"http://example.com/?utm_source=x", "https://example.com/"},
+		ScopeConfig{Scheme: UpgradeScheme},
+		CanonicalizationConfig{StripParams: []string{"utm_*"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.com/"}, seeds)
+}
+
+func TestCrawlDeduplicatesCanonicalLinks(t *testing.T) {
+	var mx sync.Mutex
+	var requested []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requested = append(requested, r.URL.RequestURI())
+		mx.Unlock()
+
+		if r.URL.Path != "/" {
+			w.Write([]byte(`<html></html>`))
+			return
+		}
+		w.Write([]byte(`<html>
+			<a href="/page?utm_source=news&b=2&a=1">page</a>
+			<a href="/page?a=1&b=2&utm_campaign=spring">page</a>
+			<a href="/other?ref=home">other</a>
+			<a href="/other?ref=footer">other</a>
+		</html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{
+		Canonicalization: CanonicalizationConfig{
+			StripParams:  []string{"utm_*"},
+			SortParams:   true,
+			IgnoreParams: []string{"ref"},
+		},
+	})
+
+	var reported []Link
+	pages := make(map[string]string)
+	fetchUrls := make(map[string]string)
+	_, err := c.Crawl(
+		[]string{server.URL},
+		func(links []Link) error {
+			mx.Lock()
+			defer mx.Unlock()
+			reported = append(reported, links...)
+			return nil
+		},
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page.OriginalUrl
+			fetchUrls[page.Url] = page.FetchUrl
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Link{
+		{
+			Url:         server.URL + "/page?a=1&b=2",
+			Kind:        NavigationLink,
+			Source:      LinkedSource,
+			Seed:        server.URL + "/",
+			OriginalUrl: server.URL + "/page?utm_source=news&b=2&a=1",
+		},
+		{
+			Url:         server.URL + "/other",
+			Kind:        NavigationLink,
+			Source:      LinkedSource,
+			Seed:        server.URL + "/",
+			OriginalUrl: server.URL + "/other?ref=home",
+			FetchUrl:    server.URL + "/other?ref=home",
+		},
+	}, reported)
+	assert.Equal(t, map[string]string{
+		server.URL + "/":             "",
+		server.URL + "/page?a=1&b=2": server.URL + "/page?utm_source=news&b=2&a=1",
+		server.URL + "/other":        server.URL + "/other?ref=home",
+	}, pages)
+	assert.Equal(t, map[string]string{
+		server.URL + "/":             "",
+		server.URL + "/page?a=1&b=2": "",
+		server.URL + "/other":        server.URL + "/other?ref=home",
+	}, fetchUrls)
+	assert.ElementsMatch(t, []string{"/", "/page?a=1&b=2", "/other?ref=home"}, requested)
+}
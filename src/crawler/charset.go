@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsetPrescanLen is the number of bytes searched for a <meta> charset
+// declaration, as browsers do.
+const charsetPrescanLen = 1024
+
+// fallbackCharset is assumed for bodies that don't declare a charset and
+// aren't valid UTF-8.
+const fallbackCharset = "windows-1252"
+
+// decodedContentTypes are the media types transcoded to UTF-8 before their
+// links are extracted. XML documents declare their own encoding.
+var decodedContentTypes = map[string]struct{}{
+	"text/html":             {},
+	"application/xhtml+xml": {},
+	"text/plain":            {},
+}
+
+// decodeBody returns the body transcoded to UTF-8 and the name of the charset
+// it was detected in, if the media type is decoded.
+func decodeBody(mediaType string, contentType string, body *bufio.Reader) (io.Reader, string) {
+	if _, ok := decodedContentTypes[mediaType]; !ok {
+		return body, ""
+	}
+
+	// a short body is returned along with an EOF error
+	start, _ := body.Peek(charsetPrescanLen)
+	name := detectCharset(contentType, start)
+	e, _ := charset.Lookup(name)
+
+	// a byte order mark overrides the detected charset and is dropped
+	return transform.NewReader(body, unicode.BOMOverride(e.NewDecoder())), name
+}
+
+// detectCharset returns the canonical name of the charset of a body from its
+// byte order mark, the charset of its Content-Type header or its <meta>
+// declaration, in that order of precedence.
+func detectCharset(contentType string, start []byte) string {
+	switch {
+	case bytes.HasPrefix(start, []byte{0xef, 0xbb, 0xbf}):
+		return "utf-8"
+	case bytes.HasPrefix(start, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	case bytes.HasPrefix(start, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if _, name := charset.Lookup(params["charset"]); name != "" {
+			return name
+		}
+	}
+
+	if _, name := charset.Lookup(metaCharset(start)); name != "" {
+		// a page can't be decoded as UTF-16 once its meta is read as ascii
+		if strings.HasPrefix(name, "utf-16") {
+			return "utf-8"
+		}
+		return name
+	}
+
+	// the prescanned bytes may end in the middle of a character
+	if utf8.Valid(start) || (len(start) == charsetPrescanLen && validUTF8Prefix(start)) {
+		return "utf-8"
+	}
+
+	return fallbackCharset
+}
+
+// metaCharset returns the charset label declared by the first <meta charset>
+// or <meta http-equiv="content-type"> element of the html, if any.
+func metaCharset(start []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(start))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.Data != "meta" {
+				continue
+			}
+
+			var label, httpEquiv, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "charset":
+					label = attr.Val
+				case "http-equiv":
+					httpEquiv = attr.Val
+				case "content":
+					content = attr.Val
+				}
+			}
+
+			if label != "" {
+				return label
+			}
+
+			if strings.EqualFold(httpEquiv, "content-type") {
+				if _, params, err := mime.ParseMediaType(content); err == nil && params["charset"] != "" {
+					return params["charset"]
+				}
+			}
+		}
+	}
+}
+
+// validUTF8Prefix reports whether the bytes are valid UTF-8 but for an
+// incomplete character at their end.
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && i < len(b); i++ {
+		if utf8.Valid(b[:len(b)-i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// newXMLDecoder returns a decoder of xml documents in the encoding they
+// declare, such as ISO-8859-1, which the xml package only reads in UTF-8.
+func newXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestDetectCharset(t *testing.T) {
+	t.Run("Test prefers byte order mark", func(t *testing.T) {
+		assert.Equal(t, "utf-8", detectCharset("text/html; charset=shift_jis", []byte("\xef\xbb\xbf<html>")))
+	})
+
+	t.Run("Test uses content type header", func(t *testing.T) {
+		assert.Equal(t, "shift_jis", detectCharset("text/html; charset=Shift_JIS", []byte(`<meta charset="utf-8">`)))
+	})
+
+	t.Run("Test uses meta charset", func(t *testing.T) {
+		assert.Equal(t, "iso-8859-2", detectCharset("text/html", []byte(`<head><meta charset="ISO-8859-2">`)))
+	})
+
+	t.Run("Test uses meta http-equiv content type", func(t *testing.T) {
+		content := `<meta http-equiv="Content-Type" content="text/html; charset=windows-1251">`
+		assert.Equal(t, "windows-1251", detectCharset("", []byte(content)))
+	})
+
+	t.Run("Test assumes utf-8 for valid utf-8", func(t *testing.T) {
+		assert.Equal(t, "utf-8", detectCharset("text/html", []byte("<p>caf\xc3\xa9</p>")))
+	})
+
+	t.Run("Test falls back to windows-1252", func(t *testing.T) {
+		assert.Equal(t, "windows-1252", detectCharset("text/html", []byte("<p>caf\xe9</p>")))
+	})
+}
+
+func TestDecodeBody(t *testing.T) {
+	t.Run("Test transcodes to utf-8", func(t *testing.T) {
+		encoded, err := japanese.ShiftJIS.NewEncoder().String(`<a href="/日本">日本</a>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, name := decodeBody("text/html", "text/html; charset=shift_jis", bufio.NewReader(strings.NewReader(encoded)))
+		body, err := io.ReadAll(decoded)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "shift_jis", name)
+		assert.Equal(t, `<a href="/日本">日本</a>`, string(body))
+	})
+
+	t.Run("Test drops byte order mark", func(t *testing.T) {
+		decoded, name := decodeBody("text/html", "", bufio.NewReader(strings.NewReader("\xef\xbb\xbf<p>")))
+		body, err := io.ReadAll(decoded)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "utf-8", name)
+		assert.Equal(t, "<p>", string(body))
+	})
+
+	t.Run("Test leaves xml undecoded", func(t *testing.T) {
+		encoded, err := charmap.ISO8859_1.NewEncoder().String(`<?xml version="1.0" encoding="ISO-8859-1"?><a>é</a>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, name := decodeBody("application/xml", "application/xml", bufio.NewReader(strings.NewReader(encoded)))
+		body, err := io.ReadAll(decoded)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", name)
+		assert.Equal(t, encoded, string(body))
+	})
+}
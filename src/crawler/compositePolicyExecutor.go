@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ExtractionRule reads links from an attribute of the nodes matched by a
+// policy. The language defaults to XPath and links are read from all resource
+// attributes of the nodes if no attribute is given.
+type ExtractionRule struct {
+	Language  PolicyLanguage `json:"language,omitempty"`
+	Policy    string         `json:"policy"`
+	Attribute string         `json:"attribute,omitempty"`
+}
+
+// DefaultExtractionRules extract links to pages and assets from every
+// element with a resource attribute and from meta refreshes.
+var DefaultExtractionRules = []ExtractionRule{
+	{Language: XPathPolicyLanguage, Policy: "//*[@href or @src or @srcset or @data-src or @poster or @action or @style]"},
+	{Language: XPathPolicyLanguage, Policy: "//meta[@http-equiv and @content]"},
+}
+
+// DefaultSchemes are the schemes followed when filters don't specify any.
+var DefaultSchemes = []string{"http", "https"}
+
+// CompositePolicyExecutor combines the links extracted by several rules from
+// a single parse of the document and filters them once they are resolved.
+type CompositePolicyExecutor struct {
+	Rules   []ExtractionRule
+	Filters URLFilters
+
+	extractors []nodeExtractor
+	include    []urlMatcher
+	exclude    []urlMatcher
+	schemes    map[string]struct{}
+}
+
+func (pe *CompositePolicyExecutor) Execute(rc io.ReadCloser) (Document, error) {
+
+	defer rc.Close()
+	doc, err := html.Parse(rc)
+
+	if err != nil {
+		return Document{}, err
+	}
+
+	var links []Link
+	for _, e := range pe.extractors {
+		links = append(links, e.extract(doc)...)
+	}
+	return newDocument(doc, links), nil
+}
+
+// Allow reports whether a resolved link passes the scheme, exclude and
+// include filters.
+func (pe *CompositePolicyExecutor) Allow(link *url.URL) bool {
+	if len(pe.schemes) > 0 {
+		if _, ok := pe.schemes[strings.ToLower(link.Scheme)]; !ok {
+			return false
+		}
+	}
+
+	if matchesAny(pe.exclude, link) {
+		return false
+	}
+
+	return len(pe.include) == 0 || matchesAny(pe.include, link)
+}
+
+func NewCompositePolicyExecutor(rules []ExtractionRule, filters URLFilters) (*CompositePolicyExecutor, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("at least one extraction rule is required")
+	}
+
+	pe := &CompositePolicyExecutor{
+		Rules:   rules,
+		Filters: filters,
+		schemes: make(map[string]struct{}),
+	}
+
+	for _, rule := range rules {
+		language := rule.Language
+		if language == "" {
+			language = XPathPolicyLanguage
+		}
+
+		executer, err := NewPolicyExecuterForLanguage(language, rule.Policy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch e := executer.(type) {
+		case *XPathPolicyExecutor:
+			e.Attribute = rule.Attribute
+			pe.extractors = append(pe.extractors, e)
+		case *CSSSelectorPolicyExecutor:
+			e.Attribute = rule.Attribute
+			pe.extractors = append(pe.extractors, e)
+		}
+	}
+
+	var err error
+	if pe.include, err = compileURLFilters(filters.Include); err != nil {
+		return nil, err
+	}
+
+	if pe.exclude, err = compileURLFilters(filters.Exclude); err != nil {
+		return nil, err
+	}
+
+	for _, scheme := range filters.Schemes {
+		pe.schemes[strings.ToLower(scheme)] = struct{}{}
+	}
+
+	return pe, nil
+}
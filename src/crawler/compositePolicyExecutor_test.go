@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CompositePolicyExecutorTest struct {
+	policyExecutor *CompositePolicyExecutor
+}
+
+func TestCompositePolicyExecutor(t *testing.T) {
+	cpe, err := NewCompositePolicyExecutor(
+		append(DefaultExtractionRules, ExtractionRule{Language: CSSPolicyLanguage, Policy: "img[data-href]", Attribute: "data-href"}),
+		URLFilters{
+			Include: []URLFilter{{Type: PrefixURLFilter, Pattern: "/docs/"}, {Type: GlobURLFilter, Pattern: "https://*.example.com/blog/*"}},
+			Exclude: []URLFilter{{Type: RegexURLFilter, Pattern: `\.pdf$`}},
+			Schemes: []string{"https"},
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpet := CompositePolicyExecutorTest{
+		policyExecutor: cpe,
+	}
+
+	t.Run("Test extracts links for every rule", cpet.testExtractsLinksForEveryRule)
+	t.Run("Test allows links passing filters", cpet.testAllowsLinksPassingFilters)
+	t.Run("Test returns error on invalid rule or filter", cpet.testReturnsErrorOnInvalidRuleOrFilter)
+}
+
+func (cpet *CompositePolicyExecutorTest) testExtractsLinksForEveryRule(t *testing.T) {
+	htmlContent := `<html>
+		<head><link rel='next' href='/page/2'><link rel='stylesheet' href='/style.css'></head>
+		<body>
+			<a href='/search?q=http'>search</a>
+			<map><area href='/area'></map>
+			<iframe src='/frame'></iframe>
+			<img data-href='/image'>
+		</body>
+	</html>`
+	reader := io.NopCloser(strings.NewReader(htmlContent))
+	result, err := cpet.policyExecutor.Execute(reader)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Link{
+		{Url: "/page/2", Kind: NavigationLink, Rel: []string{"next"}},
+		{Url: "/style.css", Kind: StylesheetLink, Rel: []string{"stylesheet"}},
+		{Url: "/search?q=http", Kind: NavigationLink},
+		{Url: "/area", Kind: NavigationLink},
+		{Url: "/frame", Kind: NavigationLink},
+		{Url: "/image", Kind: NavigationLink},
+	}, result.Links)
+}
+
+func (cpet *CompositePolicyExecutorTest) testAllowsLinksPassingFilters(t *testing.T) {
+	cases := map[string]bool{
+		"https://example.com/docs/intro":        true,
+		"https://www.example.com/blog/post":     true,
+		"https://example.com/docs/manual.pdf":   false,
+		"http://example.com/docs/intro":         false,
+		"https://example.com/about":             false,
+		"https://www.example.com/blog/post.pdf": false,
+	}
+
+	for link, expected := range cases {
+		u, err := url.Parse(link)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, expected, cpet.policyExecutor.Allow(u), link)
+	}
+}
+
+func (cpet *CompositePolicyExecutorTest) testReturnsErrorOnInvalidRuleOrFilter(t *testing.T) {
+	_, err := NewCompositePolicyExecutor(nil, URLFilters{})
+	assert.NotNil(t, err)
+
+	_, err = NewCompositePolicyExecutor([]ExtractionRule{{Policy: "//a[@href"}}, URLFilters{})
+	assert.NotNil(t, err)
+
+	_, err = NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{
+		Exclude: []URLFilter{{Type: RegexURLFilter, Pattern: "("}},
+	})
+	assert.NotNil(t, err)
+
+	_, err = NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{
+		Include: []URLFilter{{Type: "wildcard", Pattern: "*"}},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sniffLen is the number of bytes used to detect the content type of
+// responses without a Content-Type header.
+const sniffLen = 512
+
+// ContentExtractors maps media types to the policy executers extracting the
+// documents of response bodies of that type. Responses of other types are
+// recorded without their body being read.
+type ContentExtractors map[string]CrawlPolicyExecuter
+
+// DefaultContentExtractors returns extractors for html pages using the given
+// policy executer, for sitemaps, RSS and Atom feeds and for plain text url
+// lists.
+func DefaultContentExtractors(html CrawlPolicyExecuter) ContentExtractors {
+	return ContentExtractors{
+		"text/html":             html,
+		"application/xhtml+xml": html,
+		"application/xml":       xmlExtractor{},
+		"text/xml":              xmlExtractor{},
+		"application/rss+xml":   feedExtractor{},
+		"application/atom+xml":  feedExtractor{},
+		"text/plain":            urlListExtractor{},
+	}
+}
+
+// Extractor returns the extractor for the media type, if any.
+func (ce ContentExtractors) Extractor(mediaType string) (CrawlPolicyExecuter, bool) {
+	extractor, ok := ce[mediaType]
+	return extractor, ok
+}
+
+// headerContentType returns the media type declared by a response, or an
+// empty string if it doesn't declare a valid one.
+func headerContentType(header http.Header) string {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediaType)
+}
+
+// sniffContentType returns the media type detected from the start of a body.
+func sniffContentType(body *bufio.Reader) string {
+	// a short body is returned along with an EOF error
+	start, _ := body.Peek(sniffLen)
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(start))
+	return mediaType
+}
+
+// xmlExtractor extracts the links of sitemaps and feeds served as generic
+// xml, and no links from other xml documents.
+type xmlExtractor struct{}
+
+func (xe xmlExtractor) Execute(rc io.ReadCloser) (Document, error) {
+	body, err := io.ReadAll(io.LimitReader(rc, MaxSitemapSize))
+
+	if err != nil {
+		return Document{}, err
+	}
+
+	switch xmlRootElement(body) {
+	case "urlset", "sitemapindex":
+		return sitemapExtractor{}.Execute(io.NopCloser(bytes.NewReader(body)))
+	case "rss", "feed", "RDF":
+		return feedExtractor{}.Execute(io.NopCloser(bytes.NewReader(body)))
+	default:
+		return Document{}, nil
+	}
+}
+
+// xmlRootElement returns the local name of the root element of an xml
+// document or an empty string if it has none.
+func xmlRootElement(body []byte) string {
+	decoder := newXMLDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// sitemapExtractor extracts the pages and child sitemaps listed in a sitemap.
+type sitemapExtractor struct{}
+
+func (se sitemapExtractor) Execute(rc io.ReadCloser) (Document, error) {
+	urls, sitemaps, err := ParseSitemap(rc)
+
+	if err != nil {
+		return Document{}, err
+	}
+
+	var links []Link
+	for _, u := range append(urls, sitemaps...) {
+		links = append(links, Link{Url: u, Kind: NavigationLink})
+	}
+
+	return Document{Links: links}, nil
+}
+
+// feedExtractor extracts the links of RSS and Atom feeds, which are the text
+// of RSS <link> elements, the href of Atom <link> elements and the url of
+// enclosures.
+type feedExtractor struct{}
+
+func (fe feedExtractor) Execute(rc io.ReadCloser) (Document, error) {
+	decoder := newXMLDecoder(io.LimitReader(rc, MaxSitemapSize))
+	decoder.Strict = false
+
+	var links []Link
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return Document{}, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "link":
+			if href := xmlAttr(start, "href"); href != "" {
+				links = append(links, Link{Url: href, Kind: NavigationLink, Rel: parseRel(xmlAttr(start, "rel"))})
+				continue
+			}
+
+			var text string
+			if err := decoder.DecodeElement(&text, &start); err != nil {
+				return Document{}, err
+			}
+			if text = strings.TrimSpace(text); text != "" {
+				links = append(links, Link{Url: text, Kind: NavigationLink})
+			}
+		case "enclosure":
+			if u := xmlAttr(start, "url"); u != "" {
+				links = append(links, Link{Url: u, Kind: MediaLink})
+			}
+		}
+	}
+
+	return Document{Links: links}, nil
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// urlListExtractor extracts the links of a plain text list of urls, one per
+// line. Lines that aren't absolute urls, such as comments, are skipped.
+type urlListExtractor struct{}
+
+func (ule urlListExtractor) Execute(rc io.ReadCloser) (Document, error) {
+	var links []Link
+	scanner := bufio.NewScanner(io.LimitReader(rc, MaxSitemapSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if u, err := url.Parse(line); err != nil || !u.IsAbs() || u.Host == "" {
+			continue
+		}
+		links = append(links, Link{Url: line, Kind: NavigationLink})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Document{}, err
+	}
+
+	return Document{Links: links}, nil
+}
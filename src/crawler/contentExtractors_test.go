@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentType(t *testing.T) {
+	t.Run("Test uses content type header", func(t *testing.T) {
+		header := http.Header{"Content-Type": {"Text/HTML; charset=ISO-8859-1"}}
+
+		assert.Equal(t, "text/html", headerContentType(header))
+	})
+
+	t.Run("Test returns empty content type without header", func(t *testing.T) {
+		assert.Equal(t, "", headerContentType(http.Header{}))
+	})
+
+	t.Run("Test sniffs content type", func(t *testing.T) {
+		body := bufio.NewReader(strings.NewReader("%PDF-1.4"))
+
+		assert.Equal(t, "application/pdf", sniffContentType(body))
+	})
+}
+
+func TestContentExtractors(t *testing.T) {
+	extractors := DefaultContentExtractors(NewPolicyExecutor("//a"))
+
+	t.Run("Test has no extractor for unknown types", func(t *testing.T) {
+		_, ok := extractors.Extractor("image/png")
+
+		assert.False(t, ok)
+	})
+
+	t.Run("Test extracts sitemap urls from xml", func(t *testing.T) {
+		doc := extract(t, extractors, "text/xml", `<?xml version="1.0"?>
+			<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>https://example.com/a</loc></url>
+			</urlset>`)
+
+		assert.Equal(t, []Link{{Url: "https://example.com/a", Kind: NavigationLink}}, doc.Links)
+	})
+
+	t.Run("Test extracts rss links", func(t *testing.T) {
+		doc := extract(t, extractors, "application/rss+xml", `<rss version="2.0"><channel>
+				<link>https://example.com/</link>
+				<item>
+					<link> https://example.com/post </link>
+					<enclosure url="https://example.com/post.mp3" type="audio/mpeg"/>
+				</item>
+			</channel></rss>`)
+
+		assert.Equal(t, []Link{
+			{Url: "https://example.com/", Kind: NavigationLink},
+			{Url: "https://example.com/post", Kind: NavigationLink},
+			{Url: "https://example.com/post.mp3", Kind: MediaLink},
+		}, doc.Links)
+	})
+
+	t.Run("Test extracts atom links from xml", func(t *testing.T) {
+		doc := extract(t, extractors, "application/xml", `<feed xmlns="http://www.w3.org/2005/Atom">
+				<link rel="self" href="/feed.xml"/>
+				<entry><link href="/post"/></entry>
+			</feed>`)
+
+		assert.Equal(t, []Link{
+			{Url: "/feed.xml", Kind: NavigationLink, Rel: []string{"self"}},
+			{Url: "/post", Kind: NavigationLink},
+		}, doc.Links)
+	})
+
+	t.Run("Test extracts feed links in declared encoding", func(t *testing.T) {
+		doc := extract(t, extractors, "application/rss+xml", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>"+
+			"<rss version=\"2.0\"><channel><link>https://example.com/caf\xe9</link></channel></rss>")
+
+		assert.Equal(t, []Link{{Url: "https://example.com/café", Kind: NavigationLink}}, doc.Links)
+	})
+
+	t.Run("Test extracts no links from other xml", func(t *testing.T) {
+		doc := extract(t, extractors, "application/xml", `<svg><a href="/a"/></svg>`)
+
+		assert.Empty(t, doc.Links)
+	})
+
+	t.Run("Test extracts absolute urls from text", func(t *testing.T) {
+		doc := extract(t, extractors, "text/plain", "# pages\nhttps://example.com/a\n\nnot a url\n  https://example.com/b  \n")
+
+		assert.Equal(t, []Link{
+			{Url: "https://example.com/a", Kind: NavigationLink},
+			{Url: "https://example.com/b", Kind: NavigationLink},
+		}, doc.Links)
+	})
+}
+
+func extract(t *testing.T, extractors ContentExtractors, mediaType string, body string) Document {
+	extractor, ok := extractors.Extractor(mediaType)
+	if !ok {
+		t.Fatalf("no extractor for %s", mediaType)
+	}
+
+	doc, err := extractor.Execute(io.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
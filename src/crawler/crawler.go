@@ -2,12 +2,139 @@ package crawler
 
 //go:generate mockgen -destination=../mocks/mock_crawler.go -package=mocks github.com/alicansa/go-linkcrawler/crawler CrawlPolicyExecuter,WebCrawler
 
-import "io"
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/warc"
+)
 
 type CrawlPolicyExecuter interface {
-	Execute(rc io.ReadCloser) ([]string, error)
+	Execute(rc io.ReadCloser) (Document, error)
+}
+
+// LinkFilter is implemented by policy executers that filter links once they
+// have been resolved against the page they were found on.
+type LinkFilter interface {
+	Allow(link *url.URL) bool
+}
+
+// CrawledPage describes a fetched page and the in scope links found on it.
+// Its external links are only reported as discovered.
+type CrawledPage struct {
+	Url string
+	// OriginalUrl is the url the page was found at, if canonicalization
+	// rewrote it.
+	OriginalUrl string
+	// FetchUrl is the url the page was fetched at, if it differs from its
+	// url.
+	FetchUrl string
+	// Seed is the seed of the crawl the page was first reached from.
+	Seed       string
+	StatusCode int
+	Links      []Link
+	// ExternalLinks are the links out of scope found on the page.
+	ExternalLinks []Link
+	// Canonical is the resolved canonical url declared by the page, if any.
+	Canonical string
+	NoIndex   bool
+	NoFollow  bool
+	// ContentType is the media type of the response, without parameters.
+	ContentType string
+	// LastModified is the Last-Modified time of the response, or the zero
+	// time if it doesn't have a valid one.
+	LastModified time.Time
+	// ETag is the entity tag of the response, if any.
+	ETag string
+	// ContentHash is the hex encoded SHA-256 of the decoded body with its
+	// whitespace collapsed, for parsed pages.
+	ContentHash string
+	// SimHash is the SimHash of the visible text of html pages, 0 if they
+	// have none. Near duplicate pages have hashes differing by few bits.
+	SimHash uint64
+	// NotModified is set if the page wasn't modified since the previous
+	// crawl, in which case it's reported as previously crawled.
+	NotModified bool
+	// Charset is the charset the body was decoded from, for the content
+	// types decoded before their links are extracted.
+	Charset string
+	// Parsed is set if links were extracted from the body, which is only
+	// the case for ok responses of a content type with an extractor.
+	Parsed bool
+	// SizeLimit tells whether the body was truncated or not read because
+	// of its size.
+	SizeLimit SizeLimit
+	// FetchError is the reason the page wasn't fetched, such as its address
+	// being blocked or its host being unreachable, in which case it has no
+	// status code, or its body being cut off or corrupt.
+	FetchError string
+	// ParseError is the reason the body couldn't be parsed, such as a feed
+	// that isn't well formed, in which case it has no links.
+	ParseError string
+	// Header is the header of the response, kept if the crawl snapshots
+	// its pages.
+	Header http.Header
+	// SnapshotKey is the key of the body of the page in the snapshot store,
+	// if the body was read and stored.
+	SnapshotKey string
+	// Timings break down the time the fetch of the page took, if it was
+	// fetched.
+	Timings *Timings
+	// warcRecordId is the id of the WARC response record of the page, if
+	// the crawl is archived.
+	warcRecordId string
+}
+
+// CrawlOptions configure how a crawler follows links.
+type CrawlOptions struct {
+	// SkipNoFollow skips links with rel=nofollow and all links of pages
+	// with a nofollow robots directive.
+	SkipNoFollow bool
+	// UseSitemaps seeds the crawl with the urls of the sitemaps listed in
+	// robots.txt or found at /sitemap.xml.
+	UseSitemaps bool
+	// MaxBodySize is the maximum decompressed size of a response body in
+	// bytes, DefaultMaxBodySize if not set.
+	MaxBodySize int64
+	// MaxParseSize is the maximum size of the decoded body links are
+	// extracted from in bytes, DefaultMaxParseSize if not set.
+	MaxParseSize int64
+	// Fetch configures the http client of the crawler, on top of the
+	// config of the server creating it.
+	Fetch FetchConfig
+	// Auth configures how the crawler authenticates to the crawled site.
+	Auth AuthConfig
+	// Scope configures the links followed by the crawler.
+	Scope ScopeConfig
+	// ListMode fetches each seed once without following or reporting the
+	// links found on them, to check a list of urls.
+	ListMode bool
+	// Traps configures the detection of the links the crawler doesn't
+	// follow as they lead into crawler traps.
+	Traps TrapConfig
+	// Canonicalization configures the rules rewriting links before they're
+	// deduplicated.
+	Canonicalization CanonicalizationConfig
+	// History is the previous crawl of the site, if any. Its pages are
+	// requested conditionally so that unchanged pages aren't downloaded.
+	History PageHistory
+	// Snapshots stores the bodies read by the crawler as they were
+	// received, decompressed, if set.
+	Snapshots blobstore.BlobStore
+	// Warc archives the requests and responses of the crawl, along with
+	// the links found on the pages, if set. The bodies of all responses are
+	// read, up to the maximum body size.
+	Warc *warc.Writer
 }
 
 type WebCrawler interface {
-	Crawl(url string, onLinksDiscovered func(links []string) error) (map[string]struct{}, error)
+	Crawl(
+		seeds []string,
+		onLinksDiscovered func(links []Link) error,
+		onPageCrawled func(page CrawledPage) error) (map[string]struct{}, error)
+	// Traps returns the crawler traps found by the last crawl.
+	Traps() []Trap
 }
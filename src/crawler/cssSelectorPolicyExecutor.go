@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"io"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+type CSSSelectorPolicyExecutor struct {
+	Policy string
+	// Attribute holds the link of the matched nodes, if it isn't set links
+	// are read from all resource attributes.
+	Attribute string
+	selector  cascadia.Selector
+}
+
+func (pe *CSSSelectorPolicyExecutor) Execute(rc io.ReadCloser) (Document, error) {
+
+	defer rc.Close()
+	doc, err := html.Parse(rc)
+
+	if err != nil {
+		return Document{}, err
+	}
+
+	return newDocument(doc, pe.extract(doc)), nil
+}
+
+func (pe *CSSSelectorPolicyExecutor) extract(doc *html.Node) []Link {
+	var output []Link
+	nodes := cascadia.QueryAll(doc, pe.selector)
+	for _, node := range nodes {
+		output = append(output, extractLinks(node, pe.Attribute)...)
+	}
+	return output
+}
+
+func NewCSSSelectorPolicyExecutor(policy string) (*CSSSelectorPolicyExecutor, error) {
+	selector, err := cascadia.Compile(policy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CSSSelectorPolicyExecutor{
+		Policy:   policy,
+		selector: selector,
+	}, nil
+}
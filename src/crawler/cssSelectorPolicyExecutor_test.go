@@ -0,0 +1,59 @@
+package crawler
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CSSSelectorPolicyExecutorTest struct {
+	policyExecutor *CSSSelectorPolicyExecutor
+}
+
+func TestCSSSelectorPolicyExecutor(t *testing.T) {
+	cpe, err := NewCSSSelectorPolicyExecutor(`a[href]:not([href*="http"]):not([href^="mailto:"]):not([href^="tel:"])`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpet := CSSSelectorPolicyExecutorTest{
+		policyExecutor: cpe,
+	}
+
+	t.Run("Test find nodes with policy and returns href values", cpet.testFindNodesWithPolicyAndReturnsHrefValues)
+	t.Run("Test returns error on invalid selector", cpet.testReturnsErrorOnInvalidSelector)
+}
+
+func (cpet *CSSSelectorPolicyExecutorTest) testFindNodesWithPolicyAndReturnsHrefValues(t *testing.T) {
+	htmlContent := `<html>
+		<div>
+			<a href='test'>test</a>
+			<a href='http://external.com'>external</a>
+			<a href='mailto:test@test.com'>mail</a>
+			<div>
+				<a href='test2'>some link</a>
+			</div>
+		</div>
+	</html>`
+	reader := strings.NewReader(htmlContent)
+	readerCloser := io.NopCloser(reader)
+	result, err := cpet.policyExecutor.Execute(readerCloser)
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Links, 2)
+
+	expectedList := []Link{
+		{Url: "test", Kind: NavigationLink},
+		{Url: "test2", Kind: NavigationLink},
+	}
+	assert.Equal(t, expectedList, result.Links)
+}
+
+func (cpet *CSSSelectorPolicyExecutorTest) testReturnsErrorOnInvalidSelector(t *testing.T) {
+	_, err := NewCSSSelectorPolicyExecutor("a[href")
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Document is the result of executing a policy on a page: the links found on
+// it and the context needed to resolve and follow them.
+type Document struct {
+	// BaseUrl is the href of the <base> element of the page, if any.
+	BaseUrl string
+	// Canonical is the href of the <link rel=canonical> element, if any.
+	Canonical string
+	Robots    RobotsDirectives
+	Links     []Link
+	// SimHash is the SimHash of the visible text of the page, 0 if it has
+	// no text.
+	SimHash uint64
+}
+
+// RobotsDirectives are the directives of the <meta name=robots> elements.
+type RobotsDirectives struct {
+	NoIndex  bool
+	NoFollow bool
+}
+
+// newDocument reads the document context from the parsed page.
+func newDocument(doc *html.Node, links []Link) Document {
+	d := Document{
+		Links: links,
+	}
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "base":
+				// only the first base element with an href is used
+				if href, ok := lookupAttr(node, "href"); ok && d.BaseUrl == "" {
+					d.BaseUrl = strings.TrimSpace(href)
+				}
+			case "link":
+				if hasRel(parseRel(selectAttr(node, "rel")), "canonical") && d.Canonical == "" {
+					d.Canonical = strings.TrimSpace(selectAttr(node, "href"))
+				}
+			case "meta":
+				if strings.EqualFold(selectAttr(node, "name"), "robots") {
+					d.Robots.add(selectAttr(node, "content"))
+				}
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	d.SimHash = SimHash(visibleText(doc))
+	return d
+}
+
+// add merges the comma separated directives of a robots meta element.
+func (r *RobotsDirectives) add(content string) {
+	for _, directive := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			r.NoIndex = true
+		case "nofollow":
+			r.NoFollow = true
+		case "none":
+			r.NoIndex = true
+			r.NoFollow = true
+		}
+	}
+}
+
+// parseRel returns the lower cased values of a rel attribute.
+func parseRel(rel string) []string {
+	values := strings.Fields(strings.ToLower(rel))
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+func hasRel(rel []string, value string) bool {
+	for _, r := range rel {
+		if r == value {
+			return true
+		}
+	}
+	return false
+}
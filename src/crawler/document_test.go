@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocument(t *testing.T) {
+	t.Run("Test reads base, canonical and robots directives", testReadsBaseCanonicalAndRobotsDirectives)
+	t.Run("Test none robots directive sets noindex and nofollow", testNoneRobotsDirectiveSetsNoIndexAndNoFollow)
+}
+
+func testReadsBaseCanonicalAndRobotsDirectives(t *testing.T) {
+	htmlContent := `<html>
+		<head>
+			<base target='_blank'>
+			<base href=' https://example.com/docs/ '>
+			<base href='/ignored/'>
+			<link rel='Canonical' href='https://example.com/docs/index.html'>
+			<meta name='ROBOTS' content='noindex'>
+			<meta name='robots' content='nofollow, noarchive'>
+		</head>
+	</html>`
+
+	doc, err := htmlquery.Parse(strings.NewReader(htmlContent))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDocument(doc, nil)
+
+	assert.Equal(t, "https://example.com/docs/", d.BaseUrl)
+	assert.Equal(t, "https://example.com/docs/index.html", d.Canonical)
+	assert.Equal(t, RobotsDirectives{NoIndex: true, NoFollow: true}, d.Robots)
+}
+
+func testNoneRobotsDirectiveSetsNoIndexAndNoFollow(t *testing.T) {
+	doc, err := htmlquery.Parse(strings.NewReader(`<meta name='robots' content='none'>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDocument(doc, nil)
+
+	assert.Equal(t, "", d.BaseUrl)
+	assert.Equal(t, RobotsDirectives{NoIndex: true, NoFollow: true}, d.Robots)
+}
@@ -0,0 +1,328 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// DefaultUserAgent identifies the crawler unless configured otherwise.
+const DefaultUserAgent = "go-linkcrawler/1.0 (+https://github.com/alicansa/go-linkcrawler)"
+
+// Duration is a time.Duration written in json as a string such as "10s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// FetchConfig configures the http client pages are fetched with. Zero fields
+// are left to the defaults of the http package, or of the config it is
+// merged into. Pages whose requests time out are recorded with a fetch error
+// rather than failing the crawl.
+type FetchConfig struct {
+	// ConnectTimeout limits establishing a tcp connection.
+	ConnectTimeout Duration `json:"connectTimeout,omitempty"`
+	// TLSHandshakeTimeout limits the tls handshake of a connection.
+	TLSHandshakeTimeout Duration `json:"tlsHandshakeTimeout,omitempty"`
+	// ResponseHeaderTimeout limits waiting for the response headers once
+	// the request is written.
+	ResponseHeaderTimeout Duration `json:"responseHeaderTimeout,omitempty"`
+	// Timeout limits a request overall, including reading the body.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	UserAgent string `json:"userAgent,omitempty"`
+	// Headers are added to every request.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Cookies are sent with every request, by name.
+	Cookies map[string]string `json:"cookies,omitempty"`
+
+	// Proxy is the url of an http, https or socks5 proxy.
+	Proxy string `json:"proxy,omitempty"`
+	// CABundle holds PEM encoded certificates trusted along with the system
+	// ones.
+	CABundle           string `json:"caBundle,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+}
+
+// DefaultFetchConfig returns the config used unless the server or a job
+// configures otherwise.
+func DefaultFetchConfig() FetchConfig {
+	return FetchConfig{
+		ConnectTimeout:        Duration(10 * time.Second),
+		TLSHandshakeTimeout:   Duration(10 * time.Second),
+		ResponseHeaderTimeout: Duration(30 * time.Second),
+		Timeout:               Duration(60 * time.Second),
+		UserAgent:             DefaultUserAgent,
+		MaxIdleConnsPerHost:   MaxNumberOfCrawlers,
+	}
+}
+
+// Merge returns the config with the fields set in the override replacing
+// its own. Headers and cookies are merged by name.
+func (fc FetchConfig) Merge(override FetchConfig) FetchConfig {
+	merged := fc
+
+	if override.ConnectTimeout != 0 {
+		merged.ConnectTimeout = override.ConnectTimeout
+	}
+	if override.TLSHandshakeTimeout != 0 {
+		merged.TLSHandshakeTimeout = override.TLSHandshakeTimeout
+	}
+	if override.ResponseHeaderTimeout != 0 {
+		merged.ResponseHeaderTimeout = override.ResponseHeaderTimeout
+	}
+	if override.Timeout != 0 {
+		merged.Timeout = override.Timeout
+	}
+	if override.UserAgent != "" {
+		merged.UserAgent = override.UserAgent
+	}
+	if override.Proxy != "" {
+		merged.Proxy = override.Proxy
+	}
+	if override.CABundle != "" {
+		merged.CABundle = override.CABundle
+	}
+	if override.InsecureSkipVerify {
+		merged.InsecureSkipVerify = true
+	}
+	if override.MaxIdleConnsPerHost != 0 {
+		merged.MaxIdleConnsPerHost = override.MaxIdleConnsPerHost
+	}
+
+	merged.Headers = mergeValues(fc.Headers, override.Headers)
+	merged.Cookies = mergeValues(fc.Cookies, override.Cookies)
+	return merged
+}
+
+func mergeValues(values map[string]string, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return values
+	}
+
+	merged := make(map[string]string, len(values)+len(override))
+	for k, v := range values {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Validate returns an error if a client can't be created from the config.
+func (fc FetchConfig) Validate() error {
+	_, err := fc.NewHTTPClient()
+	return err
+}
+
+// NewHTTPClient returns an http client configured by the config.
+func (fc FetchConfig) NewHTTPClient() (*http.Client, error) {
+	return fc.NewGuardedHTTPClient(nil)
+}
+
+// NewGuardedHTTPClient returns an http client configured by the config that
+// only connects to the addresses allowed by the guard, or to any address if
+// the guard is nil.
+func (fc FetchConfig) NewGuardedHTTPClient(guard *AddressGuard) (*http.Client, error) {
+	if fc.ConnectTimeout < 0 || fc.TLSHandshakeTimeout < 0 || fc.ResponseHeaderTimeout < 0 || fc.Timeout < 0 {
+		return nil, errors.New("timeouts must not be negative")
+	}
+
+	if fc.MaxIdleConnsPerHost < 0 {
+		return nil, errors.New("maxIdleConnsPerHost must not be negative")
+	}
+
+	var d dialer = &net.Dialer{
+		Timeout:   time.Duration(fc.ConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	if guard != nil {
+		d = guard.guardDialer(d.(*net.Dialer))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	transport.TLSHandshakeTimeout = time.Duration(fc.TLSHandshakeTimeout)
+	transport.ResponseHeaderTimeout = time.Duration(fc.ResponseHeaderTimeout)
+	transport.MaxIdleConnsPerHost = fc.MaxIdleConnsPerHost
+
+	tlsConfig, err := fc.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if fc.Proxy != "" {
+		if err := setProxy(transport, d, fc.Proxy); err != nil {
+			return nil, err
+		}
+	} else {
+		transport.Proxy = environmentProxy()
+	}
+
+	var base http.RoundTripper = transport
+	if guard != nil && (fc.Proxy != "" || transport.Proxy != nil) {
+		// the guarded dialer only sees the address of the proxy
+		base = &proxyGuardTransport{base: transport, guard: guard, proxy: transport.Proxy}
+	}
+
+	return &http.Client{
+		Transport: &headerTransport{
+			base:      base,
+			userAgent: fc.UserAgent,
+			headers:   fc.Headers,
+			cookies:   fc.Cookies,
+		},
+		Timeout: time.Duration(fc.Timeout),
+	}, nil
+}
+
+func (fc FetchConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: fc.InsecureSkipVerify,
+	}
+
+	if fc.CABundle == "" {
+		return config, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM([]byte(fc.CABundle)) {
+		return nil, errors.New("caBundle contains no PEM encoded certificates")
+	}
+
+	config.RootCAs = pool
+	return config, nil
+}
+
+// setProxy routes the connections of the transport through the proxy.
+func setProxy(transport *http.Transport, d dialer, proxyUrl string) error {
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return fmt.Errorf("invalid proxy: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		transport.Proxy = http.ProxyURL(u)
+		return nil
+	case "socks5", "socks5h":
+		socksDialer, err := proxy.FromURL(u, d)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+
+		contextDialer, ok := socksDialer.(proxy.ContextDialer)
+		if !ok {
+			return fmt.Errorf("invalid proxy %q", proxyUrl)
+		}
+
+		transport.Proxy = nil
+		transport.DialContext = contextDialer.DialContext
+		return nil
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// environmentProxy returns the proxies of the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables as they are set, whereas
+// http.ProxyFromEnvironment reads them once for the process.
+func environmentProxy() func(*http.Request) (*url.URL, error) {
+	proxyFunc := httpproxy.FromEnvironment().ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// proxyGuardTransport checks the addresses the hosts of requests sent
+// through a proxy resolve to, which the proxy connects to.
+type proxyGuardTransport struct {
+	base  http.RoundTripper
+	guard *AddressGuard
+	// proxy returns the proxy of a request, or nil if it's sent directly.
+	// Every request is proxied if it's nil, as through a socks proxy.
+	proxy func(*http.Request) (*url.URL, error)
+}
+
+func (pgt *proxyGuardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests sent directly are checked by the guarded dialer
+	if pgt.proxy != nil {
+		if proxyUrl, err := pgt.proxy(req); err == nil && proxyUrl == nil {
+			return pgt.base.RoundTrip(req)
+		}
+	}
+
+	if err := pgt.guard.CheckUrl(req.Context(), req.URL.String()); err != nil {
+		// a round tripper closes the body of the request even on errors
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return pgt.base.RoundTrip(req)
+}
+
+// headerTransport sets the user agent, headers and cookies of the config on
+// the requests it sends, unless the request sets them itself.
+type headerTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	headers   map[string]string
+	cookies   map[string]string
+}
+
+func (ht *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a round tripper must not modify the request it's given
+	req = req.Clone(req.Context())
+
+	if ht.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", ht.userAgent)
+	}
+
+	for name, value := range ht.headers {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	for name, value := range ht.cookies {
+		if _, err := req.Cookie(name); err == http.ErrNoCookie {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+	}
+
+	return ht.base.RoundTrip(req)
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchConfig(t *testing.T) {
+	t.Run("Test decodes durations", func(t *testing.T) {
+		var fc FetchConfig
+		err := json.Unmarshal([]byte(`{"timeout":"1m30s","connectTimeout":"500ms"}`), &fc)
+
+		assert.Nil(t, err)
+		assert.Equal(t, Duration(90*time.Second), fc.Timeout)
+		assert.Equal(t, Duration(500*time.Millisecond), fc.ConnectTimeout)
+	})
+
+	t.Run("Test returns error on invalid duration", func(t *testing.T) {
+		var fc FetchConfig
+		err := json.Unmarshal([]byte(`{"timeout":30}`), &fc)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test merges overrides", func(t *testing.T) {
+		base := FetchConfig{
+			Timeout:   Duration(time.Minute),
+			UserAgent: "base",
+			Headers:   map[string]string{"Accept-Language": "en", "X-Base": "1"},
+		}
+		merged := base.Merge(FetchConfig{
+			UserAgent: "job",
+			Headers:   map[string]string{"Accept-Language": "de"},
+		})
+
+		assert.Equal(t, FetchConfig{
+			Timeout:   Duration(time.Minute),
+			UserAgent: "job",
+			Headers:   map[string]string{"Accept-Language": "de", "X-Base": "1"},
+		}, merged)
+		assert.Equal(t, "en", base.Headers["Accept-Language"])
+	})
+
+	t.Run("Test sends user agent, headers and cookies", func(t *testing.T) {
+		var req *http.Request
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req = r
+		}))
+		defer server.Close()
+
+		client, err := FetchConfig{
+			UserAgent: "test-agent",
+			Headers:   map[string]string{"Accept-Language": "de"},
+			Cookies:   map[string]string{"session": "abc"},
+		}.NewHTTPClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Get(server.URL)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "test-agent", req.UserAgent())
+		assert.Equal(t, "de", req.Header.Get("Accept-Language"))
+		cookie, err := req.Cookie("session")
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", cookie.Value)
+	})
+
+	t.Run("Test sends requests through http proxy", func(t *testing.T) {
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.String()
+		}))
+		defer proxy.Close()
+
+		client, err := FetchConfig{Proxy: proxy.URL}.NewHTTPClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Get("http://example.invalid/page")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "http://example.invalid/page", proxied)
+	})
+
+	t.Run("Test returns error on unsupported proxy", func(t *testing.T) {
+		_, err := FetchConfig{Proxy: "ftp://proxy:21"}.NewHTTPClient()
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test trusts ca bundle", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		client, err := FetchConfig{}.NewHTTPClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Get(server.URL)
+		assert.NotNil(t, err)
+
+		client, err = FetchConfig{CABundle: string(bundle)}.NewHTTPClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Get(server.URL)
+		assert.Nil(t, err)
+
+		client, err = FetchConfig{InsecureSkipVerify: true}.NewHTTPClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Get(server.URL)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Test returns error on invalid ca bundle", func(t *testing.T) {
+		err := FetchConfig{CABundle: "not a certificate"}.Validate()
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test times out", func(t *testing.T) {
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer server.Close()
+		defer close(done)
+
+		client, err := FetchConfig{ResponseHeaderTimeout: Duration(50 * time.Millisecond)}.NewHTTPClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Get(server.URL)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/fnv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// simHashShingle is the number of consecutive words hashed together as a
+// feature of the SimHash of a text.
+const simHashShingle = 3
+
+// invisibleElements are the elements whose text isn't displayed.
+var invisibleElements = map[string]struct{}{
+	"head":     {},
+	"script":   {},
+	"style":    {},
+	"noscript": {},
+	"template": {},
+	"svg":      {},
+}
+
+// contentHasher hashes the body written to it with runs of whitespace
+// collapsed, so that bodies differing only by formatting have the same hash.
+type contentHasher struct {
+	hash  hash.Hash
+	space bool
+	empty bool
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{hash: sha256.New(), empty: true}
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	normalized := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch b {
+		case ' ', '\t', '\n', '\r', '\f', '\v':
+			h.space = true
+			continue
+		}
+
+		// leading and trailing whitespace is dropped
+		if h.space && !h.empty {
+			normalized = append(normalized, ' ')
+		}
+		h.space = false
+		h.empty = false
+		normalized = append(normalized, b)
+	}
+
+	h.hash.Write(normalized)
+	return len(p), nil
+}
+
+// Sum returns the hex encoded hash of the body, or an empty string if the
+// body was empty.
+func (h *contentHasher) Sum() string {
+	if h.empty {
+		return ""
+	}
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// visibleText returns the words of the text displayed by the document.
+func visibleText(doc *html.Node) []string {
+	var words []string
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.ElementNode:
+			if _, ok := invisibleElements[node.Data]; ok {
+				return
+			}
+		case html.TextNode:
+			words = append(words, strings.FieldsFunc(strings.ToLower(node.Data), func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+			})...)
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return words
+}
+
+// SimHash returns the 64 bit SimHash of the words, whose features are their
+// shingles. Similar texts have hashes differing by few bits. It returns 0 if
+// there are no words.
+func SimHash(words []string) uint64 {
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	h := fnv.New64a()
+	for i := 0; i+simHashShingle <= len(words) || i == 0; i++ {
+		end := i + simHashShingle
+		if end > len(words) {
+			end = len(words)
+		}
+
+		h.Reset()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		feature := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if feature&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var simHash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			simHash |= 1 << bit
+		}
+	}
+	return simHash
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"io"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+)
+
+func TestContentHasher(t *testing.T) {
+	hash := func(body string) string {
+		h := newContentHasher()
+		io.Copy(h, strings.NewReader(body))
+		return h.Sum()
+	}
+
+	assert.Equal(t, hash("<p>a b</p>"), hash("\n  <p>a\n\t b</p>  \n"))
+	assert.NotEqual(t, hash("<p>a b</p>"), hash("<p>ab</p>"))
+	assert.Equal(t, "", hash(" \n "))
+}
+
+func TestVisibleText(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><head><title>Title</title><style>p {}</style></head>
+		<body><h1>Hello, World</h1><script>var x = 1;</script><p>Second  paragraph</p></body></html>`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hello", "world", "second", "paragraph"}, visibleText(doc))
+}
+
+func TestSimHash(t *testing.T) {
+	words := func(text string) []string { return strings.Fields(text) }
+
+	article := "the quick brown fox jumps over the lazy dog while the cat watches from the warm windowsill of the old house on the hill"
+	edited := "the quick brown fox jumps over the lazy dog while the cat watches from the warm windowsill of the old barn on the hill"
+	other := "quarterly revenue grew in every region as the company expanded its product line and hired engineers across three offices"
+
+	distance := func(a, b string) int {
+		return bits.OnesCount64(SimHash(words(a)) ^ SimHash(words(b)))
+	}
+
+	assert.Equal(t, uint64(0), SimHash(nil))
+	assert.Equal(t, SimHash(words(article)), SimHash(words(article)))
+	assert.NotEqual(t, uint64(0), SimHash(words("short")))
+	assert.Less(t, distance(article, edited), distance(article, other))
+}
+
+func TestCrawlFingerprintsPages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><a href="/a">a</a><a href="/b">b</a></html>`))
+	})
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html> <p>Same content</p> </html>`))
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>\n  <p>Same   content</p>\n</html>\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	_, err := c.Crawl(
+		[]string{server.URL},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+	a, b, home := pages[server.URL+"/a"], pages[server.URL+"/b"], pages[server.URL+"/"]
+	assert.Len(t, a.ContentHash, 64)
+	assert.Equal(t, a.ContentHash, b.ContentHash)
+	assert.NotEqual(t, a.ContentHash, home.ContentHash)
+	assert.NotEqual(t, uint64(0), a.SimHash)
+	assert.Equal(t, a.SimHash, b.SimHash)
+}
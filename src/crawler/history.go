@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"net/http"
+)
+
+// PageHistory returns what a previous crawl of a site learned about its pages,
+// so that a recrawl only downloads the pages that changed since.
+type PageHistory interface {
+	// PreviousPage returns the page as previously crawled, with the links
+	// found on it as they were found, or false if it wasn't crawled.
+	PreviousPage(url string) (CrawledPage, bool, error)
+}
+
+// previousPage returns the previous crawl of the page if it can be requested
+// conditionally, which is the case for ok responses with validators.
+func (c *LinkCrawler) previousPage(url string) (*CrawledPage, error) {
+	if c.Options.History == nil {
+		return nil, nil
+	}
+
+	previous, ok, err := c.Options.History.PreviousPage(url)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if previous.StatusCode != http.StatusOK || (previous.ETag == "" && previous.LastModified.IsZero()) {
+		return nil, nil
+	}
+	return &previous, nil
+}
+
+// setConditionalHeaders makes the request conditional on the page having
+// changed since the previous crawl.
+func setConditionalHeaders(req *http.Request, previous *CrawledPage) {
+	if previous == nil {
+		return
+	}
+
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+
+	if !previous.LastModified.IsZero() {
+		req.Header.Set("If-Modified-Since", previous.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// unchangedPage returns the previous crawl of a page that wasn't modified,
+// along with the links previously found on it, updated with the validators
+// of the not modified response. Its snapshot, if it has one, is the body and
+// header of the previous response, as the not modified response has neither.
+func unchangedPage(link Link, previous CrawledPage, resp getLinksResult) (CrawledPage, []Link) {
+	page := previous
+	page.Url = link.Url
+	page.OriginalUrl = link.OriginalUrl
+	page.FetchUrl = link.FetchUrl
+	page.Seed = link.Seed
+	page.NotModified = true
+	page.Links = nil
+	page.ExternalLinks = nil
+	page.Header = previous.Header.Clone()
+	page.Timings = resp.timings
+	page.warcRecordId = resp.warcRecordId
+
+	if resp.etag != "" {
+		page.ETag = resp.etag
+		if page.Header != nil {
+			page.Header.Set("ETag", resp.etag)
+		}
+	}
+
+	if !resp.lastModified.IsZero() {
+		page.LastModified = resp.lastModified
+		if page.Header != nil {
+			page.Header.Set("Last-Modified", resp.lastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	links := append(append([]Link(nil), previous.Links...), previous.ExternalLinks...)
+	return page, links
+}
@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapHistory is a page history of the pages reported by a crawl.
+type mapHistory struct {
+	mx    sync.Mutex
+	pages map[string]CrawledPage
+}
+
+func (h *mapHistory) PreviousPage(url string) (CrawledPage, bool, error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	page, ok := h.pages[url]
+	return page, ok, nil
+}
+
+func (h *mapHistory) onPageCrawled(page CrawledPage) error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.pages[page.Url] = page
+	return nil
+}
+
+func TestRecrawlRequestsPagesConditionally(t *testing.T) {
+	lastModified := time.Date(2022, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	var mx sync.Mutex
+	requests := make(map[string]http.Header)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requests[r.URL.Path] = r.Header.Clone()
+		mx.Unlock()
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`<html><a href="/dated">dated</a><a href="https://external.com/">out</a></html>`))
+	})
+	mux.HandleFunc("/dated", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requests[r.URL.Path] = r.Header.Clone()
+		mx.Unlock()
+
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Write([]byte(`<html><a href="/">home</a></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	history := &mapHistory{pages: make(map[string]CrawledPage)}
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	_, err := c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, history.onPageCrawled)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", requests["/"].Get("If-None-Match"))
+	assert.Equal(t, `"v1"`, history.pages[server.URL+"/"].ETag)
+
+	var pages []CrawledPage
+	var reported []string
+	requests = make(map[string]http.Header)
+	c = NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{History: history})
+	_, err = c.Crawl(
+		[]string{server.URL},
+		func(links []Link) error {
+			mx.Lock()
+			defer mx.Unlock()
+			for _, link := range links {
+				reported = append(reported, link.Url)
+			}
+			return nil
+		},
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages = append(pages, page)
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, `"v1"`, requests["/"].Get("If-None-Match"))
+	assert.Equal(t, lastModified.Format(http.TimeFormat), requests["/dated"].Get("If-Modified-Since"))
+
+	// unchanged pages are reported as previously crawled and their links
+	// are followed again
+	assert.Len(t, pages, 2)
+	for _, page := range pages {
+		assert.True(t, page.NotModified, page.Url)
+		assert.Equal(t, http.StatusOK, page.StatusCode, page.Url)
+		assert.Equal(t, "text/html", page.ContentType, page.Url)
+	}
+	assert.ElementsMatch(t, []string{server.URL + "/dated", "https://external.com/", server.URL + "/"}, reported)
+}
+
+func TestRecrawlKeepsSnapshotsOfUnchangedPages(t *testing.T) {
+	content := []byte(`<html><p>unchanged</p></html>`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	store, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := &mapHistory{pages: make(map[string]CrawledPage)}
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{Snapshots: store})
+	_, err = c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, history.onPageCrawled)
+
+	assert.Nil(t, err)
+	assert.Equal(t, blobstore.Key(content), history.pages[server.URL+"/"].SnapshotKey)
+
+	var page CrawledPage
+	c = NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{Snapshots: store, History: history})
+	_, err = c.Crawl([]string{server.URL}, func(links []Link) error { return nil }, func(p CrawledPage) error {
+		page = p
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, page.NotModified)
+	assert.Equal(t, blobstore.Key(content), page.SnapshotKey)
+
+	// only the validators of the not modified response are taken
+	assert.Equal(t, `"v2"`, page.ETag)
+	assert.Equal(t, "text/html", page.Header.Get("Content-Type"))
+	assert.Equal(t, `"v2"`, page.Header.Get("ETag"))
+}
@@ -1,10 +1,18 @@
 package crawler
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -14,26 +22,70 @@ const (
 type LinkCrawler struct {
 	Client          *http.Client
 	discoveredLinks threadSafeHashSet
-	PolicyExecuter  CrawlPolicyExecuter
+	// unlinkedSitemapLinks are the sitemap links not yet found on a page
+	unlinkedSitemapLinks threadSafeHashSet
+	// externalLinks are the reported links out of scope
+	externalLinks threadSafeHashSet
+	scope         *scope
+	// seeds are the scoped seeds of the crawl
+	seeds map[string]struct{}
+	// traps detects the links leading into crawler traps
+	traps          *trapDetector
+	PolicyExecuter CrawlPolicyExecuter
+	// Extractors select the executer for the content type of a page
+	Extractors ContentExtractors
+	Options    CrawlOptions
+	// auth authenticates the requests of the client, if configured
+	auth *authenticator
 }
 
-func (c *LinkCrawler) Crawl(url string, onLinksDiscovered func(links []string) error) (map[string]struct{}, error) {
+// Crawl crawls the site from each of the seeds, which share the pages
+// visited and the scope of the crawl.
+func (c *LinkCrawler) Crawl(
+	seeds []string,
+	onLinksDiscovered func(links []Link) error,
+	onPageCrawled func(page CrawledPage) error) (map[string]struct{}, error) {
 
-	// create a new thread safe hashset for this crawl
-	c.discoveredLinks = threadSafeHashSet{
-		hashset: make(map[string]struct{}),
-		mx:      &sync.Mutex{},
+	// create new thread safe hashsets for this crawl
+	c.discoveredLinks = newThreadSafeHashSet()
+	c.unlinkedSitemapLinks = newThreadSafeHashSet()
+	c.externalLinks = newThreadSafeHashSet()
+	c.traps = newTrapDetector(c.Options.Traps)
+
+	links, err := c.startScope(seeds)
+
+	if err != nil {
+		return c.discoveredLinks.hashset, err
+	}
+
+	// credentials are scoped to the hosts of the seeds unless configured
+	if c.auth != nil {
+		seeds := make([]string, 0, len(links))
+		for _, link := range links {
+			seeds = append(seeds, link.fetchUrl())
+		}
+		if err := c.auth.start(seeds); err != nil {
+			return c.discoveredLinks.hashset, err
+		}
+	}
+
+	if c.Options.UseSitemaps && !c.Options.ListMode {
+		sitemapLinks, err := c.discoverSitemapLinks(links, onLinksDiscovered)
+
+		if err != nil {
+			return c.discoveredLinks.hashset, err
+		}
+
+		links = append(links, sitemapLinks...)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	links := []string{url}
-	err := c.crawlRecursive(
-		url,
-		"",
+	err = c.crawlRecursive(
 		links,
 		ctx,
 		cancel,
-		onLinksDiscovered)
+		onLinksDiscovered,
+		onPageCrawled)
 
 	if err != nil {
 		return c.discoveredLinks.hashset, err
@@ -42,13 +94,46 @@ func (c *LinkCrawler) Crawl(url string, onLinksDiscovered func(links []string) e
 	return c.discoveredLinks.hashset, nil
 }
 
+// Traps returns the crawler traps found by the last crawl, whose links
+// weren't followed.
+func (c *LinkCrawler) Traps() []Trap {
+	if c.traps == nil {
+		return nil
+	}
+	return c.traps.found()
+}
+
+// startScope sets the scope of the crawl from the seeds and returns the
+// links of the unique seeds rewritten as the scope and the canonicalization
+// rules rewrite links.
+func (c *LinkCrawler) startScope(rawUrls []string) ([]Link, error) {
+	scope, seeds, err := newSeedScope(rawUrls, c.Options.Scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	for _, seed := range seeds {
+		links = append(links, Link{Url: seed, Kind: NavigationLink})
+	}
+	links = c.Options.Canonicalization.canonicalLinks(links)
+
+	c.scope = scope
+	c.seeds = make(map[string]struct{}, len(links))
+	for i := range links {
+		links[i].Seed = links[i].Url
+		c.seeds[links[i].Url] = struct{}{}
+	}
+	return links, nil
+}
+
 func (c *LinkCrawler) crawlRecursive(
-	baseUrl string,
-	relativeUrl string,
-	links []string,
+	links []Link,
 	ctx context.Context,
 	cancel context.CancelFunc,
-	onLinksDiscovered func(links []string) error) error {
+	onLinksDiscovered func(links []Link) error,
+	onPageCrawled func(page CrawledPage) error) error {
 	// if there are no links to be crawled, just return
 	if len(links) == 0 {
 		return nil
@@ -61,17 +146,22 @@ func (c *LinkCrawler) crawlRecursive(
 	var wg sync.WaitGroup
 	wg.Add(len(links))
 
-	for _, l := range links {
-		// if link starts with # just continue
-		if len(l) == 0 || l[0] == '#' {
-			resultChan <- getLinksResult{}
-			wg.Done()
-			continue
+	// fail reports the first error of the workers and stops the others. The
+	// channels are only closed once the workers are done.
+	fail := func(err error) {
+		select {
+		case errChan <- err:
+		default:
 		}
+		cancel()
+		// release channel
+		<-workerChan
+	}
 
+	for _, l := range links {
 		//block if max number of crawlers already crawling
 		workerChan <- 1
-		go func(link string) {
+		go func(link Link) {
 			defer wg.Done()
 
 			select {
@@ -83,51 +173,93 @@ func (c *LinkCrawler) crawlRecursive(
 			default:
 			}
 
-			processedLink := processLink(link, relativeUrl, baseUrl)
-			resp, err := c.getLinks(baseUrl + processedLink)
-			resp.relativeUrl = processedLink
+			page, base, foundLinks, err := c.crawlPage(link)
 
 			if err != nil {
-				errChan <- err
-				cancel()
-				close(workerChan)
-				close(resultChan)
+				fail(err)
 				return
 			}
-			//if there are no links crawler hasn't visited, just return
-			if len(resp.links) == 0 {
-				resultChan <- resp
+
+			// resolve the links found on the page against its base url and
+			// set the out of scope ones apart
+			pageLinks, externalLinks := resolveLinks(base, c.scope, foundLinks, c.linkFilter())
+			pageLinks = c.traps.filter(c.Options.Canonicalization.canonicalLinks(pageLinks))
+			externalLinks = c.Options.Canonicalization.canonicalLinks(externalLinks)
+
+			page.Links = pageLinks
+			page.ExternalLinks = externalLinks
+
+			if c.Options.Warc != nil {
+				err = c.archiveOutlinks(page)
+			}
+
+			if err == nil {
+				err = onPageCrawled(page)
+			}
+
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			// the links of listed urls aren't followed
+			if c.Options.ListMode {
+				resultChan <- getLinksResult{}
 				// release channel
 				<-workerChan
 				return
 			}
 
 			//callback function for discovered links
-			var newLinks []string
-			for _, discoveredLink := range resp.links {
+			var newLinks []Link
+			var reportedLinks []Link
+			for _, externalLink := range externalLinks {
+				if c.externalLinks.Add(externalLink.Url) {
+					externalLink.Source = LinkedSource
+					externalLink.Seed = link.Seed
+					reportedLinks = append(reportedLinks, externalLink)
+				}
+			}
+
+			//if there are no links to report, just return
+			if len(pageLinks) == 0 && len(reportedLinks) == 0 {
+				resultChan <- getLinksResult{}
+				// release channel
+				<-workerChan
+				return
+			}
+
+			for _, discoveredLink := range pageLinks {
+				discoveredLink.Source = LinkedSource
+				discoveredLink.Seed = link.Seed
 
-				if !c.discoveredLinks.Add(discoveredLink) {
+				if !c.discoveredLinks.Add(discoveredLink.Url) {
+					// sitemap links are reported again the first time
+					// they are found on a page
+					if c.unlinkedSitemapLinks.Remove(discoveredLink.Url) {
+						reportedLinks = append(reportedLinks, discoveredLink)
+					}
 					continue
 				}
 
-				newLinks = append(newLinks, discoveredLink)
+				// the seeds are already crawled
+				if _, ok := c.seeds[discoveredLink.Url]; !ok {
+					newLinks = append(newLinks, discoveredLink)
+				}
+				reportedLinks = append(reportedLinks, discoveredLink)
 			}
 
-			err = onLinksDiscovered(newLinks)
+			err = onLinksDiscovered(reportedLinks)
 
 			if err != nil {
-				errChan <- err
-				cancel()
-				close(workerChan)
-				close(resultChan)
+				fail(err)
 				return
 			}
 			// release channel
 			<-workerChan
 			// return on results channel
 			resultChan <- getLinksResult{
-				links:       newLinks,
-				relativeUrl: processedLink,
+				links: newLinks,
 			}
 		}(l)
 	}
@@ -140,7 +272,7 @@ func (c *LinkCrawler) crawlRecursive(
 		return err
 	default:
 		for result := range resultChan {
-			err := c.crawlRecursive(baseUrl, result.relativeUrl, result.links, ctx, cancel, onLinksDiscovered)
+			err := c.crawlRecursive(followedLinks(result.links), ctx, cancel, onLinksDiscovered, onPageCrawled)
 
 			if err != nil {
 				return err
@@ -150,69 +282,519 @@ func (c *LinkCrawler) crawlRecursive(
 	return nil
 }
 
+// discoverSitemapLinks reports the in scope links listed in the sitemaps of
+// the sites of the seeds and returns the ones to crawl along with the seeds.
+// Links are reached from the first seed of the site of their sitemap.
+func (c *LinkCrawler) discoverSitemapLinks(
+	seeds []Link,
+	onLinksDiscovered func(links []Link) error) ([]Link, error) {
+
+	var reportedLinks []Link
+	var links []Link
+	sites := make(map[string]struct{})
+	for _, seedLink := range seeds {
+		seed := seedLink.Url
+		seedUrl, err := url.Parse(seedLink.fetchUrl())
+		if err != nil {
+			continue
+		}
+
+		site := seedUrl.Scheme + "://" + seedUrl.Host
+		if _, ok := sites[site]; ok {
+			continue
+		}
+		sites[site] = struct{}{}
+
+		var sitemapLinks []Link
+		for _, u := range FetchSitemapUrls(c.Client, DiscoverSitemaps(c.Client, seedLink.fetchUrl())) {
+			sitemapLinks = append(sitemapLinks, Link{
+				Url:    u,
+				Kind:   NavigationLink,
+				Source: SitemapSource,
+				Seed:   seed,
+			})
+		}
+
+		// sitemaps may list pages out of the scope, which aren't reported
+		inScopeLinks, _ := resolveLinks(seed, c.scope, sitemapLinks, c.linkFilter())
+		inScopeLinks = c.traps.filter(c.Options.Canonicalization.canonicalLinks(inScopeLinks))
+		for _, link := range inScopeLinks {
+			if !c.discoveredLinks.Add(link.Url) {
+				continue
+			}
+			c.unlinkedSitemapLinks.Add(link.Url)
+			reportedLinks = append(reportedLinks, link)
+
+			// the seeds are already crawled
+			if _, ok := c.seeds[link.Url]; !ok {
+				links = append(links, link)
+			}
+		}
+	}
+
+	if len(reportedLinks) == 0 {
+		return nil, nil
+	}
+
+	return links, onLinksDiscovered(reportedLinks)
+}
+
+// crawlPage fetches the page of the link and returns what was learned about
+// it, along with the url its links resolve against and the followable links
+// found on it. Pages not modified since the previous crawl are returned as
+// previously crawled, with the links previously found on them.
+func (c *LinkCrawler) crawlPage(link Link) (CrawledPage, string, []Link, error) {
+	previous, err := c.previousPage(link.Url)
+
+	if err != nil {
+		return CrawledPage{}, "", nil, err
+	}
+
+	resp, err := c.getLinks(link.fetchUrl(), previous)
+
+	if err != nil {
+		return CrawledPage{}, "", nil, err
+	}
+
+	if resp.statusCode == http.StatusNotModified && previous != nil {
+		page, links := unchangedPage(link, *previous, resp)
+		return page, link.fetchUrl(), links, nil
+	}
+
+	base := documentBaseUrl(link.fetchUrl(), resp.document)
+	return CrawledPage{
+		Url:          link.Url,
+		OriginalUrl:  link.OriginalUrl,
+		FetchUrl:     link.FetchUrl,
+		Seed:         link.Seed,
+		StatusCode:   resp.statusCode,
+		Canonical:    resolveUrl(base, resp.document.Canonical),
+		NoIndex:      resp.document.Robots.NoIndex,
+		NoFollow:     resp.document.Robots.NoFollow,
+		ContentType:  resp.contentType,
+		LastModified: resp.lastModified,
+		ETag:         resp.etag,
+		ContentHash:  resp.contentHash,
+		SimHash:      resp.document.SimHash,
+		Charset:      resp.charset,
+		Parsed:       resp.parsed,
+		SizeLimit:    resp.sizeLimit,
+		FetchError:   resp.fetchError,
+		ParseError:   resp.parseError,
+		Header:       resp.header,
+		SnapshotKey:  resp.snapshotKey,
+		Timings:      resp.timings,
+		warcRecordId: resp.warcRecordId,
+	}, base, c.followableLinks(resp.document), nil
+}
+
 type getLinksResult struct {
-	relativeUrl string
-	links       []string
+	statusCode   int
+	contentType  string
+	lastModified time.Time
+	etag         string
+	contentHash  string
+	charset      string
+	sizeLimit    SizeLimit
+	parsed       bool
+	fetchError   string
+	parseError   string
+	header       http.Header
+	snapshotKey  string
+	warcRecordId string
+	timings      *Timings
+	document     Document
+	links        []Link
 }
 
-func (c *LinkCrawler) getLinks(url string) (getLinksResult, error) {
+// getLinks fetches the url, conditionally on it having changed since the
+// previous crawl if there is one, and extracts its links.
+func (c *LinkCrawler) getLinks(url string, previous *CrawledPage) (getLinksResult, error) {
 
-	resp, err := c.Client.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return getLinksResult{}, err
+	if err != nil {
+		return getLinksResult{fetchError: err.Error()}, nil
+	}
+
+	trace := &fetchTrace{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	setConditionalHeaders(req, previous)
+	resp, err := c.Client.Do(req)
+
+	if err != nil {
+		return fetchFailure(err)
 	}
 
 	defer resp.Body.Close()
 
-	links, err := c.PolicyExecuter.Execute(resp.Body)
+	body := trace.body(resp.Body)
+	var recorder *recordingReader
+	if c.Options.Warc != nil {
+		recorder = &recordingReader{r: body}
+		body = recorder
+	}
+
+	result, err := c.readResponse(resp, body)
 
 	if err != nil {
 		return getLinksResult{}, err
 	}
 
+	if recorder != nil {
+		result.warcRecordId, err = c.archiveExchange(resp, recorder, result.sizeLimit == Oversized)
+
+		if err != nil {
+			return getLinksResult{}, err
+		}
+	}
+
+	result.timings = trace.done()
+	return result, nil
+}
+
+// fetchFailure returns the result of a page that couldn't be fetched. Pages
+// at blocked addresses, on unreachable hosts or that timed out are recorded
+// without failing the crawl, which only stops if it's canceled.
+func fetchFailure(err error) (getLinksResult, error) {
+	if errors.Is(err, context.Canceled) {
+		return getLinksResult{}, err
+	}
+
+	var blocked *BlockedAddressError
+	if errors.As(err, &blocked) {
+		return getLinksResult{fetchError: blocked.Error()}, nil
+	}
+	return getLinksResult{fetchError: err.Error()}, nil
+}
+
+// saveSnapshot reads the rest of the body, up to the maximum body size, and
+// stores the snapshot it was tee'd to, unless the body failed to be read.
+func (c *LinkCrawler) saveSnapshot(body io.Reader, snapshot *bytes.Buffer, readErr *readErrorRecorder) (string, error) {
+	io.Copy(io.Discard, body)
+	if readErr.err != nil {
+		return "", nil
+	}
+	return c.Options.Snapshots.Put(snapshot.Bytes())
+}
+
+// SnapshotHeader returns the header of a response to be stored with its
+// snapshot, without the headers that may hold the credentials of the crawl,
+// such as the session cookies set by the crawled site.
+func SnapshotHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range []string{"Set-Cookie", "Set-Cookie2", "Authentication-Info", "Proxy-Authentication-Info"} {
+		header.Del(name)
+	}
+	return header
+}
+
+// bodyReadFailure records the error reading or decompressing the body of the
+// page, if any, as the reason it wasn't fetched. The page keeps its status
+// code and content type, but not what was learned from the part of the body
+// that was read, nor its validators, so that a recrawl fetches it again.
+func bodyReadFailure(result getLinksResult, err error) getLinksResult {
+	if err == nil {
+		return result
+	}
+
 	return getLinksResult{
-		links: links,
-	}, nil
+		statusCode:  result.statusCode,
+		contentType: result.contentType,
+		fetchError:  err.Error(),
+	}
+}
+
+// readResponse reads what the crawler learns about a page from its response,
+// reading its body from the reader, and extracts its links.
+func (c *LinkCrawler) readResponse(resp *http.Response, respBody io.Reader) (getLinksResult, error) {
+
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	result := getLinksResult{
+		statusCode:   resp.StatusCode,
+		contentType:  headerContentType(resp.Header),
+		lastModified: lastModified,
+		etag:         resp.Header.Get("ETag"),
+	}
+
+	if c.Options.Snapshots != nil {
+		result.header = SnapshotHeader(resp.Header)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return result, nil
+	}
+
+	if resp.ContentLength > c.Options.maxBodySize() {
+		result.sizeLimit = Oversized
+		return result, nil
+	}
+
+	decompressed, err := decompressBody(resp.Header.Get("Content-Encoding"), respBody)
+
+	if err != nil {
+		return bodyReadFailure(result, fmt.Errorf("decompressing body: %w", err)), nil
+	}
+
+	readErr := &readErrorRecorder{r: decompressed}
+	bodyLimit := newLimitedReader(readErr, c.Options.maxBodySize())
+	var snapshot bytes.Buffer
+	var bodyReader io.Reader = bodyLimit
+	if c.Options.Snapshots != nil {
+		bodyReader = io.TeeReader(bodyLimit, &snapshot)
+	}
+	body := bufio.NewReaderSize(bodyReader, charsetPrescanLen)
+
+	if result.contentType == "" {
+		result.contentType = sniffContentType(body)
+	}
+
+	// the body of content types without an extractor, such as images, is
+	// only downloaded to be snapshotted
+	extractor, ok := c.Extractors.Extractor(result.contentType)
+	if !ok {
+		if c.Options.Snapshots != nil {
+			if result.snapshotKey, err = c.saveSnapshot(body, &snapshot, readErr); err != nil {
+				return getLinksResult{}, err
+			}
+			if bodyLimit.exceeded {
+				result.sizeLimit = Truncated
+			}
+		}
+		return bodyReadFailure(result, readErr.err), nil
+	}
+
+	decoded, charset := decodeBody(result.contentType, resp.Header.Get("Content-Type"), body)
+	parseLimit := newLimitedReader(decoded, c.Options.maxParseSize())
+	hasher := newContentHasher()
+	hashed := io.TeeReader(parseLimit, hasher)
+	document, err := extractor.Execute(io.NopCloser(hashed))
+	result.charset = charset
+
+	// extractors may stop reading before the end of the body
+	if err == nil {
+		io.Copy(io.Discard, hashed)
+	}
+
+	if bodyLimit.exceeded || parseLimit.exceeded {
+		result.sizeLimit = Truncated
+	}
+
+	if c.Options.Snapshots != nil {
+		key, snapshotErr := c.saveSnapshot(body, &snapshot, readErr)
+		if snapshotErr != nil {
+			return getLinksResult{}, snapshotErr
+		}
+		result.snapshotKey = key
+	}
+
+	if readErr.err != nil {
+		return bodyReadFailure(result, readErr.err), nil
+	}
+
+	if err != nil {
+		// a truncated body may not be well formed, and other bodies that
+		// can't be parsed are recorded without links rather than failing
+		// the crawl
+		if result.sizeLimit != Truncated {
+			result.parseError = err.Error()
+		}
+		return result, nil
+	}
+
+	result.parsed = true
+	result.document = document
+	result.contentHash = hasher.Sum()
+	return result, nil
+}
+
+// NormalizeUrl returns the absolute form of a url the crawler uses to
+// identify pages, without its fragment and with an explicit root path.
+func NormalizeUrl(rawUrl string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+
+	if err != nil {
+		return "", err
+	}
+
+	u.Fragment = ""
+	if u.Host != "" && u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.String(), nil
+}
+
+// linkFilter returns the policy executer as a link filter if it filters
+// resolved links.
+func (c *LinkCrawler) linkFilter() LinkFilter {
+	if f, ok := c.PolicyExecuter.(LinkFilter); ok {
+		return f
+	}
+	return nil
+}
+
+// followableLinks returns the links of the document, without the nofollow
+// ones if the crawler skips them.
+func (c *LinkCrawler) followableLinks(document Document) []Link {
+	if !c.Options.SkipNoFollow {
+		return document.Links
+	}
+
+	if document.Robots.NoFollow {
+		return nil
+	}
+
+	var links []Link
+	for _, link := range document.Links {
+		if hasRel(link.Rel, "nofollow") {
+			continue
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// documentBaseUrl returns the url relative links of the document resolve
+// against, which is the page url unless the document declares a base url.
+func documentBaseUrl(pageUrl string, document Document) string {
+	if document.BaseUrl == "" {
+		return pageUrl
+	}
+
+	if base := resolveUrl(pageUrl, document.BaseUrl); base != "" {
+		return base
+	}
+	return pageUrl
 }
 
-func processLink(
-	link string,
-	relativeUrl string,
-	baseUrl string) string {
+// resolveUrl resolves a reference against the base url and normalizes it,
+// returning an empty string if either can't be parsed.
+func resolveUrl(baseUrl string, ref string) string {
+	if ref == "" {
+		return ""
+	}
 
-	if link[0] == '#' {
-		return relativeUrl + link
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return ""
 	}
 
-	if link == baseUrl {
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
 		return ""
 	}
 
-	if strings.Contains(link, baseUrl) {
-		return link
+	normalized, err := NormalizeUrl(base.ResolveReference(r).String())
+	if err != nil {
+		return ""
 	}
+	return normalized
+}
 
-	httpEndIndex := strings.Index(baseUrl, "//")
-	if httpEndIndex >= 0 && strings.Contains(link, baseUrl[0:httpEndIndex+2]) {
-		var startIndex = strings.Index(link, "/")
-		return link[0:startIndex]
+// followedLinks returns the discovered links the crawler fetches. Form
+// actions are recorded but never fetched as that would submit the form.
+func followedLinks(links []Link) []Link {
+	var followed []Link
+	for _, link := range links {
+		if link.Kind == FormLink {
+			continue
+		}
+		followed = append(followed, link)
 	}
+	return followed
+}
+
+// resolveLinks resolves the links found on a page against the base url,
+// rewrites them as the scope does and returns the unique ones in scope that
+// pass the filter, if there is one, and the unique http ones out of scope.
+func resolveLinks(baseUrl string, scope *scope, links []Link, filter LinkFilter) ([]Link, []Link) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, nil
+	}
+
+	var resolved []Link
+	var external []Link
+	seen := make(map[string]struct{})
+	for _, link := range links {
+		href := strings.TrimSpace(link.Url)
+
+		// links to a fragment of the same page are skipped
+		if len(href) == 0 || href[0] == '#' {
+			continue
+		}
+
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+
+		abs := base.ResolveReference(ref)
+		abs.Fragment = ""
+		scope.canonicalize(abs)
+
+		inScope := scope.contains(abs)
+		if !inScope && abs.Scheme != "http" && abs.Scheme != "https" {
+			// such as mailto: and javascript: links
+			continue
+		}
 
-	if link[0] == '/' {
-		return link
+		if inScope && filter != nil && !filter.Allow(abs) {
+			continue
+		}
+
+		normalized, err := NormalizeUrl(abs.String())
+		if err != nil {
+			continue
+		}
+
+		if _, ok := seen[normalized]; ok {
+			continue
+		}
+		seen[normalized] = struct{}{}
+
+		if !inScope {
+			external = append(external, Link{
+				Url:      normalized,
+				Kind:     link.Kind,
+				Rel:      link.Rel,
+				Source:   link.Source,
+				Seed:     link.Seed,
+				External: true,
+			})
+			continue
+		}
+
+		resolved = append(resolved, Link{
+			Url:    normalized,
+			Kind:   link.Kind,
+			Rel:    link.Rel,
+			Source: link.Source,
+			Seed:   link.Seed,
+		})
 	}
 
-	return relativeUrl + "/" + link
+	return resolved, external
 }
 
 func NewCrawler(
 	httpClient *http.Client,
-	pe CrawlPolicyExecuter) *LinkCrawler {
-	return &LinkCrawler{
+	pe CrawlPolicyExecuter,
+	opts CrawlOptions) *LinkCrawler {
+	c := &LinkCrawler{
 		Client:         httpClient,
 		PolicyExecuter: pe,
+		Extractors:     DefaultContentExtractors(pe),
+		Options:        opts,
 	}
+
+	if !opts.Auth.IsZero() {
+		c.Client, c.auth = authenticate(httpClient, opts.Auth)
+	}
+	return c
 }
 
 type threadSafeHashSet struct {
@@ -220,21 +802,40 @@ type threadSafeHashSet struct {
 	hashset map[string]struct{}
 }
 
+func newThreadSafeHashSet() threadSafeHashSet {
+	return threadSafeHashSet{
+		hashset: make(map[string]struct{}),
+		mx:      &sync.Mutex{},
+	}
+}
+
 func (tsh *threadSafeHashSet) Exists(key string) bool {
+	tsh.mx.Lock()
+	defer tsh.mx.Unlock()
 	_, ok := tsh.hashset[key]
 	return ok
 }
 
 func (tsh *threadSafeHashSet) Add(key string) bool {
+	//lock
+	tsh.mx.Lock()
+	defer tsh.mx.Unlock()
 	//check exists
-	if tsh.Exists(key) {
+	if _, ok := tsh.hashset[key]; ok {
 		return false
 	}
-	//lock
-	tsh.mx.Lock()
 	//add
 	tsh.hashset[key] = struct{}{}
-	//unlock
-	tsh.mx.Unlock()
+	return true
+}
+
+// Remove removes the key and reports whether it was in the set.
+func (tsh *threadSafeHashSet) Remove(key string) bool {
+	tsh.mx.Lock()
+	defer tsh.mx.Unlock()
+	if _, ok := tsh.hashset[key]; !ok {
+		return false
+	}
+	delete(tsh.hashset, key)
 	return true
 }
@@ -1,12 +1,24 @@
 package crawler
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/warc"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
 )
 
 type LinkCrawlerTest struct {
@@ -24,13 +36,36 @@ func TestLinkCrawler(t *testing.T) {
 	t.Run("Test returns empty hashset on status not ok", lct.testReturnsEmptyHashsetOnStatusNotOK)
 	t.Run("Test returns empty hashset if no links", lct.testReturnsEmptyHashsetIfNoLinks)
 	t.Run("Test successful crawl", lct.testSuccessfulCrawl)
+	t.Run("Test reports crawled pages with resolved links", lct.testReportsCrawledPagesWithResolvedLinks)
+	t.Run("Test skips links rejected by policy filters", lct.testSkipsLinksRejectedByPolicyFilters)
+	t.Run("Test records assets and form actions without following forms", lct.testRecordsAssetsAndFormActionsWithoutFollowingForms)
+	t.Run("Test resolves links against base and records canonical", lct.testResolvesLinksAgainstBaseAndRecordsCanonical)
+	t.Run("Test skips nofollow links if configured", lct.testSkipsNoFollowLinksIfConfigured)
+	t.Run("Test seeds crawl with sitemap links", lct.testSeedsCrawlWithSitemapLinks)
+	t.Run("Test crawls from multiple seeds", lct.testCrawlsFromMultipleSeeds)
+	t.Run("Test checks listed urls without following links", lct.testChecksListedUrlsWithoutFollowingLinks)
+	t.Run("Test records listed urls that can't be fetched", lct.testRecordsListedUrlsThatCantBeFetched)
+	t.Run("Test records pages that time out", lct.testRecordsPagesThatTimeOut)
+	t.Run("Test records bodies that can't be decompressed", lct.testRecordsBodiesThatCantBeDecompressed)
+	t.Run("Test reports content type and last modified", lct.testReportsContentTypeAndLastModified)
+	t.Run("Test dispatches on content type", lct.testDispatchesOnContentType)
+	t.Run("Test decodes pages to utf-8", lct.testDecodesPagesToUTF8)
+	t.Run("Test records truncated and oversized pages", lct.testRecordsTruncatedAndOversizedPages)
+	t.Run("Test snapshots bodies as received", lct.testSnapshotsBodiesAsReceived)
+	t.Run("Test archives crawl as warc", lct.testArchivesCrawlAsWarc)
+	t.Run("Test archives requests without credentials", lct.testArchivesRequestsWithoutCredentials)
+	t.Run("Test records fetch timings", lct.testRecordsFetchTimings)
+	t.Run("Test download timing ends with the body", lct.testDownloadTimingEndsWithBody)
+	t.Run("Test records pages that can't be parsed", lct.testRecordsPagesThatCantBeParsed)
+	t.Run("Test returns the error of concurrent workers once", lct.testReturnsErrorOfConcurrentWorkersOnce)
 }
 
 func (lct *LinkCrawlerTest) setupSuite(t *testing.T) func(t *testing.T) {
 	client := &http.Client{}
 	lct.crawler = NewCrawler(
 		client,
-		NewPolicyExecutor("//a[@href[not(contains(.,'http')) and not(contains(.,'mailto:')) and not(contains(.,'tel:'))]]"))
+		NewPolicyExecutor("//a[@href[not(contains(.,'http')) and not(contains(.,'mailto:')) and not(contains(.,'tel:'))]]"),
+		CrawlOptions{})
 
 	return func(t *testing.T) {
 		client.CloseIdleConnections()
@@ -68,7 +103,7 @@ func (lct *LinkCrawlerTest) testReturnsEmptyHashsetOnStatusNotOK(t *testing.T) {
 	defer td(t)
 	lct.setupMockHandlerWithError("some error", 401)
 	baseUrl := lct.server.URL
-	hashset, err := lct.crawler.Crawl(baseUrl, func(links []string) error { return nil })
+	hashset, err := lct.crawler.Crawl([]string{baseUrl}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
 
 	assert.Nil(t, err)
 	assert.Len(t, hashset, 0)
@@ -91,7 +126,7 @@ func (lct *LinkCrawlerTest) testReturnsEmptyHashsetIfNoLinks(t *testing.T) {
 	lct.setupMockHandler(t, contentMap)
 
 	baseUrl := lct.server.URL
-	hashset, err := lct.crawler.Crawl(baseUrl+"/test", func(links []string) error { return nil })
+	hashset, err := lct.crawler.Crawl([]string{baseUrl + "/test"}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
 
 	assert.Nil(t, err)
 	assert.Len(t, hashset, 0)
@@ -133,8 +168,1071 @@ func (lct *LinkCrawlerTest) testSuccessfulCrawl(t *testing.T) {
 	lct.setupMockHandler(t, contentMap)
 
 	baseUrl := lct.server.URL
-	discoveredLinks, err := lct.crawler.Crawl(baseUrl, func(links []string) error { return nil })
+	discoveredLinks, err := lct.crawler.Crawl([]string{baseUrl}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
 
 	assert.Nil(t, err)
 	assert.Len(t, discoveredLinks, 4)
 }
+
+func (lct *LinkCrawlerTest) testReportsCrawledPagesWithResolvedLinks(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	htmlContent0 := `
+		<html>
+			<a href='/docs/'>docs</a>
+			<a href='#top'>top</a>
+		</html>`
+	htmlContent1 := `
+		<html>
+			<a href='page'>page</a>
+			<a href='../'>home</a>
+		</html>`
+	htmlContent2 := `<html></html>`
+
+	contentMap := map[string]string{
+		"":          htmlContent0,
+		"docs/":     htmlContent1,
+		"docs/page": htmlContent2,
+	}
+
+	lct.setupMockHandler(t, contentMap)
+
+	baseUrl := lct.server.URL
+	mx := &sync.Mutex{}
+	pages := make(map[string]CrawledPage)
+	_, err := lct.crawler.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Link{{Url: baseUrl + "/docs/", Kind: NavigationLink}}, pages[baseUrl+"/"].Links)
+	assert.Equal(t, []Link{
+		{Url: baseUrl + "/docs/page", Kind: NavigationLink},
+		{Url: baseUrl + "/", Kind: NavigationLink},
+	}, pages[baseUrl+"/docs/"].Links)
+	assert.Equal(t, http.StatusOK, pages[baseUrl+"/docs/page"].StatusCode)
+}
+
+func (lct *LinkCrawlerTest) testSkipsLinksRejectedByPolicyFilters(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	htmlContent0 := `
+		<html>
+			<a href='/docs/intro'>intro</a>
+			<a href='/docs/manual.pdf'>manual</a>
+			<a href='/about'>about</a>
+			<a href='mailto:test@test.com'>mail</a>
+		</html>`
+
+	contentMap := map[string]string{
+		"": htmlContent0,
+	}
+
+	lct.setupMockHandler(t, contentMap)
+
+	pe, err := NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{
+		Include: []URLFilter{{Type: PrefixURLFilter, Pattern: "/docs/"}},
+		Exclude: []URLFilter{{Type: GlobURLFilter, Pattern: "*.pdf"}},
+		Schemes: DefaultSchemes,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{})
+	baseUrl := lct.server.URL
+	discoveredLinks, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{baseUrl + "/docs/intro": {}}, discoveredLinks)
+}
+
+func (lct *LinkCrawlerTest) testRecordsAssetsAndFormActionsWithoutFollowingForms(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	htmlContent0 := `
+		<html>
+			<head><link rel='stylesheet' href='/style.css'></head>
+			<img src='/logo.png'>
+			<form action='/search'><input name='q'></form>
+		</html>`
+
+	var mx sync.Mutex
+	var requested []string
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requested = append(requested, r.URL.Path)
+		mx.Unlock()
+		if r.URL.Path == "/" {
+			w.Write([]byte(htmlContent0))
+		}
+	})
+
+	pe, err := NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{})
+	baseUrl := lct.server.URL
+	var discovered []Link
+	_, err = c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error {
+			mx.Lock()
+			defer mx.Unlock()
+			discovered = append(discovered, links...)
+			return nil
+		},
+		func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []Link{
+		{Url: baseUrl + "/style.css", Kind: StylesheetLink, Rel: []string{"stylesheet"}, Source: LinkedSource, Seed: baseUrl + "/"},
+		{Url: baseUrl + "/logo.png", Kind: ImageLink, Source: LinkedSource, Seed: baseUrl + "/"},
+		{Url: baseUrl + "/search", Kind: FormLink, Source: LinkedSource, Seed: baseUrl + "/"},
+	}, discovered)
+	assert.ElementsMatch(t, []string{"/", "/style.css", "/logo.png"}, requested)
+}
+
+func (lct *LinkCrawlerTest) testResolvesLinksAgainstBaseAndRecordsCanonical(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	htmlContent0 := `
+		<html>
+			<head>
+				<base href='/docs/'>
+				<link rel='canonical' href='index.html'>
+				<meta name='robots' content='noindex'>
+			</head>
+			<a href='intro'>intro</a>
+		</html>`
+
+	contentMap := map[string]string{
+		"": htmlContent0,
+	}
+
+	lct.setupMockHandler(t, contentMap)
+
+	pe, err := NewCompositePolicyExecutor([]ExtractionRule{{Policy: "//a[@href]"}}, URLFilters{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{})
+	baseUrl := lct.server.URL
+	mx := &sync.Mutex{}
+	pages := make(map[string]CrawledPage)
+	_, err = c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+
+	page := pages[baseUrl+"/"]
+	assert.Equal(t, []Link{{Url: baseUrl + "/docs/intro", Kind: NavigationLink}}, page.Links)
+	assert.Equal(t, baseUrl+"/docs/index.html", page.Canonical)
+	assert.True(t, page.NoIndex)
+	assert.False(t, page.NoFollow)
+}
+
+func (lct *LinkCrawlerTest) testSkipsNoFollowLinksIfConfigured(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	htmlContent0 := `
+		<html>
+			<a href='/followed'>followed</a>
+			<a href='/sponsored' rel='sponsored nofollow'>sponsored</a>
+			<a href='/robots'>robots</a>
+		</html>`
+	htmlContent1 := `
+		<html>
+			<head><meta name='robots' content='nofollow'></head>
+			<a href='/hidden'>hidden</a>
+		</html>`
+
+	contentMap := map[string]string{
+		"":       htmlContent0,
+		"robots": htmlContent1,
+	}
+
+	lct.setupMockHandler(t, contentMap)
+
+	pe, err := NewCompositePolicyExecutor([]ExtractionRule{{Policy: "//a[@href]"}}, URLFilters{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseUrl := lct.server.URL
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{SkipNoFollow: true})
+	discoveredLinks, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{
+		baseUrl + "/followed": {},
+		baseUrl + "/robots":   {},
+	}, discoveredLinks)
+
+	c = NewCrawler(&http.Client{}, pe, CrawlOptions{})
+	discoveredLinks, err = c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.Len(t, discoveredLinks, 4)
+}
+
+func (lct *LinkCrawlerTest) testSeedsCrawlWithSitemapLinks(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	baseUrl := lct.server.URL
+	contentMap := map[string]string{
+		"":           `<html><a href='/linked'>linked</a><a href='/listed'>listed</a></html>`,
+		"robots.txt": "User-agent: *\nSitemap: " + baseUrl + "/sitemap-index.xml\n",
+		"sitemap-index.xml": `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<sitemap><loc>` + baseUrl + `/sitemap-pages.xml</loc></sitemap>
+		</sitemapindex>`,
+		"sitemap-pages.xml": `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url><loc>` + baseUrl + `/</loc></url>
+			<url><loc>` + baseUrl + `/listed</loc></url>
+			<url><loc>` + baseUrl + `/unlinked</loc></url>
+			<url><loc>https://elsewhere.example/</loc></url>
+		</urlset>`,
+		"linked":   `<html></html>`,
+		"listed":   `<html></html>`,
+		"unlinked": `<html></html>`,
+	}
+	lct.setupMockHandler(t, contentMap)
+
+	pe, err := NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{UseSitemaps: true})
+	var mx sync.Mutex
+	var discovered []Link
+	var crawled []string
+	_, err = c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error {
+			mx.Lock()
+			defer mx.Unlock()
+			discovered = append(discovered, links...)
+			return nil
+		},
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			crawled = append(crawled, page.Url)
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []Link{
+		{Url: baseUrl + "/", Kind: NavigationLink, Source: SitemapSource, Seed: baseUrl + "/"},
+		{Url: baseUrl + "/listed", Kind: NavigationLink, Source: SitemapSource, Seed: baseUrl + "/"},
+		{Url: baseUrl + "/unlinked", Kind: NavigationLink, Source: SitemapSource, Seed: baseUrl + "/"},
+		{Url: baseUrl + "/linked", Kind: NavigationLink, Source: LinkedSource, Seed: baseUrl + "/"},
+		{Url: baseUrl + "/listed", Kind: NavigationLink, Source: LinkedSource, Seed: baseUrl + "/"},
+	}, discovered)
+	assert.ElementsMatch(t, []string{
+		baseUrl + "/",
+		baseUrl + "/listed",
+		baseUrl + "/unlinked",
+		baseUrl + "/linked",
+	}, crawled)
+}
+
+func (lct *LinkCrawlerTest) testCrawlsFromMultipleSeeds(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	var mx sync.Mutex
+	requested := make(map[string]int)
+	contentMap := map[string]string{
+		"en/":      `<html><a href='/en/about'>about</a><a href='/landing'>landing</a></html>`,
+		"en/about": `<html><a href='/en/'>home</a></html>`,
+		"landing":  `<html><a href='/offer'>offer</a></html>`,
+		"offer":    `<html></html>`,
+	}
+	for key, content := range contentMap {
+		path, content := "/"+key, content
+		lct.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			mx.Lock()
+			requested[r.URL.Path]++
+			mx.Unlock()
+			w.Write([]byte(content))
+		})
+	}
+
+	baseUrl := lct.server.URL
+	seeds := map[string]string{}
+	_, err := lct.crawler.Crawl(
+		[]string{baseUrl + "/en/", baseUrl + "/landing", baseUrl + "/en/"},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			seeds[page.Url] = page.Seed
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		baseUrl + "/en/":      baseUrl + "/en/",
+		baseUrl + "/en/about": baseUrl + "/en/",
+		baseUrl + "/landing":  baseUrl + "/landing",
+		baseUrl + "/offer":    baseUrl + "/landing",
+	}, seeds)
+	assert.Equal(t, map[string]int{"/en/": 1, "/en/about": 1, "/landing": 1, "/offer": 1}, requested)
+}
+
+func (lct *LinkCrawlerTest) testChecksListedUrlsWithoutFollowingLinks(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	var mx sync.Mutex
+	var requested []string
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requested = append(requested, r.URL.Path)
+		mx.Unlock()
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`<html><a href='/linked'>linked</a></html>`))
+	})
+
+	baseUrl := lct.server.URL
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{ListMode: true, UseSitemaps: true})
+	statusCodes := make(map[string]int)
+	discoveredLinks, err := c.Crawl(
+		[]string{baseUrl + "/a", baseUrl + "/missing", baseUrl + "/a"},
+		func(links []Link) error {
+			t.Errorf("links were reported in list mode: %v", links)
+			return nil
+		},
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			statusCodes[page.Url] = page.StatusCode
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Len(t, discoveredLinks, 0)
+	assert.Equal(t, map[string]int{baseUrl + "/a": http.StatusOK, baseUrl + "/missing": http.StatusNotFound}, statusCodes)
+	assert.ElementsMatch(t, []string{"/a", "/missing"}, requested)
+}
+
+func (lct *LinkCrawlerTest) testRecordsListedUrlsThatCantBeFetched(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte(`<html></html>`))
+	})
+
+	// nothing listens on the port
+	dead := "http://127.0.0.1:1/dead"
+	baseUrl := lct.server.URL
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{ListMode: true})
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	_, err := c.Crawl(
+		[]string{dead, baseUrl + "/slow", baseUrl + "/a", baseUrl + "/b"},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Len(t, pages, 4)
+	assert.Equal(t, 0, pages[dead].StatusCode)
+	assert.Contains(t, pages[dead].FetchError, "connection refused")
+	for _, path := range []string{"/slow", "/a", "/b"} {
+		assert.Equal(t, http.StatusOK, pages[baseUrl+path].StatusCode, path)
+		assert.Empty(t, pages[baseUrl+path].FetchError, path)
+	}
+}
+
+func (lct *LinkCrawlerTest) testRecordsPagesThatTimeOut(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/slow">slow</a><a href="/stalled">stalled</a><a href="/a">a</a></html>`))
+	})
+	lct.mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`<html></html>`))
+	})
+	lct.mux.HandleFunc("/stalled", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/b">b</a>`))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`</html>`))
+	})
+	lct.mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/c">c</a></html>`))
+	})
+	lct.mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	})
+
+	client, err := FetchConfig{Timeout: Duration(100 * time.Millisecond)}.NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	baseUrl := lct.server.URL
+	c := NewCrawler(client, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	_, err = c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+
+	// timing out waiting for the response, or reading its body
+	assert.Equal(t, 0, pages[baseUrl+"/slow"].StatusCode)
+	assert.Contains(t, pages[baseUrl+"/slow"].FetchError, "Client.Timeout")
+	assert.Equal(t, http.StatusOK, pages[baseUrl+"/stalled"].StatusCode)
+	assert.Contains(t, pages[baseUrl+"/stalled"].FetchError, "Client.Timeout")
+	assert.False(t, pages[baseUrl+"/stalled"].Parsed)
+
+	// the rest of the site is crawled
+	assert.Equal(t, http.StatusOK, pages[baseUrl+"/c"].StatusCode)
+	assert.NotContains(t, pages, baseUrl+"/b")
+}
+
+func (lct *LinkCrawlerTest) testRecordsBodiesThatCantBeDecompressed(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write([]byte(`<html><a href="/b">b</a>` + strings.Repeat("<p>text</p>", 100) + `</html>`))
+	gw.Close()
+	// the checksum at the end of the stream no longer matches
+	corrupt := compressed.Bytes()
+	corrupt[len(corrupt)-8] ^= 0xff
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/bad-header">1</a><a href="/corrupt">2</a><a href="/brotli">3</a><a href="/a">4</a></html>`))
+	})
+	lct.mux.HandleFunc("/bad-header", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(`<html><a href="/b">b</a></html>`))
+	})
+	lct.mux.HandleFunc("/corrupt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(corrupt)
+	})
+	lct.mux.HandleFunc("/brotli", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte(`<html><a href="/b">b</a></html>`))
+	})
+	lct.mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	})
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	baseUrl := lct.server.URL
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	_, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+
+	for _, path := range []string{"/bad-header", "/corrupt", "/brotli"} {
+		page := pages[baseUrl+path]
+		assert.Equal(t, http.StatusOK, page.StatusCode, path)
+		assert.NotEmpty(t, page.FetchError, path)
+		assert.False(t, page.Parsed, path)
+		assert.Empty(t, page.ContentHash, path)
+	}
+	assert.Contains(t, pages[baseUrl+"/bad-header"].FetchError, "gzip: invalid header")
+	assert.Contains(t, pages[baseUrl+"/corrupt"].FetchError, "gzip: invalid checksum")
+
+	// the links of the corrupt bodies aren't followed
+	assert.Equal(t, http.StatusOK, pages[baseUrl+"/a"].StatusCode)
+	assert.NotContains(t, pages, baseUrl+"/b")
+}
+
+func (lct *LinkCrawlerTest) testReportsContentTypeAndLastModified(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Last-Modified", "Sun, 02 Jan 2022 03:04:05 GMT")
+		w.Write([]byte(`<html></html>`))
+	})
+
+	var pages []CrawledPage
+	_, err := lct.crawler.Crawl(
+		[]string{lct.server.URL},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			pages = append(pages, page)
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Len(t, pages, 1)
+	assert.Equal(t, "text/html", pages[0].ContentType)
+	assert.Equal(t, time.Date(2022, time.January, 2, 3, 4, 5, 0, time.UTC), pages[0].LastModified.UTC())
+}
+
+func (lct *LinkCrawlerTest) testDispatchesOnContentType(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><a href='/feed'>feed</a><a href='/doc'>doc</a></html>`))
+	})
+	lct.mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write([]byte(`<feed><entry><link href="/post"/></entry></feed>`))
+	})
+	lct.mux.HandleFunc("/doc", func(w http.ResponseWriter, r *http.Request) {
+		// served without a content type, which is sniffed
+		w.Header()["Content-Type"] = nil
+		w.Write([]byte("%PDF-1.4 <a href='/hidden'>"))
+	})
+	lct.mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	})
+
+	pe, err := NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{})
+	baseUrl := lct.server.URL
+	discoveredLinks, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{
+		baseUrl + "/feed": {},
+		baseUrl + "/doc":  {},
+		baseUrl + "/post": {},
+	}, discoveredLinks)
+	assert.Equal(t, "application/atom+xml", pages[baseUrl+"/feed"].ContentType)
+	assert.True(t, pages[baseUrl+"/feed"].Parsed)
+	assert.Equal(t, "application/pdf", pages[baseUrl+"/doc"].ContentType)
+	assert.False(t, pages[baseUrl+"/doc"].Parsed)
+	assert.Empty(t, pages[baseUrl+"/doc"].Links)
+}
+
+func (lct *LinkCrawlerTest) testDecodesPagesToUTF8(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	htmlContent0, err := charmap.Windows1252.NewEncoder().String(`<html>
+		<head><meta charset="windows-1252"></head>
+		<a href='/café'>café</a>
+	</html>`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(htmlContent0))
+	})
+
+	var mx sync.Mutex
+	charsets := make(map[string]string)
+	baseUrl := lct.server.URL
+	discoveredLinks, err := lct.crawler.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			charsets[page.Url] = page.Charset
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{baseUrl + "/caf%C3%A9": {}}, discoveredLinks)
+	assert.Equal(t, "windows-1252", charsets[baseUrl+"/"])
+}
+
+func (lct *LinkCrawlerTest) testRecordsTruncatedAndOversizedPages(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><a href='/large'>large</a><a href='/huge'>huge</a><a href='/bomb'>bomb</a></html>`))
+	})
+	lct.mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		// streamed without a content length
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href='/kept'>kept</a>`))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat(" ", 1024) + `<a href='/cut'>cut</a></html>`))
+	})
+	lct.mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		content := `<html>` + strings.Repeat(" ", 4096) + `<a href='/unread'>unread</a></html>`
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write([]byte(content))
+	})
+	lct.mux.HandleFunc("/bomb", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte(`<html><a href='/inflated'>inflated</a>`))
+		gw.Write(bytes.Repeat([]byte(" "), 1024*1024))
+		gw.Close()
+	})
+	lct.mux.HandleFunc("/kept", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	})
+	lct.mux.HandleFunc("/inflated", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	})
+
+	pe, err := NewCompositePolicyExecutor(DefaultExtractionRules, URLFilters{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	c := NewCrawler(&http.Client{}, pe, CrawlOptions{MaxBodySize: 2048, MaxParseSize: 512})
+	baseUrl := lct.server.URL
+	discoveredLinks, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{
+		baseUrl + "/large":    {},
+		baseUrl + "/huge":     {},
+		baseUrl + "/bomb":     {},
+		baseUrl + "/kept":     {},
+		baseUrl + "/inflated": {},
+	}, discoveredLinks)
+	assert.Equal(t, NotLimited, pages[baseUrl+"/"].SizeLimit)
+	assert.Equal(t, Truncated, pages[baseUrl+"/large"].SizeLimit)
+	assert.True(t, pages[baseUrl+"/large"].Parsed)
+	assert.Equal(t, Oversized, pages[baseUrl+"/huge"].SizeLimit)
+	assert.False(t, pages[baseUrl+"/huge"].Parsed)
+	assert.Equal(t, Truncated, pages[baseUrl+"/bomb"].SizeLimit)
+}
+
+func (lct *LinkCrawlerTest) testSnapshotsBodiesAsReceived(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	content := []byte("<html>\xe9t\xe9<a href='/logo.png'>logo</a></html>")
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=windows-1252")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Set-Cookie", "session=secret")
+		gw := gzip.NewWriter(w)
+		gw.Write(content)
+		gw.Close()
+	})
+	lct.mux.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})
+
+	store, err := blobstore.NewLocalStore(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{Snapshots: store})
+	baseUrl := lct.server.URL
+	_, err = c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+
+	// the body is stored decompressed but not decoded
+	page := pages[baseUrl+"/"]
+	assert.Equal(t, blobstore.Key(content), page.SnapshotKey)
+	assert.Equal(t, "gzip", page.Header.Get("Content-Encoding"))
+
+	// session cookies aren't stored
+	assert.Empty(t, page.Header.Values("Set-Cookie"))
+
+	stored, err := store.Get(page.SnapshotKey)
+	assert.Nil(t, err)
+	assert.Equal(t, content, stored)
+
+	// bodies that aren't parsed are downloaded to be stored
+	image := pages[baseUrl+"/logo.png"]
+	assert.Equal(t, blobstore.Key([]byte("png")), image.SnapshotKey)
+	assert.Equal(t, "image/png", image.Header.Get("Content-Type"))
+}
+
+func (lct *LinkCrawlerTest) testArchivesCrawlAsWarc(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte(`<html><a href='/missing'>missing</a>` + strings.Repeat("<p>compressed</p>", 100) + `</html>`))
+		gw.Close()
+	})
+	lct.mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not here", http.StatusNotFound)
+	})
+
+	dir := t.TempDir()
+	writer, err := warc.NewWriter(dir, "crawl", 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{Warc: writer})
+	baseUrl := lct.server.URL
+	_, err = c.Crawl([]string{baseUrl}, func(links []Link) error { return nil }, func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	archive := readWarc(t, dir)
+
+	assert.Equal(t, 1, strings.Count(archive, "WARC-Type: warcinfo\r\n"))
+	assert.Equal(t, 2, strings.Count(archive, "WARC-Type: request\r\n"))
+	assert.Equal(t, 2, strings.Count(archive, "WARC-Type: response\r\n"))
+	assert.Contains(t, archive, "GET /missing HTTP/1.1\r\n")
+
+	// bodies are archived as received, including the ones not parsed
+	assert.Contains(t, archive, "Content-Encoding: gzip\r\n")
+	assert.NotContains(t, archive, "<p>compressed</p>")
+	assert.Contains(t, archive, "HTTP/1.1 404 Not Found\r\n")
+	assert.Contains(t, archive, "not here")
+	assert.NotContains(t, archive, "WARC-Truncated")
+
+	// only the home page has links
+	assert.Equal(t, 1, strings.Count(archive, "WARC-Type: metadata\r\n"))
+	assert.Contains(t, archive, "outlink: "+baseUrl+"/missing\r\n")
+}
+
+func (lct *LinkCrawlerTest) testArchivesRequestsWithoutCredentials(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html></html>`))
+	})
+
+	dir := t.TempDir()
+	writer, err := warc.NewWriter(dir, "crawl", 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{
+		Warc: writer,
+		Auth: AuthConfig{Type: BasicAuth, Username: "user", Password: "secret", Cookies: map[string]string{"session": "token"}},
+	})
+	var statusCode int
+	_, err = c.Crawl([]string{lct.server.URL}, func(links []Link) error { return nil }, func(page CrawledPage) error {
+		statusCode = page.StatusCode
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	archive := readWarc(t, dir)
+
+	assert.Contains(t, archive, "GET / HTTP/1.1\r\n")
+	assert.NotContains(t, archive, "Authorization")
+	assert.NotContains(t, archive, "Cookie")
+	assert.NotContains(t, archive, "session=token")
+}
+
+// readWarc returns the uncompressed records of the only WARC file written to
+// the directory.
+func readWarc(t *testing.T, dir string) string {
+	files, err := warc.Files(dir, "crawl")
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func (lct *LinkCrawlerTest) testRecordsFetchTimings(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>"))
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("</html>"))
+	})
+
+	var page CrawledPage
+	started := time.Now()
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	_, err := c.Crawl(
+		[]string{lct.server.URL},
+		func(links []Link) error { return nil },
+		func(p CrawledPage) error {
+			page = p
+			return nil
+		})
+
+	assert.Nil(t, err)
+	if !assert.NotNil(t, page.Timings) {
+		return
+	}
+
+	// the server is dialed by address, over a new connection without tls
+	assert.False(t, page.Timings.StartedAt.Before(started))
+	assert.Equal(t, time.Duration(0), page.Timings.DNS)
+	assert.Greater(t, page.Timings.Connect, time.Duration(0))
+	assert.Equal(t, time.Duration(0), page.Timings.TLS)
+	assert.GreaterOrEqual(t, page.Timings.TimeToFirstByte, 20*time.Millisecond)
+	assert.GreaterOrEqual(t, page.Timings.Download, 20*time.Millisecond)
+}
+
+// slowStore is a blob store that takes a while to store blobs.
+type slowStore struct {
+	blobstore.BlobStore
+	delay time.Duration
+}
+
+func (s slowStore) Put(content []byte) (string, error) {
+	time.Sleep(s.delay)
+	return s.BlobStore.Put(content)
+}
+
+func (lct *LinkCrawlerTest) testDownloadTimingEndsWithBody(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+
+	store, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var page CrawledPage
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{
+		Snapshots: slowStore{BlobStore: store, delay: 100 * time.Millisecond},
+	})
+	_, err = c.Crawl(
+		[]string{lct.server.URL},
+		func(links []Link) error { return nil },
+		func(p CrawledPage) error {
+			page = p
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, page.SnapshotKey)
+	if !assert.NotNil(t, page.Timings) {
+		return
+	}
+
+	// storing the snapshot once the body was read isn't downloading it
+	assert.Less(t, page.Timings.Download, 100*time.Millisecond)
+}
+
+func (lct *LinkCrawlerTest) testRecordsPagesThatCantBeParsed(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/feed">feed</a><a href="/about">about</a></html>`))
+	})
+	lct.mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss><channel><item><link>/a</link><`))
+	})
+	lct.mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html></html>`))
+	})
+
+	var mx sync.Mutex
+	pages := make(map[string]CrawledPage)
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	baseUrl := lct.server.URL
+	_, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			pages[page.Url] = page
+			return nil
+		})
+
+	assert.Nil(t, err)
+
+	feed := pages[baseUrl+"/feed"]
+	assert.Equal(t, http.StatusOK, feed.StatusCode)
+	assert.False(t, feed.Parsed)
+	assert.NotEmpty(t, feed.ParseError)
+	assert.Empty(t, feed.Links)
+
+	// the rest of the site is crawled
+	assert.True(t, pages[baseUrl+"/about"].Parsed)
+	assert.Empty(t, pages[baseUrl+"/about"].ParseError)
+}
+
+func (lct *LinkCrawlerTest) testReturnsErrorOfConcurrentWorkersOnce(t *testing.T) {
+	td := lct.setupTest(t)
+	defer td(t)
+
+	var links strings.Builder
+	for i := 0; i < 3*MaxNumberOfCrawlers; i++ {
+		fmt.Fprintf(&links, `<a href="/page-%d">page</a>`, i)
+	}
+	lct.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>" + links.String() + "</html>"))
+	})
+
+	// every page but the seed fails to be stored
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{})
+	baseUrl := lct.server.URL
+	_, err := c.Crawl(
+		[]string{baseUrl},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			if page.Url == baseUrl+"/" {
+				return nil
+			}
+			return errors.New("db error")
+		})
+
+	assert.EqualError(t, err, "db error")
+}
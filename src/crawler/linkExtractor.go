@@ -0,0 +1,242 @@
+package crawler
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+type LinkKind string
+
+const (
+	NavigationLink LinkKind = "navigation"
+	ImageLink      LinkKind = "image"
+	ScriptLink     LinkKind = "script"
+	StylesheetLink LinkKind = "stylesheet"
+	MediaLink      LinkKind = "media"
+	FormLink       LinkKind = "form"
+)
+
+type LinkSource string
+
+const (
+	// LinkedSource links were found on a crawled page.
+	LinkedSource LinkSource = "links"
+	// SitemapSource links were listed in a sitemap of the site.
+	SitemapSource LinkSource = "sitemap"
+)
+
+// Link is a link found on a page together with the kind of resource it
+// points to and the rel values of the element it was found on. The source
+// is set when the crawler reports the link as discovered.
+type Link struct {
+	Url    string
+	Kind   LinkKind
+	Rel    []string
+	Source LinkSource
+	// External links are out of the scope of the crawl and never fetched.
+	External bool
+	// Seed is the seed of the crawl the link was first reached from.
+	Seed string
+	// OriginalUrl is the url the link was found at, if canonicalization
+	// rewrote it.
+	OriginalUrl string
+	// FetchUrl is the url the link is fetched at, if it differs from its
+	// canonical url by ignored parameters.
+	FetchUrl string
+}
+
+// fetchUrl returns the url the link is fetched at.
+func (l Link) fetchUrl() string {
+	if l.FetchUrl != "" {
+		return l.FetchUrl
+	}
+	return l.Url
+}
+
+// resourceAttributes are read from matched nodes when a policy doesn't name
+// the attribute holding the link.
+var resourceAttributes = []string{"href", "src", "srcset", "data-src", "poster", "action", "content", "style"}
+
+var cssUrlRegexp = regexp.MustCompile(`url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+
+// extractLinks returns the links in the given attribute of the node, or in
+// all of its resource attributes if no attribute is given.
+func extractLinks(node *html.Node, attribute string) []Link {
+	if attribute != "" {
+		return attributeLinks(node, attribute, selectAttr(node, attribute))
+	}
+
+	var links []Link
+	for _, attr := range resourceAttributes {
+		if value, ok := lookupAttr(node, attr); ok {
+			links = append(links, attributeLinks(node, attr, value)...)
+		}
+	}
+	return links
+}
+
+// attributeLinks parses the value of an attribute into links, tagging them
+// with a kind based on the element and the attribute.
+func attributeLinks(node *html.Node, attribute string, value string) []Link {
+	switch attribute {
+	case "href":
+		switch node.Data {
+		case "base":
+			// the base url of the document isn't a link
+			return nil
+		case "link":
+			return []Link{{Url: value, Kind: linkRelKind(node), Rel: parseRel(selectAttr(node, "rel"))}}
+		default:
+			return []Link{{Url: value, Kind: NavigationLink, Rel: parseRel(selectAttr(node, "rel"))}}
+		}
+	case "src", "data-src":
+		return []Link{{Url: value, Kind: sourceKind(node)}}
+	case "srcset":
+		var links []Link
+		for _, candidate := range parseSrcset(value) {
+			links = append(links, Link{Url: candidate, Kind: sourceKind(node)})
+		}
+		return links
+	case "poster":
+		return []Link{{Url: value, Kind: ImageLink}}
+	case "action":
+		return []Link{{Url: value, Kind: FormLink}}
+	case "content":
+		if node.Data != "meta" || !strings.EqualFold(selectAttr(node, "http-equiv"), "refresh") {
+			return nil
+		}
+		if refresh := parseMetaRefresh(value); refresh != "" {
+			return []Link{{Url: refresh, Kind: NavigationLink}}
+		}
+		return nil
+	case "style":
+		var links []Link
+		for _, match := range cssUrlRegexp.FindAllStringSubmatch(value, -1) {
+			links = append(links, Link{Url: match[1], Kind: ImageLink})
+		}
+		return links
+	default:
+		return []Link{{Url: value, Kind: NavigationLink}}
+	}
+}
+
+// linkRelKind returns the kind of resource a <link> element points to.
+func linkRelKind(node *html.Node) LinkKind {
+	for _, rel := range parseRel(selectAttr(node, "rel")) {
+		switch rel {
+		case "stylesheet":
+			return StylesheetLink
+		case "icon", "apple-touch-icon", "mask-icon":
+			return ImageLink
+		case "modulepreload":
+			return ScriptLink
+		case "preload", "prefetch":
+			switch strings.ToLower(selectAttr(node, "as")) {
+			case "script", "worker":
+				return ScriptLink
+			case "style":
+				return StylesheetLink
+			case "image":
+				return ImageLink
+			case "audio", "video", "track", "font":
+				return MediaLink
+			}
+		}
+	}
+	return NavigationLink
+}
+
+// sourceKind returns the kind of resource the src of an element points to.
+func sourceKind(node *html.Node) LinkKind {
+	switch node.Data {
+	case "script":
+		return ScriptLink
+	case "iframe", "frame":
+		return NavigationLink
+	case "audio", "video", "track", "embed":
+		return MediaLink
+	case "source":
+		if node.Parent != nil && node.Parent.Data == "picture" {
+			return ImageLink
+		}
+		return MediaLink
+	default:
+		// images and lazy loaded backgrounds
+		return ImageLink
+	}
+}
+
+// parseSrcset returns the urls of the image candidates in a srcset attribute,
+// for example "small.jpg 480w, large.jpg 1080w".
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for i := 0; i < len(srcset); {
+		// skip separators before the url
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+
+		candidate := srcset[start:i]
+		if strings.HasSuffix(candidate, ",") {
+			// a url without descriptors ends at the comma
+			candidate = strings.TrimRight(candidate, ",")
+		} else {
+			// skip the descriptors up to the next candidate
+			for i < len(srcset) && srcset[i] != ',' {
+				i++
+			}
+		}
+
+		if candidate != "" {
+			urls = append(urls, candidate)
+		}
+	}
+	return urls
+}
+
+// parseMetaRefresh returns the url of a meta refresh content value such as
+// "5; url=https://example.com/".
+func parseMetaRefresh(content string) string {
+	sep := strings.IndexAny(content, ";,")
+	if sep < 0 {
+		return ""
+	}
+
+	value := strings.TrimSpace(content[sep+1:])
+	if len(value) >= 3 && strings.EqualFold(value[:3], "url") {
+		rest := strings.TrimLeftFunc(value[3:], unicode.IsSpace)
+		if strings.HasPrefix(rest, "=") {
+			value = strings.TrimSpace(rest[1:])
+		}
+	}
+
+	return strings.Trim(value, `'"`)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func lookupAttr(node *html.Node, name string) (string, bool) {
+	for _, attr := range node.Attr {
+		if attr.Key == name {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// selectAttr returns the value of the named attribute of the node or an
+// empty string if the node doesn't have it.
+func selectAttr(node *html.Node, name string) string {
+	value, _ := lookupAttr(node, name)
+	return value
+}
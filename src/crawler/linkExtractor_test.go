@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkExtractor(t *testing.T) {
+	t.Run("Test extracts links from resource attributes with kinds", testExtractsLinksFromResourceAttributesWithKinds)
+	t.Run("Test parses srcset candidates", testParsesSrcsetCandidates)
+	t.Run("Test parses meta refresh url", testParsesMetaRefreshUrl)
+}
+
+func testExtractsLinksFromResourceAttributesWithKinds(t *testing.T) {
+	htmlContent := `<html>
+		<head>
+			<base href='/base/'>
+			<meta http-equiv='refresh' content='5; url=/refreshed'>
+			<meta name='description' content='not a link'>
+			<link rel='stylesheet' href='/style.css'>
+			<link rel='icon' href='/favicon.ico'>
+			<link rel='preload' as='script' href='/preload.js'>
+			<script src='/app.js'></script>
+		</head>
+		<body>
+			<a href='/page' style="background: url('/bg.png')">page</a>
+			<img src='/small.png' srcset='/small.png 1x, /large.png 2x' data-src='/lazy.png'>
+			<picture><source srcset='/photo.webp'></picture>
+			<video src='/movie.mp4' poster='/poster.jpg'><track src='/subs.vtt'></video>
+			<iframe src='/frame'></iframe>
+			<form action='/submit'></form>
+		</body>
+	</html>`
+
+	pe := NewPolicyExecutor(DefaultExtractionRules[0].Policy + " | " + DefaultExtractionRules[1].Policy)
+	result, err := pe.Execute(io.NopCloser(strings.NewReader(htmlContent)))
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []Link{
+		{Url: "/refreshed", Kind: NavigationLink},
+		{Url: "/style.css", Kind: StylesheetLink, Rel: []string{"stylesheet"}},
+		{Url: "/favicon.ico", Kind: ImageLink, Rel: []string{"icon"}},
+		{Url: "/preload.js", Kind: ScriptLink, Rel: []string{"preload"}},
+		{Url: "/app.js", Kind: ScriptLink},
+		{Url: "/page", Kind: NavigationLink},
+		{Url: "/bg.png", Kind: ImageLink},
+		{Url: "/small.png", Kind: ImageLink},
+		{Url: "/small.png", Kind: ImageLink},
+		{Url: "/large.png", Kind: ImageLink},
+		{Url: "/lazy.png", Kind: ImageLink},
+		{Url: "/photo.webp", Kind: ImageLink},
+		{Url: "/movie.mp4", Kind: MediaLink},
+		{Url: "/poster.jpg", Kind: ImageLink},
+		{Url: "/subs.vtt", Kind: MediaLink},
+		{Url: "/frame", Kind: NavigationLink},
+		{Url: "/submit", Kind: FormLink},
+	}, result.Links)
+}
+
+func testParsesSrcsetCandidates(t *testing.T) {
+	assert.Equal(t,
+		[]string{"a.png", "b,c.png", "d.png", "e.png"},
+		parseSrcset(" a.png 480w,b,c.png 2x , d.png, e.png"))
+}
+
+func testParsesMetaRefreshUrl(t *testing.T) {
+	assert.Equal(t, "/next", parseMetaRefresh("0; URL = '/next'"))
+	assert.Equal(t, "https://example.com/", parseMetaRefresh("5;url=https://example.com/"))
+	assert.Equal(t, "", parseMetaRefresh("5"))
+}
@@ -0,0 +1,38 @@
+package crawler
+
+import (
+	"fmt"
+
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+type PolicyLanguage string
+
+const (
+	XPathPolicyLanguage PolicyLanguage = "xpath"
+	CSSPolicyLanguage   PolicyLanguage = "css"
+)
+
+// nodeExtractor is implemented by the policy executers that can extract links
+// from an already parsed document, so that several policies share one parse.
+type nodeExtractor interface {
+	extract(doc *html.Node) []Link
+}
+
+// NewPolicyExecuterForLanguage creates a policy executer for a policy written
+// in the given language, returning an error if the policy doesn't compile.
+func NewPolicyExecuterForLanguage(language PolicyLanguage, policy string) (CrawlPolicyExecuter, error) {
+	switch language {
+	case XPathPolicyLanguage:
+		// htmlquery panics on invalid expressions so compile it up front
+		if _, err := xpath.Compile(policy); err != nil {
+			return nil, err
+		}
+		return NewPolicyExecutor(policy), nil
+	case CSSPolicyLanguage:
+		return NewCSSSelectorPolicyExecutor(policy)
+	default:
+		return nil, fmt.Errorf("unsupported policy language %q", language)
+	}
+}
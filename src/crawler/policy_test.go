@@ -0,0 +1,37 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Run("Test creates executer for each language", testCreatesExecuterForEachLanguage)
+	t.Run("Test returns error on invalid policy", testReturnsErrorOnInvalidPolicy)
+	t.Run("Test returns error on unsupported language", testReturnsErrorOnUnsupportedLanguage)
+}
+
+func testCreatesExecuterForEachLanguage(t *testing.T) {
+	xpe, err := NewPolicyExecuterForLanguage(XPathPolicyLanguage, "//a[@href]")
+
+	assert.Nil(t, err)
+	assert.IsType(t, &XPathPolicyExecutor{}, xpe)
+
+	cpe, err := NewPolicyExecuterForLanguage(CSSPolicyLanguage, "a[href]")
+
+	assert.Nil(t, err)
+	assert.IsType(t, &CSSSelectorPolicyExecutor{}, cpe)
+}
+
+func testReturnsErrorOnInvalidPolicy(t *testing.T) {
+	_, err := NewPolicyExecuterForLanguage(XPathPolicyLanguage, "//a[@href")
+
+	assert.NotNil(t, err)
+}
+
+func testReturnsErrorOnUnsupportedLanguage(t *testing.T) {
+	_, err := NewPolicyExecuterForLanguage("regex", "a")
+
+	assert.NotNil(t, err)
+}
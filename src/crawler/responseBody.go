@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// DefaultMaxBodySize is the maximum decompressed size of a response body
+	// read by the crawler unless configured otherwise.
+	DefaultMaxBodySize = 10 * 1024 * 1024
+	// DefaultMaxParseSize is the maximum size of a decoded body handed to an
+	// extractor unless configured otherwise.
+	DefaultMaxParseSize = 5 * 1024 * 1024
+)
+
+// acceptEncoding lists the content codings the crawler decompresses itself,
+// so that their decompressed size can be limited.
+const acceptEncoding = "gzip, deflate, br"
+
+// SizeLimit tells whether the body of a page was cut by the size limits.
+type SizeLimit string
+
+const (
+	// NotLimited bodies were read in full.
+	NotLimited SizeLimit = ""
+	// Truncated bodies were larger than a limit and their links were
+	// extracted from the part within it.
+	Truncated SizeLimit = "truncated"
+	// Oversized bodies declared a length above the maximum body size and
+	// weren't read.
+	Oversized SizeLimit = "oversized"
+)
+
+func (o CrawlOptions) maxBodySize() int64 {
+	if o.MaxBodySize > 0 {
+		return o.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+func (o CrawlOptions) maxParseSize() int64 {
+	if o.MaxParseSize > 0 {
+		return o.MaxParseSize
+	}
+	return DefaultMaxParseSize
+}
+
+// decompressBody returns a reader of the body decoded from its content
+// encoding.
+func decompressBody(contentEncoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// deflate should be zlib wrapped but is sometimes sent raw
+		br := bufio.NewReader(body)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(body), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", contentEncoding)
+	}
+}
+
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// readErrorRecorder records the first error other than the end of the body
+// read from a body, such as the connection failing or timing out.
+type readErrorRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// limitedReader reads up to a limit and records whether the underlying
+// reader had more to read. Unlike an io.LimitedReader it stops at the limit
+// of the decompressed body, which protects against decompression bombs.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func newLimitedReader(r io.Reader, limit int64) *limitedReader {
+	return &limitedReader{r: r, remaining: limit}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, io.EOF
+	}
+
+	// read one byte past the limit to find out if there is more
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		l.exceeded = true
+		return n, io.EOF
+	}
+
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressBody(t *testing.T) {
+	compressors := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+
+	for encoding, compressor := range compressors {
+		t.Run("Test decompresses "+encoding, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := compressor(&buf)
+			w.Write([]byte("<html></html>"))
+			w.Close()
+
+			body, err := decompressBody(encoding, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decompressed, err := io.ReadAll(body)
+
+			assert.Nil(t, err)
+			assert.Equal(t, "<html></html>", string(decompressed))
+		})
+	}
+
+	t.Run("Test decompresses raw deflate", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		w.Write([]byte("<html></html>"))
+		w.Close()
+
+		body, err := decompressBody("deflate", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decompressed, err := io.ReadAll(body)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "<html></html>", string(decompressed))
+	})
+
+	t.Run("Test returns error on unsupported encoding", func(t *testing.T) {
+		_, err := decompressBody("compress", strings.NewReader(""))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLimitedReader(t *testing.T) {
+	t.Run("Test reads up to the limit", func(t *testing.T) {
+		r := newLimitedReader(strings.NewReader("abcdef"), 4)
+		b, err := io.ReadAll(r)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "abcd", string(b))
+		assert.True(t, r.exceeded)
+	})
+
+	t.Run("Test doesn't record reads of the exact limit as exceeded", func(t *testing.T) {
+		r := newLimitedReader(strings.NewReader("abcd"), 4)
+		b, err := io.ReadAll(r)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "abcd", string(b))
+		assert.False(t, r.exceeded)
+	})
+
+	t.Run("Test stops decompressing at the limit", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(bytes.Repeat([]byte{'a'}, 10*1024*1024))
+		w.Close()
+
+		body, err := decompressBody("gzip", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := newLimitedReader(body, 1024)
+		b, err := io.ReadAll(r)
+
+		assert.Nil(t, err)
+		assert.Len(t, b, 1024)
+		assert.True(t, r.exceeded)
+	})
+}
@@ -0,0 +1,249 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// SchemePolicy selects the schemes of the links in scope of a crawl.
+type SchemePolicy string
+
+const (
+	// SameScheme only follows links with the scheme of the seed.
+	SameScheme SchemePolicy = ""
+	// AnyScheme follows http and https links alike.
+	AnyScheme SchemePolicy = "any"
+	// UpgradeScheme rewrites http links to https before following them, so
+	// that sites that moved to https are crawled once.
+	UpgradeScheme SchemePolicy = "upgrade"
+)
+
+// ScopeConfig configures the links a crawler follows. Links out of scope
+// are recorded as external and never fetched. The zero config only follows
+// links with the scheme and host of a seed.
+type ScopeConfig struct {
+	// Hosts are followed along with the hosts of the seeds.
+	Hosts []string `json:"hosts,omitempty"`
+	// IncludeSubdomains follows the subdomains of the followed hosts.
+	IncludeSubdomains bool `json:"includeSubdomains,omitempty"`
+	// Aliases are groups of hosts serving the same site. Links to a host of
+	// a group are rewritten to the host of the first seed in the group if
+	// there is one, to the first host of the group otherwise.
+	Aliases [][]string   `json:"aliases,omitempty"`
+	Scheme  SchemePolicy `json:"scheme,omitempty"`
+	// PathPrefix only follows the links whose path starts with it, such as
+	// "/docs/".
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// Validate returns an error if a host, the scheme policy or the path prefix
+// is invalid.
+func (sc ScopeConfig) Validate() error {
+	hosts := append([]string(nil), sc.Hosts...)
+	for _, group := range sc.Aliases {
+		if len(group) < 2 {
+			return errors.New("alias groups must have at least two hosts")
+		}
+		hosts = append(hosts, group...)
+	}
+
+	for _, host := range hosts {
+		if !validHost(host) {
+			return fmt.Errorf("invalid host %q", host)
+		}
+	}
+
+	switch sc.Scheme {
+	case SameScheme, AnyScheme, UpgradeScheme:
+	default:
+		return fmt.Errorf("unsupported scheme policy %q", sc.Scheme)
+	}
+
+	if sc.PathPrefix != "" && !strings.HasPrefix(sc.PathPrefix, "/") {
+		return errors.New("pathPrefix must start with /")
+	}
+
+	return nil
+}
+
+// validHost reports whether the host is a host name or address, with an
+// optional port.
+func validHost(host string) bool {
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host && u.Hostname() != "" && u.User == nil
+}
+
+// ScopedSeeds returns the unique normalized seeds rewritten as the scope of
+// a crawl from them rewrites links, which are the urls they're crawled at.
+func ScopedSeeds(rawUrls []string, config ScopeConfig) ([]string, error) {
+	_, seeds, err := newSeedScope(rawUrls, config)
+	return seeds, err
+}
+
+// newSeedScope returns the scope of a crawl from the seeds and the unique
+// seeds rewritten by the scope.
+func newSeedScope(rawUrls []string, config ScopeConfig) (*scope, []string, error) {
+	if len(rawUrls) == 0 {
+		return nil, nil, errors.New("no seed to crawl")
+	}
+
+	var seedUrls []*url.URL
+	for _, rawUrl := range rawUrls {
+		seed, err := parseSeed(rawUrl)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		seedUrls = append(seedUrls, seed)
+	}
+
+	s := newScope(seedUrls, config)
+
+	var seeds []string
+	seen := make(map[string]struct{}, len(seedUrls))
+	for _, seed := range seedUrls {
+		s.canonicalize(seed)
+		if _, ok := seen[seed.String()]; ok {
+			continue
+		}
+		seen[seed.String()] = struct{}{}
+		seeds = append(seeds, seed.String())
+	}
+
+	return s, seeds, nil
+}
+
+func parseSeed(rawUrl string) (*url.URL, error) {
+	normalized, err := NormalizeUrl(rawUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Parse(normalized)
+}
+
+// scope decides which of the links of a crawl are followed.
+type scope struct {
+	schemes    map[string]struct{}
+	policy     SchemePolicy
+	hosts      map[string]struct{}
+	subdomains bool
+	// aliases maps the hosts of alias groups to the host they're rewritten to
+	aliases    map[string]string
+	pathPrefix string
+}
+
+func newScope(seeds []*url.URL, config ScopeConfig) *scope {
+	s := &scope{
+		schemes:    make(map[string]struct{}),
+		policy:     config.Scheme,
+		hosts:      make(map[string]struct{}),
+		subdomains: config.IncludeSubdomains,
+		aliases:    make(map[string]string),
+		pathPrefix: config.PathPrefix,
+	}
+
+	var seedHosts []string
+	for _, seed := range seeds {
+		scheme := seed.Scheme
+		if s.policy == UpgradeScheme && scheme == "http" {
+			scheme = "https"
+		}
+		s.schemes[scheme] = struct{}{}
+
+		seedHost := strings.ToLower(seed.Host)
+		s.hosts[seedHost] = struct{}{}
+		seedHosts = append(seedHosts, seedHost)
+	}
+
+	for _, host := range config.Hosts {
+		s.hosts[strings.ToLower(host)] = struct{}{}
+	}
+
+	for _, group := range config.Aliases {
+		canonical := strings.ToLower(group[0])
+	seedHosts:
+		for _, seedHost := range seedHosts {
+			for _, host := range group {
+				if strings.EqualFold(host, seedHost) {
+					canonical = seedHost
+					break seedHosts
+				}
+			}
+		}
+		for _, host := range group {
+			s.aliases[strings.ToLower(host)] = canonical
+		}
+	}
+
+	return s
+}
+
+// canonicalize rewrites the scheme and host of the url as configured.
+func (s *scope) canonicalize(u *url.URL) {
+	u.Host = strings.ToLower(u.Host)
+	if canonical, ok := s.aliases[u.Host]; ok {
+		u.Host = canonical
+	}
+
+	// urls with an explicit port other than the http one are left alone as
+	// the site may not serve https on it
+	if s.policy == UpgradeScheme && u.Scheme == "http" && (u.Port() == "" || u.Port() == "80") {
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+	}
+}
+
+// contains reports whether the canonicalized url is in scope.
+func (s *scope) contains(u *url.URL) bool {
+	switch s.policy {
+	case AnyScheme:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return false
+		}
+	default:
+		if _, ok := s.schemes[u.Scheme]; !ok {
+			return false
+		}
+	}
+
+	if !s.containsHost(u) {
+		return false
+	}
+
+	return s.pathPrefix == "" || strings.HasPrefix(u.Path, s.pathPrefix)
+}
+
+func (s *scope) containsHost(u *url.URL) bool {
+	if _, ok := s.hosts[u.Host]; ok {
+		return true
+	}
+
+	if !s.subdomains {
+		return false
+	}
+
+	hostname := u.Hostname()
+	if net.ParseIP(hostname) != nil {
+		return false
+	}
+
+	for host := range s.hosts {
+		parent, err := url.Parse("http://" + host)
+		if err != nil {
+			continue
+		}
+		if parent.Port() == u.Port() && strings.HasSuffix(hostname, "."+parent.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
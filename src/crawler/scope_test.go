@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeConfigValidate(t *testing.T) {
+	assert.Nil(t, ScopeConfig{}.Validate())
+	assert.Nil(t, ScopeConfig{
+		Hosts:      []string{"blog.example.com", "example.com:8080"},
+		Aliases:    [][]string{{"example.com", "www.example.com"}},
+		Scheme:     UpgradeScheme,
+		PathPrefix: "/docs/",
+	}.Validate())
+
+	assert.NotNil(t, ScopeConfig{Hosts: []string{"https://example.com"}}.Validate())
+	assert.NotNil(t, ScopeConfig{Hosts: []string{"example.com/docs"}}.Validate())
+	assert.NotNil(t, ScopeConfig{Aliases: [][]string{{"example.com"}}}.Validate())
+	assert.NotNil(t, ScopeConfig{Scheme: "ftp"}.Validate())
+	assert.NotNil(t, ScopeConfig{PathPrefix: "docs/"}.Validate())
+}
+
+func TestResolveLinksScope(t *testing.T) {
+	seed, _ := url.Parse("https://www.example.com/docs/")
+
+	resolve := func(config ScopeConfig, hrefs ...string) ([]string, []string) {
+		var links []Link
+		for _, href := range hrefs {
+			links = append(links, Link{Url: href, Kind: NavigationLink})
+		}
+
+		inScope, external := resolveLinks(seed.String(), newScope([]*url.URL{seed}, config), links, nil)
+
+		var inScopeUrls, externalUrls []string
+		for _, link := range inScope {
+			inScopeUrls = append(inScopeUrls, link.Url)
+		}
+		for _, link := range external {
+			assert.True(t, link.External)
+			externalUrls = append(externalUrls, link.Url)
+		}
+		return inScopeUrls, externalUrls
+	}
+
+	t.Run("Test only follows the scheme and host of the seed by default", func(t *testing.T) {
+		inScope, external := resolve(ScopeConfig{},
+			"page", "http://www.example.com/docs/a", "https://example.com/", "https://WWW.example.com/b",
+			"mailto:info@example.com")
+
+		assert.Equal(t, []string{"https://www.example.com/docs/page", "https://www.example.com/b"}, inScope)
+		assert.Equal(t, []string{"http://www.example.com/docs/a", "https://example.com/"}, external)
+	})
+
+	t.Run("Test follows hosts and subdomains", func(t *testing.T) {
+		inScope, external := resolve(ScopeConfig{Hosts: []string{"example.com"}, IncludeSubdomains: true},
+			"https://example.com/", "https://blog.example.com/", "https://example.com:8443/", "https://example.org/")
+
+		assert.Equal(t, []string{"https://example.com/", "https://blog.example.com/"}, inScope)
+		assert.Equal(t, []string{"https://example.com:8443/", "https://example.org/"}, external)
+	})
+
+	t.Run("Test rewrites aliases to the host of the seed", func(t *testing.T) {
+		inScope, external := resolve(ScopeConfig{Aliases: [][]string{{"example.com", "www.example.com"}, {"a.com", "b.com"}}},
+			"https://example.com/page", "https://www.example.com/page", "https://b.com/")
+
+		assert.Equal(t, []string{"https://www.example.com/page"}, inScope)
+		assert.Equal(t, []string{"https://a.com/"}, external)
+	})
+
+	t.Run("Test upgrades http links", func(t *testing.T) {
+		inScope, external := resolve(ScopeConfig{Scheme: UpgradeScheme},
+			"http://www.example.com/a", "http://www.example.com:80/b", "http://www.example.com:8080/c")
+
+		assert.Equal(t, []string{"https://www.example.com/a", "https://www.example.com/b"}, inScope)
+		assert.Equal(t, []string{"http://www.example.com:8080/c"}, external)
+	})
+
+	t.Run("Test follows any scheme", func(t *testing.T) {
+		inScope, _ := resolve(ScopeConfig{Scheme: AnyScheme}, "http://www.example.com/a", "https://www.example.com/a")
+
+		assert.Equal(t, []string{"http://www.example.com/a", "https://www.example.com/a"}, inScope)
+	})
+
+	t.Run("Test only follows the path prefix", func(t *testing.T) {
+		inScope, external := resolve(ScopeConfig{PathPrefix: "/docs/"}, "intro", "/docs", "/blog/")
+
+		assert.Equal(t, []string{"https://www.example.com/docs/intro"}, inScope)
+		assert.Equal(t, []string{"https://www.example.com/docs", "https://www.example.com/blog/"}, external)
+	})
+}
+
+func TestScopedSeeds(t *testing.T) {
+	seeds, err := ScopedSeeds([]string{"http://Example.com", "https://example.com/"}, ScopeConfig{Scheme: UpgradeScheme})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.com/"}, seeds)
+
+	seeds, err = ScopedSeeds(
+		[]string{"https://example.org/", "https://www.example.com/docs/", "https://example.com/"},
+		ScopeConfig{Aliases: [][]string{{"example.com", "www.example.com"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.org/", "https://www.example.com/docs/", "https://www.example.com/"}, seeds)
+
+	_, err = ScopedSeeds(nil, ScopeConfig{})
+	assert.NotNil(t, err)
+
+	_, err = ScopedSeeds([]string{"https://example.com/", "http://[::1"}, ScopeConfig{})
+	assert.NotNil(t, err)
+}
+
+func TestCrawlRecordsExternalLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs/":
+			w.Write([]byte(`<html><a href='intro'>intro</a><a href='/blog/'>blog</a><a href='https://example.com/'>example</a></html>`))
+		case "/docs/intro":
+			w.Write([]byte(`<html><a href='/blog/'>blog</a></html>`))
+		default:
+			t.Errorf("out of scope page %s was crawled", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	var mx sync.Mutex
+	var reported []Link
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{Scope: ScopeConfig{PathPrefix: "/docs/"}})
+	discoveredLinks, err := c.Crawl([]string{server.URL + "/docs/"}, func(links []Link) error {
+		mx.Lock()
+		defer mx.Unlock()
+		reported = append(reported, links...)
+		return nil
+	}, func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{server.URL + "/docs/intro": {}}, discoveredLinks)
+	assert.ElementsMatch(t, []Link{
+		{Url: server.URL + "/docs/intro", Kind: NavigationLink, Source: LinkedSource, Seed: server.URL + "/docs/"},
+		{Url: server.URL + "/blog/", Kind: NavigationLink, Source: LinkedSource, External: true, Seed: server.URL + "/docs/"},
+		{Url: "https://example.com/", Kind: NavigationLink, Source: LinkedSource, External: true, Seed: server.URL + "/docs/"},
+	}, reported)
+}
@@ -0,0 +1,164 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// MaxSitemaps is the maximum number of sitemaps fetched for a crawl,
+	// including the ones listed in sitemap indexes.
+	MaxSitemaps = 1000
+	// MaxSitemapSize is the maximum uncompressed size of a sitemap.
+	MaxSitemapSize = 50 * 1024 * 1024
+)
+
+// sitemapDocument holds either a <urlset> or a <sitemapindex>.
+type sitemapDocument struct {
+	XMLName  xml.Name
+	Urls     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// DiscoverSitemaps returns the sitemaps listed in the robots.txt of the site,
+// or the conventional /sitemap.xml if robots.txt doesn't list any.
+func DiscoverSitemaps(client *http.Client, siteUrl string) []string {
+	site, err := url.Parse(siteUrl)
+	if err != nil {
+		return nil
+	}
+
+	robotsUrl := site.ResolveReference(&url.URL{Path: "/robots.txt"})
+	sitemaps := robotsSitemaps(client, robotsUrl.String())
+
+	if len(sitemaps) == 0 {
+		sitemaps = []string{site.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()}
+	}
+
+	return sitemaps
+}
+
+// robotsSitemaps returns the urls of the Sitemap lines of a robots.txt.
+func robotsSitemaps(client *http.Client, robotsUrl string) []string {
+	resp, err := client.Get(robotsUrl)
+	if err != nil {
+		return nil
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var sitemaps []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, MaxSitemapSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		sep := strings.Index(line, ":")
+		if sep < 0 || !strings.EqualFold(strings.TrimSpace(line[:sep]), "sitemap") {
+			continue
+		}
+
+		if loc := strings.TrimSpace(line[sep+1:]); loc != "" {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+
+	return sitemaps
+}
+
+// FetchSitemapUrls fetches the sitemaps, following sitemap indexes, and
+// returns the page urls they list. Sitemaps that can't be fetched or parsed
+// are skipped.
+func FetchSitemapUrls(client *http.Client, sitemaps []string) []string {
+	var urls []string
+	visited := make(map[string]struct{})
+	queue := append([]string{}, sitemaps...)
+
+	for len(queue) > 0 && len(visited) < MaxSitemaps {
+		sitemapUrl := queue[0]
+		queue = queue[1:]
+
+		if _, ok := visited[sitemapUrl]; ok {
+			continue
+		}
+		visited[sitemapUrl] = struct{}{}
+
+		pageUrls, childSitemaps, err := fetchSitemap(client, sitemapUrl)
+		if err != nil {
+			continue
+		}
+
+		urls = append(urls, pageUrls...)
+		queue = append(queue, childSitemaps...)
+	}
+
+	return urls
+}
+
+func fetchSitemap(client *http.Client, sitemapUrl string) ([]string, []string, error) {
+	resp, err := client.Get(sitemapUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetching sitemap %s: %s", sitemapUrl, resp.Status)
+	}
+
+	return ParseSitemap(resp.Body)
+}
+
+// ParseSitemap parses a urlset or a sitemap index, which may be gzip
+// compressed, and returns the page urls and the child sitemap urls it lists.
+func ParseSitemap(r io.Reader) ([]string, []string, error) {
+	br := bufio.NewReader(r)
+
+	// gzip compressed sitemaps are detected by their magic number as they
+	// are often served without a content encoding
+	var body io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gr.Close()
+		body = gr
+	}
+
+	var doc sitemapDocument
+	if err := newXMLDecoder(io.LimitReader(body, MaxSitemapSize)).Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, nil, fmt.Errorf("unexpected sitemap root element %q", doc.XMLName.Local)
+	}
+
+	return entryLocs(doc.Urls), entryLocs(doc.Sitemaps), nil
+}
+
+func entryLocs(entries []sitemapEntry) []string {
+	var locs []string
+	for _, e := range entries {
+		if loc := strings.TrimSpace(e.Loc); loc != "" {
+			locs = append(locs, loc)
+		}
+	}
+	return locs
+}
@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSitemap(t *testing.T) {
+	t.Run("Test parses urlset", func(t *testing.T) {
+		urls, sitemaps, err := ParseSitemap(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+			<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc> https://example.com/ </loc><lastmod>2022-01-01</lastmod></url>
+				<url><loc>https://example.com/about</loc></url>
+				<url><loc></loc></url>
+			</urlset>`))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"https://example.com/", "https://example.com/about"}, urls)
+		assert.Empty(t, sitemaps)
+	})
+
+	t.Run("Test parses gzipped sitemap index", func(t *testing.T) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<sitemap><loc>https://example.com/sitemap-1.xml.gz</loc></sitemap>
+		</sitemapindex>`))
+		gw.Close()
+
+		urls, sitemaps, err := ParseSitemap(&buf)
+
+		assert.Nil(t, err)
+		assert.Empty(t, urls)
+		assert.Equal(t, []string{"https://example.com/sitemap-1.xml.gz"}, sitemaps)
+	})
+
+	t.Run("Test parses sitemap in declared encoding", func(t *testing.T) {
+		// "é" is a single 0xe9 byte in ISO-8859-1
+		urls, _, err := ParseSitemap(strings.NewReader("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>" +
+			"<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">" +
+			"<url><loc>https://example.com/caf\xe9</loc></url>" +
+			"</urlset>"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"https://example.com/café"}, urls)
+	})
+
+	t.Run("Test returns error on unexpected root element", func(t *testing.T) {
+		_, _, err := ParseSitemap(strings.NewReader(`<html><body></body></html>`))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDiscoverSitemaps(t *testing.T) {
+	t.Run("Test reads sitemaps from robots.txt", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("User-agent: *\nDisallow: /private\nsitemap: https://example.com/a.xml\nSitemap:https://example.com/b.xml\n"))
+		}))
+		defer server.Close()
+
+		sitemaps := DiscoverSitemaps(&http.Client{}, server.URL+"/docs/")
+
+		assert.Equal(t, []string{"https://example.com/a.xml", "https://example.com/b.xml"}, sitemaps)
+	})
+
+	t.Run("Test falls back to sitemap.xml", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		sitemaps := DiscoverSitemaps(&http.Client{}, server.URL+"/docs/")
+
+		assert.Equal(t, []string{server.URL + "/sitemap.xml"}, sitemaps)
+	})
+}
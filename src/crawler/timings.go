@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings break down the time the fetch of a page took. Redirects are
+// followed, so they are the timings of the request that returned the page.
+// The phases a request skipped, such as the dns lookup and connection of a
+// reused connection, are zero.
+type Timings struct {
+	// StartedAt is the time the request started waiting for a connection.
+	StartedAt time.Time
+	DNS       time.Duration
+	// Connect is the time taken to open the tcp connection, without its
+	// tls handshake.
+	Connect time.Duration
+	TLS     time.Duration
+	// Send is the time taken to write the request once connected.
+	Send time.Duration
+	// TimeToFirstByte is the time waited for the response once the request
+	// was written.
+	TimeToFirstByte time.Duration
+	// Download is the time taken to read the body once the first byte was
+	// received, up to the last read of it, for as much of the body as was
+	// read.
+	Download time.Duration
+}
+
+// fetchTrace captures the timings of a fetch through an httptrace. Its
+// callbacks may be called concurrently, such as when dialing several
+// addresses of a host.
+type fetchTrace struct {
+	mx      sync.Mutex
+	timings Timings
+	marks   traceMarks
+}
+
+// traceMarks are the times the phases of a request started or ended at.
+type traceMarks struct {
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	lastRead     time.Time
+}
+
+func (t *fetchTrace) record(f func(now time.Time)) {
+	now := time.Now()
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	f(now)
+}
+
+func (t *fetchTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		// each request of a redirect chain starts over
+		GetConn: func(string) {
+			t.record(func(now time.Time) {
+				t.timings = Timings{StartedAt: now}
+				t.marks = traceMarks{}
+			})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func(now time.Time) { t.marks.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func(now time.Time) { t.timings.DNS = now.Sub(t.marks.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			t.record(func(now time.Time) {
+				if t.marks.connectStart.IsZero() {
+					t.marks.connectStart = now
+				}
+			})
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			t.record(func(now time.Time) {
+				if err == nil {
+					t.timings.Connect = now.Sub(t.marks.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			t.record(func(now time.Time) { t.marks.tlsStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(func(now time.Time) { t.timings.TLS = now.Sub(t.marks.tlsStart) })
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			t.record(func(now time.Time) { t.marks.gotConn = now })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.record(func(now time.Time) {
+				t.marks.wroteRequest = now
+				t.timings.Send = now.Sub(t.marks.gotConn)
+			})
+		},
+		GotFirstResponseByte: func() {
+			t.record(func(now time.Time) {
+				t.marks.firstByte = now
+				t.timings.TimeToFirstByte = now.Sub(t.marks.wroteRequest)
+			})
+		},
+	}
+}
+
+// body returns the body of the response, recording when it was last read
+// from so that the time taken to process it isn't counted as downloading it.
+func (t *fetchTrace) body(r io.Reader) io.Reader {
+	return &tracedBody{r: r, trace: t}
+}
+
+// done returns the timings once the body was read.
+func (t *fetchTrace) done() *Timings {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	timings := t.timings
+	if !t.marks.firstByte.IsZero() && t.marks.lastRead.After(t.marks.firstByte) {
+		timings.Download = t.marks.lastRead.Sub(t.marks.firstByte)
+	}
+	return &timings
+}
+
+type tracedBody struct {
+	r     io.Reader
+	trace *fetchTrace
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.trace.record(func(now time.Time) { b.trace.marks.lastRead = now })
+	return n, err
+}
@@ -0,0 +1,410 @@
+package crawler
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultMaxUrlLength is the maximum length of a followed url unless
+	// configured otherwise.
+	DefaultMaxUrlLength = 2048
+	// DefaultMaxPathDepth is the maximum number of segments of the path of
+	// a followed url unless configured otherwise.
+	DefaultMaxPathDepth = 20
+	// DefaultMaxRepeatedSegments is the maximum number of times a run of
+	// path segments is repeated in a row, such as /a/b/a/b, unless
+	// configured otherwise.
+	DefaultMaxRepeatedSegments = 2
+	// MaxTrapUrls is the maximum number of urls listed for a trap.
+	MaxTrapUrls = 100
+)
+
+// DefaultSessionParams are the names of the parameters carrying session
+// ids, which give every visit of a page a new url.
+var DefaultSessionParams = []string{
+	"jsessionid",
+	"phpsessid",
+	"aspsessionid",
+	"sessionid",
+	"session_id",
+	"sid",
+	"cfid",
+	"cftoken",
+	"oscsid",
+	"zenid",
+}
+
+// TrapReason tells which heuristic found a crawler trap.
+type TrapReason string
+
+const (
+	UrlLengthTrap        TrapReason = "urlLength"
+	PathDepthTrap        TrapReason = "pathDepth"
+	RepeatedSegmentsTrap TrapReason = "repeatedSegments"
+	QueryVariantsTrap    TrapReason = "queryVariants"
+	// SessionIdTrap links are followed without their session id.
+	SessionIdTrap TrapReason = "sessionId"
+)
+
+// TrapConfig configures the heuristics detecting crawler traps, such as
+// calendars and faceted search generating infinitely many urls. Links found
+// in a trap aren't followed, except for session ids, which are removed from
+// the links. Limits that aren't set use their default.
+type TrapConfig struct {
+	MaxUrlLength        int `json:"maxUrlLength,omitempty"`
+	MaxPathDepth        int `json:"maxPathDepth,omitempty"`
+	MaxRepeatedSegments int `json:"maxRepeatedSegments,omitempty"`
+	// MaxQueryVariants is the maximum number of query strings followed for
+	// a path. As sites commonly list their pages by query, such as with
+	// ?page=n, a path has no limit unless it's set.
+	MaxQueryVariants int `json:"maxQueryVariants,omitempty"`
+	// SessionParams are detected along with the DefaultSessionParams.
+	SessionParams []string `json:"sessionParams,omitempty"`
+	// Disabled follows every link in scope.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Validate returns an error if a limit is negative or a session parameter
+// is empty.
+func (tc TrapConfig) Validate() error {
+	if tc.MaxUrlLength < 0 || tc.MaxPathDepth < 0 || tc.MaxRepeatedSegments < 0 || tc.MaxQueryVariants < 0 {
+		return errors.New("trap limits must not be negative")
+	}
+
+	for _, param := range tc.SessionParams {
+		if strings.TrimSpace(param) == "" {
+			return errors.New("session params must not be empty")
+		}
+	}
+	return nil
+}
+
+func (tc TrapConfig) maxUrlLength() int {
+	if tc.MaxUrlLength > 0 {
+		return tc.MaxUrlLength
+	}
+	return DefaultMaxUrlLength
+}
+
+func (tc TrapConfig) maxPathDepth() int {
+	if tc.MaxPathDepth > 0 {
+		return tc.MaxPathDepth
+	}
+	return DefaultMaxPathDepth
+}
+
+func (tc TrapConfig) maxRepeatedSegments() int {
+	if tc.MaxRepeatedSegments > 0 {
+		return tc.MaxRepeatedSegments
+	}
+	return DefaultMaxRepeatedSegments
+}
+
+// Trap is a pattern of urls found to be a crawler trap.
+type Trap struct {
+	// Pattern matches the trapped urls, with * matching any text.
+	Pattern string
+	Reason  TrapReason
+	// Count is the number of links of the pattern that weren't followed as
+	// found, or that were followed without their session id.
+	Count int
+	// Example is the first link of the pattern found.
+	Example string
+	// Urls are the distinct links counted, up to MaxTrapUrls.
+	Urls []string
+}
+
+// trapDetector checks the links found during a crawl against the trap
+// heuristics. It's safe for concurrent use.
+type trapDetector struct {
+	config        TrapConfig
+	sessionParams map[string]struct{}
+	pathParam     *regexp.Regexp
+
+	mx *sync.Mutex
+	// queryVariants are the query strings followed for each path, if their
+	// number is limited
+	queryVariants map[string]map[string]struct{}
+	traps         map[trapKey]*Trap
+}
+
+type trapKey struct {
+	pattern string
+	reason  TrapReason
+}
+
+func newTrapDetector(config TrapConfig) *trapDetector {
+	d := &trapDetector{
+		config:        config,
+		sessionParams: make(map[string]struct{}),
+		mx:            &sync.Mutex{},
+		queryVariants: make(map[string]map[string]struct{}),
+		traps:         make(map[trapKey]*Trap),
+	}
+
+	var names []string
+	for _, param := range append(append([]string(nil), DefaultSessionParams...), config.SessionParams...) {
+		param = strings.ToLower(strings.TrimSpace(param))
+		d.sessionParams[param] = struct{}{}
+		names = append(names, regexp.QuoteMeta(param))
+	}
+	// session ids may also be path parameters, as in /page;jsessionid=1
+	d.pathParam = regexp.MustCompile(`(?i);(` + strings.Join(names, "|") + `)=[^/;?]*`)
+
+	return d
+}
+
+// filter returns the links to follow, without their session ids, and records
+// the traps the other ones were found in.
+func (d *trapDetector) filter(links []Link) []Link {
+	if d.config.Disabled {
+		return links
+	}
+
+	var followed []Link
+	seen := make(map[string]struct{}, len(links))
+	for _, link := range links {
+		u, ok := d.check(link.Url)
+		if !ok {
+			continue
+		}
+
+		// removing session ids may make links the same
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+
+		if u != link.Url {
+			if link.OriginalUrl == "" {
+				link.OriginalUrl = link.Url
+			}
+			if link.FetchUrl != "" {
+				link.FetchUrl = d.withoutSessionIds(link.FetchUrl)
+			}
+		}
+
+		link.Url = u
+		followed = append(followed, link)
+	}
+	return followed
+}
+
+// withoutSessionIds returns the url without its session id parameters.
+func (d *trapDetector) withoutSessionIds(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	if _, ok := d.removeSessionIds(u); !ok {
+		return rawUrl
+	}
+
+	normalized, err := NormalizeUrl(u.String())
+	if err != nil {
+		return rawUrl
+	}
+	return normalized
+}
+
+// check returns the url to follow for the link, which is the link without
+// its session ids, or false if the link is in a trap.
+func (d *trapDetector) check(rawUrl string) (string, bool) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl, true
+	}
+
+	site := u.Scheme + "://" + u.Host
+	if param, ok := d.removeSessionIds(u); ok {
+		normalized, err := NormalizeUrl(u.String())
+		if err != nil {
+			return rawUrl, false
+		}
+		d.record(site+"/*"+param+"=*", SessionIdTrap, rawUrl)
+		rawUrl = normalized
+	}
+
+	if len(rawUrl) > d.config.maxUrlLength() {
+		pattern := site + u.EscapedPath() + "?*"
+		if u.RawQuery == "" {
+			pattern = site + u.EscapedPath()[:strings.LastIndex(u.EscapedPath(), "/")+1] + "*"
+		}
+		d.record(pattern, UrlLengthTrap, rawUrl)
+		return rawUrl, false
+	}
+
+	segments := pathSegments(u.EscapedPath())
+	if len(segments) > d.config.maxPathDepth() {
+		d.record(site+segmentsPrefix(segments, d.config.maxPathDepth())+"*", PathDepthTrap, rawUrl)
+		return rawUrl, false
+	}
+
+	if end := repeatedSegmentsEnd(segments, d.config.maxRepeatedSegments()); end > 0 {
+		d.record(site+segmentsPrefix(segments, end)+"*", RepeatedSegmentsTrap, rawUrl)
+		return rawUrl, false
+	}
+
+	if u.RawQuery != "" && d.config.MaxQueryVariants > 0 && !d.addQueryVariant(site+u.EscapedPath(), u.RawQuery) {
+		d.record(site+u.EscapedPath()+"?*", QueryVariantsTrap, rawUrl)
+		return rawUrl, false
+	}
+
+	return rawUrl, true
+}
+
+// removeSessionIds removes the session id parameters of the url and returns
+// the first one removed, as ;name for path parameters and ?name for query
+// ones.
+func (d *trapDetector) removeSessionIds(u *url.URL) (string, bool) {
+	var removed string
+
+	if match := d.pathParam.FindStringSubmatch(u.EscapedPath()); match != nil {
+		removed = ";" + strings.ToLower(match[1])
+		if path, err := url.Parse(d.pathParam.ReplaceAllString(u.EscapedPath(), "")); err == nil {
+			u.Path = path.Path
+			u.RawPath = path.RawPath
+		}
+	}
+
+	if u.RawQuery != "" {
+		var kept []string
+		for _, pair := range strings.Split(u.RawQuery, "&") {
+			name := paramName(pair)
+			if _, ok := d.sessionParams[name]; ok {
+				if removed == "" {
+					removed = "?" + name
+				}
+				continue
+			}
+			kept = append(kept, pair)
+		}
+		u.RawQuery = strings.Join(kept, "&")
+	}
+
+	return removed, removed != ""
+}
+
+// addQueryVariant adds the query string to the variants of the path and
+// reports whether it's followed.
+func (d *trapDetector) addQueryVariant(path string, query string) bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	variants, ok := d.queryVariants[path]
+	if !ok {
+		variants = make(map[string]struct{})
+		d.queryVariants[path] = variants
+	}
+
+	if _, ok := variants[query]; ok {
+		return true
+	}
+
+	if len(variants) >= d.config.MaxQueryVariants {
+		return false
+	}
+
+	variants[query] = struct{}{}
+	return true
+}
+
+func (d *trapDetector) record(pattern string, reason TrapReason, rawUrl string) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	key := trapKey{pattern: pattern, reason: reason}
+	trap, ok := d.traps[key]
+	if !ok {
+		trap = &Trap{Pattern: pattern, Reason: reason, Example: rawUrl}
+		d.traps[key] = trap
+	}
+	trap.Count++
+
+	if len(trap.Urls) >= MaxTrapUrls {
+		return
+	}
+	for _, u := range trap.Urls {
+		if u == rawUrl {
+			return
+		}
+	}
+	trap.Urls = append(trap.Urls, rawUrl)
+}
+
+// found returns the traps found, sorted by pattern.
+func (d *trapDetector) found() []Trap {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	traps := make([]Trap, 0, len(d.traps))
+	for _, trap := range d.traps {
+		found := *trap
+		found.Urls = append([]string(nil), trap.Urls...)
+		traps = append(traps, found)
+	}
+
+	sort.Slice(traps, func(i, j int) bool {
+		if traps[i].Pattern != traps[j].Pattern {
+			return traps[i].Pattern < traps[j].Pattern
+		}
+		return traps[i].Reason < traps[j].Reason
+	})
+	return traps
+}
+
+// pathSegments returns the segments of the path, ignoring empty ones.
+func pathSegments(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// segmentsPrefix returns the path of the first n segments followed by a
+// slash.
+func segmentsPrefix(segments []string, n int) string {
+	if n == 0 {
+		return "/"
+	}
+	return "/" + strings.Join(segments[:n], "/") + "/"
+}
+
+// repeatedSegmentsEnd returns the number of segments up to the first run of
+// segments repeated more than max times in a row, or 0 if there is none.
+func repeatedSegmentsEnd(segments []string, max int) int {
+	for start := range segments {
+		for length := 1; start+length*(max+1) <= len(segments); length++ {
+			repeated := 1
+			for next := start + length; next+length <= len(segments); next += length {
+				if !equalSegments(segments[start:start+length], segments[next:next+length]) {
+					break
+				}
+				repeated++
+			}
+
+			if repeated > max {
+				return start + length*(max+1)
+			}
+		}
+	}
+	return 0
+}
+
+func equalSegments(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
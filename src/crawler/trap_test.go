@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrapConfigValidate(t *testing.T) {
+	assert.Nil(t, TrapConfig{}.Validate())
+	assert.Nil(t, TrapConfig{MaxUrlLength: 512, MaxQueryVariants: 10, SessionParams: []string{"visit"}}.Validate())
+
+	assert.NotNil(t, TrapConfig{MaxPathDepth: -1}.Validate())
+	assert.NotNil(t, TrapConfig{SessionParams: []string{" "}}.Validate())
+}
+
+func TestTrapDetector(t *testing.T) {
+
+	filter := func(d *trapDetector, urls ...string) []string {
+		var links []Link
+		for _, u := range urls {
+			links = append(links, Link{Url: u, Kind: NavigationLink})
+		}
+
+		var followed []string
+		for _, link := range d.filter(links) {
+			followed = append(followed, link.Url)
+		}
+		return followed
+	}
+
+	t.Run("Test skips long urls", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{MaxUrlLength: 40})
+		long := "https://example.com/search?q=" + strings.Repeat("a", 20)
+
+		followed := filter(d, "https://example.com/search?q=a", long)
+
+		assert.Equal(t, []string{"https://example.com/search?q=a"}, followed)
+		assert.Equal(t, []Trap{{Pattern: "https://example.com/search?*", Reason: UrlLengthTrap, Count: 1, Example: long, Urls: []string{long}}}, d.found())
+	})
+
+	t.Run("Test skips deep paths", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{MaxPathDepth: 3})
+
+		followed := filter(d, "https://example.com/a/b/c", "https://example.com/a/b/c/d/e")
+
+		assert.Equal(t, []string{"https://example.com/a/b/c"}, followed)
+		assert.Equal(t, []Trap{{Pattern: "https://example.com/a/b/c/*", Reason: PathDepthTrap, Count: 1, Example: "https://example.com/a/b/c/d/e", Urls: []string{"https://example.com/a/b/c/d/e"}}}, d.found())
+	})
+
+	t.Run("Test skips repeated path segments", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{})
+
+		followed := filter(d,
+			"https://example.com/2022/01/01/post",
+			"https://example.com/x/a/b/a/b/",
+			"https://example.com/x/a/b/a/b/a/b/",
+			"https://example.com/x/a/b/a/b/a/b/a/b",
+			"https://example.com/docs/docs/docs/")
+
+		assert.Equal(t, []string{"https://example.com/2022/01/01/post", "https://example.com/x/a/b/a/b/"}, followed)
+		assert.Equal(t, []Trap{
+			{
+				Pattern: "https://example.com/docs/docs/docs/*",
+				Reason:  RepeatedSegmentsTrap,
+				Count:   1,
+				Example: "https://example.com/docs/docs/docs/",
+				Urls:    []string{"https://example.com/docs/docs/docs/"},
+			},
+			{
+				Pattern: "https://example.com/x/a/b/a/b/a/b/*",
+				Reason:  RepeatedSegmentsTrap,
+				Count:   2,
+				Example: "https://example.com/x/a/b/a/b/a/b/",
+				Urls:    []string{"https://example.com/x/a/b/a/b/a/b/", "https://example.com/x/a/b/a/b/a/b/a/b"},
+			},
+		}, d.found())
+	})
+
+	t.Run("Test limits query variants per path", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{MaxQueryVariants: 2})
+
+		followed := filter(d,
+			"https://example.com/shop?color=red",
+			"https://example.com/shop?color=blue",
+			"https://example.com/shop?color=green",
+			"https://example.com/other?color=green")
+		// variants already followed are still followed
+		followed = append(followed, filter(d, "https://example.com/shop?color=red")...)
+
+		assert.Equal(t, []string{
+			"https://example.com/shop?color=red",
+			"https://example.com/shop?color=blue",
+			"https://example.com/other?color=green",
+			"https://example.com/shop?color=red",
+		}, followed)
+		assert.Equal(t, []Trap{
+			{
+				Pattern: "https://example.com/shop?*",
+				Reason:  QueryVariantsTrap,
+				Count:   1,
+				Example: "https://example.com/shop?color=green",
+				Urls:    []string{"https://example.com/shop?color=green"},
+			},
+		}, d.found())
+	})
+
+	t.Run("Test doesn't limit query variants by default", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{})
+
+		var urls []string
+		for page := 1; page <= 500; page++ {
+			urls = append(urls, fmt.Sprintf("https://example.com/blog?page=%d", page))
+		}
+
+		assert.Equal(t, urls, filter(d, urls...))
+		assert.Len(t, d.found(), 0)
+	})
+
+	t.Run("Test lists up to max urls of a trap", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{MaxPathDepth: 1})
+
+		var urls []string
+		for i := 0; i <= MaxTrapUrls; i++ {
+			urls = append(urls, fmt.Sprintf("https://example.com/a/%d", i))
+		}
+		filter(d, urls...)
+		// a url found again is counted but not listed twice
+		filter(d, urls[0])
+
+		traps := d.found()
+		if assert.Len(t, traps, 1) {
+			assert.Equal(t, MaxTrapUrls+2, traps[0].Count)
+			assert.Equal(t, urls[:MaxTrapUrls], traps[0].Urls)
+		}
+	})
+
+	t.Run("Test follows links without session ids", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{SessionParams: []string{"Visit"}})
+
+		followed := filter(d,
+			"https://example.com/a?PHPSESSID=1&page=2",
+			"https://example.com/a?page=2&phpsessid=2",
+			"https://example.com/b;jsessionid=ABC?x=1",
+			"https://example.com/c?visit=3")
+
+		assert.Equal(t, []string{"https://example.com/a?page=2", "https://example.com/b?x=1", "https://example.com/c"}, followed)
+		assert.Equal(t, []Trap{
+			{
+				Pattern: "https://example.com/*;jsessionid=*",
+				Reason:  SessionIdTrap,
+				Count:   1,
+				Example: "https://example.com/b;jsessionid=ABC?x=1",
+				Urls:    []string{"https://example.com/b;jsessionid=ABC?x=1"},
+			},
+			{
+				Pattern: "https://example.com/*?phpsessid=*",
+				Reason:  SessionIdTrap,
+				Count:   2,
+				Example: "https://example.com/a?PHPSESSID=1&page=2",
+				Urls:    []string{"https://example.com/a?PHPSESSID=1&page=2", "https://example.com/a?page=2&phpsessid=2"},
+			},
+			{
+				Pattern: "https://example.com/*?visit=*",
+				Reason:  SessionIdTrap,
+				Count:   1,
+				Example: "https://example.com/c?visit=3",
+				Urls:    []string{"https://example.com/c?visit=3"},
+			},
+		}, d.found())
+	})
+
+	t.Run("Test follows every link if disabled", func(t *testing.T) {
+		d := newTrapDetector(TrapConfig{Disabled: true, MaxPathDepth: 1})
+
+		followed := filter(d, "https://example.com/a/b/c?sid=1")
+
+		assert.Equal(t, []string{"https://example.com/a/b/c?sid=1"}, followed)
+		assert.Len(t, d.found(), 0)
+	})
+}
+
+func TestCrawlStopsAtCalendarTrap(t *testing.T) {
+	// every month of the calendar links to the next one
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><a href="/calendar?month=0">calendar</a></html>`))
+	})
+	mux.HandleFunc("/calendar", func(w http.ResponseWriter, r *http.Request) {
+		var month int
+		fmt.Sscan(r.URL.Query().Get("month"), &month)
+		fmt.Fprintf(w, `<html><a href="/calendar?month=%d">next</a></html>`, month+1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{Traps: TrapConfig{MaxQueryVariants: 5}})
+
+	var mx sync.Mutex
+	var crawled int
+	_, err := c.Crawl(
+		[]string{server.URL},
+		func(links []Link) error { return nil },
+		func(page CrawledPage) error {
+			mx.Lock()
+			defer mx.Unlock()
+			crawled++
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 6, crawled)
+	assert.Equal(t, []Trap{{
+		Pattern: server.URL + "/calendar?*",
+		Reason:  QueryVariantsTrap,
+		Count:   1,
+		Example: server.URL + "/calendar?month=5",
+		Urls:    []string{server.URL + "/calendar?month=5"},
+	}}, c.Traps())
+}
+
+func TestCrawlSkipsSitemapLinksInTraps(t *testing.T) {
+	var mx sync.Mutex
+	var requested []string
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nSitemap: %s/sitemap.xml\n", server.URL)
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>%[1]s/a/b/c</loc></url>
+				<url><loc>%[1]s/a/b/c/d/e</loc></url>
+			</urlset>`, server.URL)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requested = append(requested, r.URL.Path)
+		mx.Unlock()
+		w.Write([]byte(`<html></html>`))
+	})
+
+	c := NewCrawler(&http.Client{}, NewPolicyExecutor("//a[@href]"), CrawlOptions{UseSitemaps: true, Traps: TrapConfig{MaxPathDepth: 3}})
+
+	var discovered []string
+	_, err := c.Crawl(
+		[]string{server.URL + "/"},
+		func(links []Link) error {
+			mx.Lock()
+			defer mx.Unlock()
+			for _, link := range links {
+				discovered = append(discovered, link.Url)
+			}
+			return nil
+		},
+		func(page CrawledPage) error { return nil })
+
+	assert.Nil(t, err)
+	assert.NotContains(t, discovered, server.URL+"/a/b/c/d/e")
+	assert.ElementsMatch(t, []string{"/", "/a/b/c"}, requested)
+	assert.Equal(t, []Trap{{
+		Pattern: server.URL + "/a/b/c/*",
+		Reason:  PathDepthTrap,
+		Count:   1,
+		Example: server.URL + "/a/b/c/d/e",
+		Urls:    []string{server.URL + "/a/b/c/d/e"},
+	}}, c.Traps())
+}
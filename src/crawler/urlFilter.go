@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type URLFilterType string
+
+const (
+	GlobURLFilter   URLFilterType = "glob"
+	RegexURLFilter  URLFilterType = "regex"
+	PrefixURLFilter URLFilterType = "prefix"
+)
+
+// URLFilter matches resolved links. Glob and prefix patterns starting with a
+// slash are matched against the path of the link, every other pattern is
+// matched against the whole link. In globs * matches any sequence of
+// characters, including slashes, and ? matches a single character.
+type URLFilter struct {
+	Type    URLFilterType `json:"type"`
+	Pattern string        `json:"pattern"`
+}
+
+// URLFilters decide which resolved links are followed. A link is allowed if
+// its scheme is in Schemes, it doesn't match any of the Exclude filters and it
+// matches one of the Include filters. Empty lists don't restrict links.
+type URLFilters struct {
+	Include []URLFilter `json:"include,omitempty"`
+	Exclude []URLFilter `json:"exclude,omitempty"`
+	Schemes []string    `json:"schemes,omitempty"`
+}
+
+type urlMatcher func(link *url.URL) bool
+
+func compileURLFilters(filters []URLFilter) ([]urlMatcher, error) {
+	var matchers []urlMatcher
+	for _, f := range filters {
+		m, err := compileURLFilter(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func compileURLFilter(f URLFilter) (urlMatcher, error) {
+	if f.Pattern == "" {
+		return nil, fmt.Errorf("empty %s filter pattern", f.Type)
+	}
+
+	switch f.Type {
+	case PrefixURLFilter:
+		return func(link *url.URL) bool {
+			return strings.HasPrefix(filterTarget(link, f.Pattern), f.Pattern)
+		}, nil
+	case GlobURLFilter:
+		re, err := regexp.Compile(globToRegexp(f.Pattern))
+		if err != nil {
+			return nil, err
+		}
+		return func(link *url.URL) bool {
+			return re.MatchString(filterTarget(link, f.Pattern))
+		}, nil
+	case RegexURLFilter:
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(link *url.URL) bool {
+			return re.MatchString(link.String())
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported url filter type %q", f.Type)
+	}
+}
+
+// filterTarget returns the part of the link a glob or prefix pattern is
+// matched against.
+func filterTarget(link *url.URL, pattern string) string {
+	if strings.HasPrefix(pattern, "/") {
+		return link.Path
+	}
+	return link.String()
+}
+
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func matchesAny(matchers []urlMatcher, link *url.URL) bool {
+	for _, m := range matchers {
+		if m(link) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,28 +4,35 @@ import (
 	"io"
 
 	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
 )
 
 type XPathPolicyExecutor struct {
 	Policy string
+	// Attribute holds the link of the matched nodes, if it isn't set links
+	// are read from all resource attributes.
+	Attribute string
 }
 
-func (pe *XPathPolicyExecutor) Execute(rc io.ReadCloser) ([]string, error) {
+func (pe *XPathPolicyExecutor) Execute(rc io.ReadCloser) (Document, error) {
 
-	var output []string
 	defer rc.Close()
 	doc, err := htmlquery.Parse(rc)
 
 	if err != nil {
-		return output, err
+		return Document{}, err
 	}
 
+	return newDocument(doc, pe.extract(doc)), nil
+}
+
+func (pe *XPathPolicyExecutor) extract(doc *html.Node) []Link {
+	var output []Link
 	nodes := htmlquery.Find(doc, pe.Policy)
 	for _, node := range nodes {
-		href := htmlquery.SelectAttr(node, "href")
-		output = append(output, href)
+		output = append(output, extractLinks(node, pe.Attribute)...)
 	}
-	return output, nil
+	return output
 }
 
 func NewPolicyExecutor(policy string) *XPathPolicyExecutor {
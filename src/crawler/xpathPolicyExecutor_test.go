@@ -35,8 +35,11 @@ func (xpe *XpathPolicyExecutorTest) testFindNodesWithPolicyAndReturnsHrefValues(
 	result, err := xpe.policyExecutor.Execute(readerCloser)
 
 	assert.Nil(t, err)
-	assert.Len(t, result, 2)
+	assert.Len(t, result.Links, 2)
 
-	expectedList := []string{"test", "test2"}
-	assert.Equal(t, expectedList, result)
+	expectedList := []Link{
+		{Url: "test", Kind: NavigationLink},
+		{Url: "test2", Kind: NavigationLink},
+	}
+	assert.Equal(t, expectedList, result.Links)
 }
@@ -10,11 +10,12 @@ func _() {
 	var x [1]struct{}
 	_ = x[InProgress-1]
 	_ = x[Completed-2]
+	_ = x[Failed-3]
 }
 
-const _CrawlJobStatus_name = "InProgressCompleted"
+const _CrawlJobStatus_name = "InProgressCompletedFailed"
 
-var _CrawlJobStatus_index = [...]uint8{0, 10, 19}
+var _CrawlJobStatus_index = [...]uint8{0, 10, 19, 25}
 
 func (i CrawlJobStatus) String() string {
 	i -= 1
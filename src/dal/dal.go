@@ -3,10 +3,149 @@ package dal
 //go:generate mockgen -destination=../mocks/mock_dal.go -package=mocks github.com/alicansa/go-linkcrawler/dal LinkRepository,CrawlJobRepository
 //go:generate stringer -type=CrawlJobStatus
 
+import "context"
+
 type Link struct {
-	Url        string `json:"url"`
-	LinkId     int    `json:"linkId"`
-	CrawlJobId int    `json:"crawlJobId"`
+	Url          string  `json:"url"`
+	LinkId       int     `json:"linkId"`
+	CrawlJobId   int     `json:"crawlJobId"`
+	Kind         string  `json:"kind"`
+	StatusCode   int     `json:"statusCode"`
+	Canonical    string  `json:"canonical"`
+	NoIndex      bool    `json:"noIndex"`
+	NoFollow     bool    `json:"noFollow"`
+	ClickDepth   int     `json:"clickDepth"`
+	PageRank     float64 `json:"pageRank"`
+	InboundLinks int     `json:"inboundLinks"`
+	Orphan       bool    `json:"orphan"`
+	InSitemap    bool    `json:"inSitemap"`
+	Linked       bool    `json:"linked"`
+	ContentType  string  `json:"contentType"`
+	// LastModified is the RFC 3339 Last-Modified time of the page, if known.
+	LastModified string `json:"lastModified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	// NotModified is set if the page wasn't modified since the crawl job
+	// the job recrawled, whose crawl of the page was kept.
+	NotModified bool `json:"notModified,omitempty"`
+	// ContentHash is the hex encoded hash of the body of parsed pages.
+	ContentHash string `json:"contentHash,omitempty"`
+	// SimHash is the hex encoded SimHash of the visible text of html pages.
+	SimHash string `json:"simHash,omitempty"`
+	// Parsed is set if links were extracted from the page, which isn't the
+	// case for content types the crawler doesn't parse.
+	Parsed  bool   `json:"parsed"`
+	Charset string `json:"charset"`
+	// SizeLimit is "truncated" or "oversized" if the page was cut or not
+	// read because of its size.
+	SizeLimit string `json:"sizeLimit,omitempty"`
+	// FetchError is the reason the page wasn't fetched, such as its address
+	// being blocked, its host being unreachable or its body being corrupt.
+	FetchError string `json:"fetchError,omitempty"`
+	// ParseError is the reason the body of the page couldn't be parsed.
+	ParseError string `json:"parseError,omitempty"`
+	// External links are out of the scope of the crawl and never crawled.
+	External bool `json:"external"`
+	// Seed is the seed of the crawl the link was first reached from.
+	Seed string `json:"seed,omitempty"`
+	// OriginalUrl is the url the link was first found at, if the
+	// canonicalization rules of the crawl rewrote it to its url.
+	OriginalUrl string `json:"originalUrl,omitempty"`
+	// FetchUrl is the url the page of the link was fetched at, if it
+	// differs from its url.
+	FetchUrl string `json:"fetchUrl,omitempty"`
+	// SnapshotKey is the key of the body of the page in the snapshot store
+	// of its crawl job, if it was stored.
+	SnapshotKey string `json:"snapshotKey,omitempty"`
+	// Header is the header of the response of the page, kept if its crawl
+	// job snapshots pages. It's only returned with the snapshot.
+	Header map[string][]string `json:"-"`
+	// Timings break down the time the fetch of the page took, if it was
+	// fetched.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// Timings break down the time the fetch of a page took, in milliseconds.
+// The phases the request skipped, such as the dns lookup and connection of
+// a reused connection, are 0.
+type Timings struct {
+	// StartedAt is the RFC 3339 time the request was started at, with
+	// milliseconds.
+	StartedAt string  `json:"startedAt"`
+	DNS       float64 `json:"dns"`
+	Connect   float64 `json:"connect"`
+	TLS       float64 `json:"tls"`
+	Send      float64 `json:"send"`
+	// TimeToFirstByte is the time waited for the response once the request
+	// was sent.
+	TimeToFirstByte float64 `json:"timeToFirstByte"`
+	Download        float64 `json:"download"`
+}
+
+// Snapshot is the response of a crawled page as stored.
+type Snapshot struct {
+	LinkId     int
+	CrawlJobId int
+	Url        string
+	StatusCode int
+	// Store names the snapshot store of the crawl job, if it has one.
+	Store  string
+	Key    string
+	Header map[string][]string
+}
+
+// Outlink is a link found on a crawled page, as it was found.
+type Outlink struct {
+	Url      string   `json:"url"`
+	Kind     string   `json:"kind"`
+	Rel      []string `json:"rel,omitempty"`
+	External bool     `json:"external"`
+}
+
+// LinkAnalysis holds the link graph metrics computed for a link once its
+// crawl job is completed.
+type LinkAnalysis struct {
+	Url          string
+	ClickDepth   int
+	PageRank     float64
+	InboundLinks int
+	Orphan       bool
+}
+
+type LinkSortField string
+
+const (
+	SortByUrl          LinkSortField = "url"
+	SortByClickDepth   LinkSortField = "clickDepth"
+	SortByPageRank     LinkSortField = "pageRank"
+	SortByInboundLinks LinkSortField = "inboundLinks"
+)
+
+// LinkFoundVia selects links by whether they were listed in a sitemap, found
+// on a crawled page, or both.
+type LinkFoundVia string
+
+const (
+	FoundViaSitemapOnly LinkFoundVia = "sitemapOnly"
+	FoundViaLinksOnly   LinkFoundVia = "linksOnly"
+	FoundViaBoth        LinkFoundVia = "both"
+)
+
+// LinkScope selects links by whether they're in the scope of their crawl.
+type LinkScope string
+
+const (
+	ScopeInternal LinkScope = "internal"
+	ScopeExternal LinkScope = "external"
+)
+
+type LinkFilter struct {
+	// Url selects the link with the url, if set.
+	Url        string
+	Kind       string
+	FoundVia   LinkFoundVia
+	Scope      LinkScope
+	SortBy     LinkSortField
+	Descending bool
 }
 
 type CrawlJobStatus int
@@ -14,6 +153,8 @@ type CrawlJobStatus int
 const (
 	InProgress CrawlJobStatus = iota + 1
 	Completed
+	// Failed jobs couldn't be started, or their crawl stopped on an error.
+	Failed
 )
 
 type CrawlJob struct {
@@ -23,9 +164,39 @@ type CrawlJob struct {
 	JobId       int            `json:"jobId"`
 }
 
+// CrawlTrap is a pattern of urls a crawl job didn't follow as they looked like
+// a crawler trap, such as a calendar generating infinitely many urls.
+type CrawlTrap struct {
+	// Pattern matches the trapped urls, with * matching any text.
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason"`
+	// Count is the number of links found matching the pattern.
+	Count   int    `json:"count"`
+	Example string `json:"example"`
+	// Urls are the distinct urls of the pattern found, up to a maximum.
+	Urls []string `json:"urls,omitempty"`
+}
+
 type LinkRepository interface {
-	GetLinks(crawlJobId int) ([]Link, error)
-	AddLink(url string, crawlJobId int) (int, error)
+	GetLinks(crawlJobId int, filter LinkFilter) ([]Link, error)
+	// StreamLinks calls onLink with the links GetLinks would return, one at
+	// a time as they are read from the database, and stops at the first
+	// error onLink returns or once the context is done.
+	StreamLinks(ctx context.Context, crawlJobId int, filter LinkFilter, onLink func(Link) error) error
+	AddLink(link Link) (int, error)
+	SaveCrawledPage(link Link) error
+	SaveLinkAnalysis(crawlJobId int, analysis []LinkAnalysis) error
+	// SaveOutlinks stores the links found on a crawled page, replacing the
+	// ones previously stored.
+	SaveOutlinks(crawlJobId int, pageUrl string, outlinks []Outlink) error
+	GetOutlinks(crawlJobId int, pageUrl string) ([]Outlink, error)
+	// GetSnapshot returns the stored response of the page of the link, or
+	// an empty snapshot if the link doesn't exist.
+	GetSnapshot(linkId int) (Snapshot, error)
+	// GetSnapshotForUrl returns the stored response of the page of the
+	// crawl job with the url or the original url, or an empty snapshot if
+	// the job has no such link.
+	GetSnapshotForUrl(crawlJobId int, url string) (Snapshot, error)
 }
 
 type CrawlJobRepository interface {
@@ -33,5 +204,16 @@ type CrawlJobRepository interface {
 	UpdateCrawlJobStatus(crawlJobId int, status CrawlJobStatus) error
 	GetCrawlJob(crawlJobId int) (CrawlJob, error)
 	GetCrawlJobForUrl(url string) (CrawlJob, error)
+	// GetCompletedCrawlJobForUrl returns the last completed crawl job of the
+	// url, or an empty job if it has none.
+	GetCompletedCrawlJobForUrl(url string) (CrawlJob, error)
 	GetCrawlJobs() ([]CrawlJob, error)
+	// SaveCrawlJobAuth stores the encrypted auth config of a crawl job,
+	// which is never returned with the job.
+	SaveCrawlJobAuth(crawlJobId int, encryptedAuth string) error
+	// SaveCrawlJobSnapshotStore stores the name of the store the crawl job
+	// snapshots its pages in.
+	SaveCrawlJobSnapshotStore(crawlJobId int, store string) error
+	SaveCrawlTraps(crawlJobId int, traps []CrawlTrap) error
+	GetCrawlTraps(crawlJobId int) ([]CrawlTrap, error)
 }
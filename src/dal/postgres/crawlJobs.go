@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/alicansa/go-linkcrawler/dal"
@@ -77,7 +78,8 @@ func (repo *CrawlJobRepository) GetCrawlJobForUrl(url string) (dal.CrawlJob, err
 	var lastUpdated string
 
 	err := repo.db.db.QueryRow(
-		`SELECT job_id, crawljobstatus_id, base_url, last_updated FROM crawljob WHERE base_url=$1`,
+		`SELECT job_id, crawljobstatus_id, base_url, last_updated FROM crawljob WHERE base_url=$1
+		ORDER BY job_id DESC LIMIT 1`,
 		url).Scan(&jobId, &jobStatus, &baseUrl, &lastUpdated)
 
 	if err != nil {
@@ -98,6 +100,35 @@ func (repo *CrawlJobRepository) GetCrawlJobForUrl(url string) (dal.CrawlJob, err
 	}, nil
 }
 
+func (repo *CrawlJobRepository) GetCompletedCrawlJobForUrl(url string) (dal.CrawlJob, error) {
+	var jobId int
+	var baseUrl string
+	var jobStatus dal.CrawlJobStatus
+	var lastUpdated string
+
+	err := repo.db.db.QueryRow(
+		`SELECT job_id, crawljobstatus_id, base_url, last_updated FROM crawljob WHERE base_url=$1 AND crawljobstatus_id=$2
+		ORDER BY job_id DESC LIMIT 1`,
+		url, dal.Completed).Scan(&jobId, &jobStatus, &baseUrl, &lastUpdated)
+
+	if err != nil {
+
+		if err == sql.ErrNoRows {
+			return dal.CrawlJob{}, nil
+		}
+
+		return dal.CrawlJob{}, err
+
+	}
+
+	return dal.CrawlJob{
+		LastUpdated: lastUpdated,
+		BaseUrl:     baseUrl,
+		Status:      jobStatus,
+		JobId:       jobId,
+	}, nil
+}
+
 func (repo *CrawlJobRepository) GetCrawlJobs() ([]dal.CrawlJob, error) {
 	var jobs []dal.CrawlJob
 	rows, err := repo.db.db.Query(`SELECT job_id, crawljobstatus_id, base_url, last_updated FROM crawljob`)
@@ -136,6 +167,119 @@ func (repo *CrawlJobRepository) GetCrawlJobs() ([]dal.CrawlJob, error) {
 	return jobs, nil
 }
 
+func (repo *CrawlJobRepository) SaveCrawlJobAuth(crawlJobId int, encryptedAuth string) error {
+	sqlStatement := `
+		UPDATE crawljob
+		SET encrypted_auth = $1
+		WHERE job_id = $2`
+
+	_, err := repo.db.db.Exec(sqlStatement, encryptedAuth, crawlJobId)
+
+	return err
+}
+
+func (repo *CrawlJobRepository) SaveCrawlJobSnapshotStore(crawlJobId int, store string) error {
+	sqlStatement := `
+		UPDATE crawljob
+		SET snapshot_store = $1
+		WHERE job_id = $2`
+
+	_, err := repo.db.db.Exec(sqlStatement, store, crawlJobId)
+
+	return err
+}
+
+func (repo *CrawlJobRepository) SaveCrawlTraps(crawlJobId int, traps []dal.CrawlTrap) error {
+	sqlStatement := `
+		INSERT INTO crawltrap (crawljob_id, pattern, reason, count, example, urls)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		ON CONFLICT (crawljob_id, pattern, reason) DO UPDATE
+		SET count = EXCLUDED.count,
+			example = EXCLUDED.example,
+			urls = EXCLUDED.urls`
+
+	tx, err := repo.db.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(sqlStatement)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, trap := range traps {
+		var urls string
+		if len(trap.Urls) > 0 {
+			b, err := json.Marshal(trap.Urls)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			urls = string(b)
+		}
+
+		_, err = stmt.Exec(
+			crawlJobId,
+			trap.Pattern,
+			trap.Reason,
+			trap.Count,
+			trap.Example,
+			urls)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo *CrawlJobRepository) GetCrawlTraps(crawlJobId int) ([]dal.CrawlTrap, error) {
+	var traps []dal.CrawlTrap
+	rows, err := repo.db.db.Query(
+		`SELECT pattern, reason, count, COALESCE(example, ''), COALESCE(urls, '') FROM crawltrap WHERE crawljob_id=$1 ORDER BY pattern, reason`,
+		crawlJobId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var trap dal.CrawlTrap
+		var urls string
+
+		err = rows.Scan(&trap.Pattern, &trap.Reason, &trap.Count, &trap.Example, &urls)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if urls != "" {
+			if err := json.Unmarshal([]byte(urls), &trap.Urls); err != nil {
+				return nil, err
+			}
+		}
+
+		traps = append(traps, trap)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return traps, nil
+}
+
 func NewCrawlJobRepository(db *DB) *CrawlJobRepository {
 	return &CrawlJobRepository{db: db}
 }
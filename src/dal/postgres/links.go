@@ -1,17 +1,50 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"github.com/alicansa/go-linkcrawler/dal"
 )
 
+// sortColumns maps the sortable link fields to their columns.
+var sortColumns = map[dal.LinkSortField]string{
+	dal.SortByUrl:          "url",
+	dal.SortByClickDepth:   "click_depth",
+	dal.SortByPageRank:     "page_rank",
+	dal.SortByInboundLinks: "inbound_links",
+}
+
+// foundViaConditions maps the found via filters to their conditions.
+var foundViaConditions = map[dal.LinkFoundVia]string{
+	dal.FoundViaSitemapOnly: "in_sitemap AND NOT linked",
+	dal.FoundViaLinksOnly:   "linked AND NOT in_sitemap",
+	dal.FoundViaBoth:        "in_sitemap AND linked",
+}
+
+// scopeConditions maps the scope filters to their conditions.
+var scopeConditions = map[dal.LinkScope]string{
+	dal.ScopeInternal: "NOT external",
+	dal.ScopeExternal: "external",
+}
+
 type LinkRepository struct {
 	db *DB
 }
 
-func (lr *LinkRepository) GetLinks(crawlJobId int) ([]dal.Link, error) {
+func (lr *LinkRepository) GetLinks(crawlJobId int, filter dal.LinkFilter) ([]dal.Link, error) {
+
+	query, args, err := linksQuery(crawlJobId, filter)
+
+	if err != nil {
+		return nil, err
+	}
 
 	var links []dal.Link
-	rows, err := lr.db.db.Query(`SELECT link_id, url FROM crawllink WHERE crawljob_id=$1`, crawlJobId)
+	rows, err := lr.db.db.Query(query, args...)
 
 	if err != nil {
 		return nil, err
@@ -22,21 +55,14 @@ func (lr *LinkRepository) GetLinks(crawlJobId int) ([]dal.Link, error) {
 	// loops over rows and add to links
 
 	for rows.Next() {
-		var linkId int
-		var url string
-
-		err = rows.Scan(&linkId, &url)
+		link, err := scanLink(rows, crawlJobId)
 
 		if err != nil {
 			// handle this error
 			return nil, err
 		}
 
-		links = append(links, dal.Link{
-			Url:        url,
-			CrawlJobId: crawlJobId,
-			LinkId:     linkId,
-		})
+		links = append(links, link)
 	}
 
 	err = rows.Err()
@@ -47,15 +73,272 @@ func (lr *LinkRepository) GetLinks(crawlJobId int) ([]dal.Link, error) {
 	return links, nil
 }
 
-func (lr *LinkRepository) AddLink(url string, crawlJobId int) (int, error) {
+// streamBatchSize is the number of links fetched from the cursor of a
+// stream at a time.
+const streamBatchSize = 1000
+
+func (lr *LinkRepository) StreamLinks(ctx context.Context, crawlJobId int, filter dal.LinkFilter, onLink func(dal.Link) error) error {
+
+	query, args, err := linksQuery(crawlJobId, filter)
+
+	if err != nil {
+		return err
+	}
+
+	// cursors only live as long as their transaction, which only reads
+	tx, err := lr.db.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DECLARE links_stream NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return err
+	}
+
+	for {
+		fetched, err := lr.fetchLinks(ctx, tx, crawlJobId, onLink)
+
+		if err != nil {
+			return err
+		}
+
+		if fetched < streamBatchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fetchLinks fetches the next batch of links from the cursor of a stream and
+// returns how many were fetched.
+func (lr *LinkRepository) fetchLinks(ctx context.Context, tx *sql.Tx, crawlJobId int, onLink func(dal.Link) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM links_stream", streamBatchSize))
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	fetched := 0
+	for rows.Next() {
+		link, err := scanLink(rows, crawlJobId)
+
+		if err != nil {
+			return 0, err
+		}
 
+		if err := onLink(link); err != nil {
+			return 0, err
+		}
+		fetched++
+	}
+
+	return fetched, rows.Err()
+}
+
+// linksQuery returns the query of the links of the crawl job that pass the
+// filter, in its order, and its arguments.
+func linksQuery(crawlJobId int, filter dal.LinkFilter) (string, []interface{}, error) {
+
+	query := `
+		SELECT link_id, url, kind, COALESCE(status_code, 0), COALESCE(canonical_url, ''), noindex, nofollow,
+			COALESCE(click_depth, -1), COALESCE(page_rank, 0), inbound_links, orphan, in_sitemap, linked,
+			COALESCE(content_type, ''),
+			COALESCE(to_char(last_modified AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), ''), parsed,
+			COALESCE(charset, ''), COALESCE(size_limit, ''), COALESCE(fetch_error, ''), external,
+			COALESCE(seed, ''), COALESCE(original_url, ''), COALESCE(etag, ''), not_modified,
+			COALESCE(content_hash, ''), COALESCE(sim_hash, ''), COALESCE(snapshot_key, ''), COALESCE(timings, ''),
+			COALESCE(parse_error, ''), COALESCE(fetch_url, '')
+		FROM crawllink
+		WHERE crawljob_id=$1`
+	args := []interface{}{crawlJobId}
+
+	if filter.Url != "" {
+		args = append(args, filter.Url)
+		query += fmt.Sprintf(" AND url=$%d", len(args))
+	}
+
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		query += fmt.Sprintf(" AND kind=$%d", len(args))
+	}
+
+	if filter.FoundVia != "" {
+		condition, ok := foundViaConditions[filter.FoundVia]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid found via filter %q", filter.FoundVia)
+		}
+		query += " AND " + condition
+	}
+
+	if filter.Scope != "" {
+		condition, ok := scopeConditions[filter.Scope]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid scope filter %q", filter.Scope)
+		}
+		query += " AND " + condition
+	}
+
+	orderBy := "link_id"
+	if filter.SortBy != "" {
+		column, ok := sortColumns[filter.SortBy]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid sort field %q", filter.SortBy)
+		}
+		orderBy = column
+	}
+
+	if filter.Descending {
+		orderBy += " DESC NULLS LAST"
+	}
+
+	return query + " ORDER BY " + orderBy, args, nil
+}
+
+// scanLink scans a row of a links query.
+func scanLink(rows *sql.Rows, crawlJobId int) (dal.Link, error) {
+	var linkId int
+	var url string
+	var kind string
+	var statusCode int
+	var canonical string
+	var noIndex bool
+	var noFollow bool
+	var clickDepth int
+	var pageRank float64
+	var inboundLinks int
+	var orphan bool
+	var inSitemap bool
+	var linked bool
+	var contentType string
+	var lastModified string
+	var parsed bool
+	var charset string
+	var sizeLimit string
+	var fetchError string
+	var external bool
+	var seed string
+	var originalUrl string
+	var etag string
+	var notModified bool
+	var contentHash string
+	var simHash string
+	var snapshotKey string
+	var timings string
+	var parseError string
+	var fetchUrl string
+
+	err := rows.Scan(
+		&linkId,
+		&url,
+		&kind,
+		&statusCode,
+		&canonical,
+		&noIndex,
+		&noFollow,
+		&clickDepth,
+		&pageRank,
+		&inboundLinks,
+		&orphan,
+		&inSitemap,
+		&linked,
+		&contentType,
+		&lastModified,
+		&parsed,
+		&charset,
+		&sizeLimit,
+		&fetchError,
+		&external,
+		&seed,
+		&originalUrl,
+		&etag,
+		&notModified,
+		&contentHash,
+		&simHash,
+		&snapshotKey,
+		&timings,
+		&parseError,
+		&fetchUrl)
+
+	if err != nil {
+		return dal.Link{}, err
+	}
+
+	var linkTimings *dal.Timings
+	if timings != "" {
+		if err := json.Unmarshal([]byte(timings), &linkTimings); err != nil {
+			return dal.Link{}, err
+		}
+	}
+
+	return dal.Link{
+		Url:          url,
+		CrawlJobId:   crawlJobId,
+		LinkId:       linkId,
+		Kind:         kind,
+		StatusCode:   statusCode,
+		Canonical:    canonical,
+		NoIndex:      noIndex,
+		NoFollow:     noFollow,
+		ClickDepth:   clickDepth,
+		PageRank:     pageRank,
+		InboundLinks: inboundLinks,
+		Orphan:       orphan,
+		InSitemap:    inSitemap,
+		Linked:       linked,
+		ContentType:  contentType,
+		LastModified: lastModified,
+		Parsed:       parsed,
+		Charset:      charset,
+		SizeLimit:    sizeLimit,
+		FetchError:   fetchError,
+		ParseError:   parseError,
+		External:     external,
+		Seed:         seed,
+		OriginalUrl:  originalUrl,
+		FetchUrl:     fetchUrl,
+		ETag:         etag,
+		NotModified:  notModified,
+		ContentHash:  contentHash,
+		SimHash:      simHash,
+		SnapshotKey:  snapshotKey,
+		Timings:      linkTimings,
+	}, nil
+}
+
+func (lr *LinkRepository) AddLink(link dal.Link) (int, error) {
+
+	// the link may already exist if it was crawled before being
+	// discovered, as the seeds are, or if it was listed in a sitemap before
+	// being found on a page. The seed it was first reached from and the url
+	// it was first found at are kept.
 	var linkId int
 	sqlStatement := `
-		INSERT INTO crawllink (url, crawljob_id)
-		VALUES ($1, $2)
+		INSERT INTO crawllink (url, crawljob_id, kind, in_sitemap, linked, external, seed, original_url)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''))
+		ON CONFLICT (crawljob_id, url) DO UPDATE
+		SET kind = EXCLUDED.kind,
+			in_sitemap = crawllink.in_sitemap OR EXCLUDED.in_sitemap,
+			linked = crawllink.linked OR EXCLUDED.linked,
+			seed = COALESCE(crawllink.seed, EXCLUDED.seed),
+			original_url = COALESCE(crawllink.original_url, EXCLUDED.original_url)
 		RETURNING link_id`
 
-	err := lr.db.db.QueryRow(sqlStatement, url, crawlJobId).Scan(&linkId)
+	err := lr.db.db.QueryRow(
+		sqlStatement,
+		link.Url,
+		link.CrawlJobId,
+		link.Kind,
+		link.InSitemap,
+		link.Linked,
+		link.External,
+		link.Seed,
+		link.OriginalUrl).Scan(&linkId)
 
 	if err != nil {
 		return linkId, err
@@ -64,6 +347,266 @@ func (lr *LinkRepository) AddLink(url string, crawlJobId int) (int, error) {
 	return linkId, nil
 }
 
+func (lr *LinkRepository) SaveCrawledPage(link dal.Link) error {
+
+	var header string
+	if link.Header != nil {
+		b, err := json.Marshal(link.Header)
+		if err != nil {
+			return err
+		}
+		header = string(b)
+	}
+
+	var timings string
+	if link.Timings != nil {
+		b, err := json.Marshal(link.Timings)
+		if err != nil {
+			return err
+		}
+		timings = string(b)
+	}
+
+	sqlStatement := `
+		INSERT INTO crawllink (url, crawljob_id, status_code, canonical_url, noindex, nofollow,
+			content_type, last_modified, parsed, charset, size_limit, fetch_error, seed, original_url, etag, not_modified,
+			content_hash, sim_hash, snapshot_key, snapshot_header, timings, parse_error, fetch_url)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), NULLIF($8, '')::TIMESTAMPTZ, $9, NULLIF($10, ''),
+			NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, ''), $16,
+			NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), NULLIF($20, ''), NULLIF($21, ''), NULLIF($22, ''),
+			NULLIF($23, ''))
+		ON CONFLICT (crawljob_id, url) DO UPDATE
+		SET status_code = EXCLUDED.status_code,
+			canonical_url = EXCLUDED.canonical_url,
+			noindex = EXCLUDED.noindex,
+			nofollow = EXCLUDED.nofollow,
+			content_type = EXCLUDED.content_type,
+			last_modified = EXCLUDED.last_modified,
+			parsed = EXCLUDED.parsed,
+			charset = EXCLUDED.charset,
+			size_limit = EXCLUDED.size_limit,
+			fetch_error = EXCLUDED.fetch_error,
+			parse_error = EXCLUDED.parse_error,
+			etag = EXCLUDED.etag,
+			not_modified = EXCLUDED.not_modified,
+			content_hash = EXCLUDED.content_hash,
+			sim_hash = EXCLUDED.sim_hash,
+			snapshot_key = EXCLUDED.snapshot_key,
+			snapshot_header = EXCLUDED.snapshot_header,
+			timings = EXCLUDED.timings,
+			fetch_url = EXCLUDED.fetch_url,
+			seed = COALESCE(crawllink.seed, EXCLUDED.seed),
+			original_url = COALESCE(crawllink.original_url, EXCLUDED.original_url)`
+
+	_, err := lr.db.db.Exec(
+		sqlStatement,
+		link.Url,
+		link.CrawlJobId,
+		link.StatusCode,
+		link.Canonical,
+		link.NoIndex,
+		link.NoFollow,
+		link.ContentType,
+		link.LastModified,
+		link.Parsed,
+		link.Charset,
+		link.SizeLimit,
+		link.FetchError,
+		link.Seed,
+		link.OriginalUrl,
+		link.ETag,
+		link.NotModified,
+		link.ContentHash,
+		link.SimHash,
+		link.SnapshotKey,
+		header,
+		timings,
+		link.ParseError,
+		link.FetchUrl)
+
+	return err
+}
+
+func (lr *LinkRepository) SaveLinkAnalysis(crawlJobId int, analysis []dal.LinkAnalysis) error {
+
+	// pages that were crawled but never discovered as a link, such as the
+	// seed, are added so that every analysed page has a link
+	sqlStatement := `
+		INSERT INTO crawllink (url, crawljob_id, click_depth, page_rank, inbound_links, orphan)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (crawljob_id, url) DO UPDATE
+		SET click_depth = EXCLUDED.click_depth,
+			page_rank = EXCLUDED.page_rank,
+			inbound_links = EXCLUDED.inbound_links,
+			orphan = EXCLUDED.orphan`
+
+	tx, err := lr.db.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(sqlStatement)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, a := range analysis {
+		_, err = stmt.Exec(
+			a.Url,
+			crawlJobId,
+			a.ClickDepth,
+			a.PageRank,
+			a.InboundLinks,
+			a.Orphan)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (lr *LinkRepository) SaveOutlinks(crawlJobId int, pageUrl string, outlinks []dal.Outlink) error {
+
+	sqlStatement := `
+		INSERT INTO crawloutlink (crawljob_id, page_url, url, kind, rel, external)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		ON CONFLICT (crawljob_id, page_url, url) DO UPDATE
+		SET kind = EXCLUDED.kind,
+			rel = EXCLUDED.rel,
+			external = EXCLUDED.external`
+
+	tx, err := lr.db.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM crawloutlink WHERE crawljob_id = $1 AND page_url = $2`, crawlJobId, pageUrl)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.Prepare(sqlStatement)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, outlink := range outlinks {
+		_, err = stmt.Exec(
+			crawlJobId,
+			pageUrl,
+			outlink.Url,
+			outlink.Kind,
+			strings.Join(outlink.Rel, " "),
+			outlink.External)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (lr *LinkRepository) GetOutlinks(crawlJobId int, pageUrl string) ([]dal.Outlink, error) {
+	var outlinks []dal.Outlink
+	rows, err := lr.db.db.Query(
+		`SELECT url, kind, COALESCE(rel, ''), external FROM crawloutlink WHERE crawljob_id=$1 AND page_url=$2`,
+		crawlJobId,
+		pageUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var outlink dal.Outlink
+		var rel string
+
+		err = rows.Scan(&outlink.Url, &outlink.Kind, &rel, &outlink.External)
+
+		if err != nil {
+			return nil, err
+		}
+
+		outlink.Rel = strings.Fields(rel)
+		outlinks = append(outlinks, outlink)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return outlinks, nil
+}
+
+const selectSnapshot = `SELECT l.link_id, l.crawljob_id, l.url, COALESCE(l.status_code, 0), COALESCE(j.snapshot_store, ''),
+		COALESCE(l.snapshot_key, ''), COALESCE(l.snapshot_header, '')
+	FROM crawllink l
+	JOIN crawljob j ON j.job_id = l.crawljob_id`
+
+func (lr *LinkRepository) GetSnapshot(linkId int) (dal.Snapshot, error) {
+	return lr.getSnapshot(selectSnapshot+` WHERE l.link_id=$1`, linkId)
+}
+
+func (lr *LinkRepository) GetSnapshotForUrl(crawlJobId int, url string) (dal.Snapshot, error) {
+	// a link crawled at the url is preferred to one canonicalized from it
+	return lr.getSnapshot(
+		selectSnapshot+` WHERE l.crawljob_id=$1 AND (l.url=$2 OR l.original_url=$2)
+		ORDER BY l.url=$2 DESC
+		LIMIT 1`,
+		crawlJobId, url)
+}
+
+func (lr *LinkRepository) getSnapshot(query string, args ...interface{}) (dal.Snapshot, error) {
+	var snapshot dal.Snapshot
+	var header string
+
+	err := lr.db.db.QueryRow(query, args...).Scan(
+		&snapshot.LinkId,
+		&snapshot.CrawlJobId,
+		&snapshot.Url,
+		&snapshot.StatusCode,
+		&snapshot.Store,
+		&snapshot.Key,
+		&header)
+
+	if err != nil {
+
+		if err == sql.ErrNoRows {
+			return dal.Snapshot{}, nil
+		}
+
+		return dal.Snapshot{}, err
+	}
+
+	if header != "" {
+		if err := json.Unmarshal([]byte(header), &snapshot.Header); err != nil {
+			return dal.Snapshot{}, err
+		}
+	}
+
+	return snapshot, nil
+}
+
 func NewLinkRepository(db *DB) *LinkRepository {
 	return &LinkRepository{db: db}
 }
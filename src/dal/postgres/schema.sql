@@ -0,0 +1,80 @@
+CREATE TABLE IF NOT EXISTS crawljobstatus (
+	crawljobstatus_id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+INSERT INTO crawljobstatus (crawljobstatus_id, name)
+VALUES (1, 'InProgress'), (2, 'Completed'), (3, 'Failed')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS crawljob (
+	job_id SERIAL PRIMARY KEY,
+	crawljobstatus_id INTEGER NOT NULL REFERENCES crawljobstatus (crawljobstatus_id),
+	base_url TEXT NOT NULL,
+	last_updated TIMESTAMP NOT NULL,
+	-- the auth config of the job, encrypted by the server
+	encrypted_auth TEXT,
+	-- the name of the store the bodies of the crawled pages are kept in
+	snapshot_store TEXT
+);
+
+CREATE TABLE IF NOT EXISTS crawllink (
+	link_id SERIAL PRIMARY KEY,
+	url TEXT NOT NULL,
+	crawljob_id INTEGER NOT NULL REFERENCES crawljob (job_id),
+	kind TEXT NOT NULL DEFAULT 'navigation',
+	status_code INTEGER,
+	canonical_url TEXT,
+	noindex BOOLEAN NOT NULL DEFAULT FALSE,
+	nofollow BOOLEAN NOT NULL DEFAULT FALSE,
+	click_depth INTEGER,
+	page_rank DOUBLE PRECISION,
+	inbound_links INTEGER NOT NULL DEFAULT 0,
+	orphan BOOLEAN NOT NULL DEFAULT FALSE,
+	in_sitemap BOOLEAN NOT NULL DEFAULT FALSE,
+	linked BOOLEAN NOT NULL DEFAULT FALSE,
+	content_type TEXT,
+	last_modified TIMESTAMPTZ,
+	parsed BOOLEAN NOT NULL DEFAULT FALSE,
+	charset TEXT,
+	size_limit TEXT,
+	fetch_error TEXT,
+	parse_error TEXT,
+	external BOOLEAN NOT NULL DEFAULT FALSE,
+	seed TEXT,
+	original_url TEXT,
+	fetch_url TEXT,
+	etag TEXT,
+	not_modified BOOLEAN NOT NULL DEFAULT FALSE,
+	content_hash TEXT,
+	sim_hash TEXT,
+	snapshot_key TEXT,
+	-- the json encoded header of the response, for snapshotted pages
+	snapshot_header TEXT,
+	-- the json encoded timings of the fetch of the page
+	timings TEXT,
+	UNIQUE (crawljob_id, url)
+);
+
+-- the links found on the crawled pages, reused when recrawling pages that
+-- weren't modified
+CREATE TABLE IF NOT EXISTS crawloutlink (
+	crawljob_id INTEGER NOT NULL REFERENCES crawljob (job_id),
+	page_url TEXT NOT NULL,
+	url TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	rel TEXT,
+	external BOOLEAN NOT NULL DEFAULT FALSE,
+	UNIQUE (crawljob_id, page_url, url)
+);
+
+CREATE TABLE IF NOT EXISTS crawltrap (
+	crawljob_id INTEGER NOT NULL REFERENCES crawljob (job_id),
+	pattern TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	count INTEGER NOT NULL DEFAULT 0,
+	example TEXT,
+	-- the json encoded urls of the pattern found, up to a maximum
+	urls TEXT,
+	UNIQUE (crawljob_id, pattern, reason)
+);
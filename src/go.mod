@@ -3,20 +3,22 @@ module github.com/alicansa/go-linkcrawler
 go 1.18
 
 require (
+	github.com/andybalholm/brotli v1.0.4
+	github.com/andybalholm/cascadia v1.3.1
 	github.com/antchfx/htmlquery v1.2.5
+	github.com/antchfx/xpath v1.2.1
 	github.com/golang/mock v1.6.0
 	github.com/gorilla/mux v1.8.0
 	github.com/lib/pq v1.10.6
 	github.com/stretchr/testify v1.8.0
+	golang.org/x/net v0.0.0-20220708220712-1185a9018129
+	golang.org/x/text v0.3.7
 )
 
 require (
-	github.com/antchfx/xpath v1.2.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.4.0 // indirect
-	golang.org/x/net v0.0.0-20220708220712-1185a9018129 // indirect
-	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
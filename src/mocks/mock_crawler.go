@@ -8,6 +8,7 @@ import (
 	io "io"
 	reflect "reflect"
 
+	crawler "github.com/alicansa/go-linkcrawler/crawler"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,10 +36,10 @@ func (m *MockCrawlPolicyExecuter) EXPECT() *MockCrawlPolicyExecuterMockRecorder
 }
 
 // Execute mocks base method.
-func (m *MockCrawlPolicyExecuter) Execute(arg0 io.ReadCloser) ([]string, error) {
+func (m *MockCrawlPolicyExecuter) Execute(arg0 io.ReadCloser) (crawler.Document, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Execute", arg0)
-	ret0, _ := ret[0].([]string)
+	ret0, _ := ret[0].(crawler.Document)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -73,16 +74,30 @@ func (m *MockWebCrawler) EXPECT() *MockWebCrawlerMockRecorder {
 }
 
 // Crawl mocks base method.
-func (m *MockWebCrawler) Crawl(arg0 string, arg1 func([]string) error) (map[string]struct{}, error) {
+func (m *MockWebCrawler) Crawl(arg0 []string, arg1 func([]crawler.Link) error, arg2 func(crawler.CrawledPage) error) (map[string]struct{}, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Crawl", arg0, arg1)
+	ret := m.ctrl.Call(m, "Crawl", arg0, arg1, arg2)
 	ret0, _ := ret[0].(map[string]struct{})
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Crawl indicates an expected call of Crawl.
-func (mr *MockWebCrawlerMockRecorder) Crawl(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockWebCrawlerMockRecorder) Crawl(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Crawl", reflect.TypeOf((*MockWebCrawler)(nil).Crawl), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Crawl", reflect.TypeOf((*MockWebCrawler)(nil).Crawl), arg0, arg1, arg2)
+}
+
+// Traps mocks base method.
+func (m *MockWebCrawler) Traps() []crawler.Trap {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Traps")
+	ret0, _ := ret[0].([]crawler.Trap)
+	return ret0
+}
+
+// Traps indicates an expected call of Traps.
+func (mr *MockWebCrawlerMockRecorder) Traps() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Traps", reflect.TypeOf((*MockWebCrawler)(nil).Traps))
 }
@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	dal "github.com/alicansa/go-linkcrawler/dal"
@@ -35,33 +36,134 @@ func (m *MockLinkRepository) EXPECT() *MockLinkRepositoryMockRecorder {
 }
 
 // AddLink mocks base method.
-func (m *MockLinkRepository) AddLink(arg0 string, arg1 int) (int, error) {
+func (m *MockLinkRepository) AddLink(arg0 dal.Link) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddLink", arg0, arg1)
+	ret := m.ctrl.Call(m, "AddLink", arg0)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddLink indicates an expected call of AddLink.
-func (mr *MockLinkRepositoryMockRecorder) AddLink(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockLinkRepositoryMockRecorder) AddLink(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLink", reflect.TypeOf((*MockLinkRepository)(nil).AddLink), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLink", reflect.TypeOf((*MockLinkRepository)(nil).AddLink), arg0)
 }
 
 // GetLinks mocks base method.
-func (m *MockLinkRepository) GetLinks(arg0 int) ([]dal.Link, error) {
+func (m *MockLinkRepository) GetLinks(arg0 int, arg1 dal.LinkFilter) ([]dal.Link, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLinks", arg0)
+	ret := m.ctrl.Call(m, "GetLinks", arg0, arg1)
 	ret0, _ := ret[0].([]dal.Link)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetLinks indicates an expected call of GetLinks.
-func (mr *MockLinkRepositoryMockRecorder) GetLinks(arg0 interface{}) *gomock.Call {
+func (mr *MockLinkRepositoryMockRecorder) GetLinks(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinks", reflect.TypeOf((*MockLinkRepository)(nil).GetLinks), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinks", reflect.TypeOf((*MockLinkRepository)(nil).GetLinks), arg0, arg1)
+}
+
+// GetOutlinks mocks base method.
+func (m *MockLinkRepository) GetOutlinks(arg0 int, arg1 string) ([]dal.Outlink, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOutlinks", arg0, arg1)
+	ret0, _ := ret[0].([]dal.Outlink)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOutlinks indicates an expected call of GetOutlinks.
+func (mr *MockLinkRepositoryMockRecorder) GetOutlinks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutlinks", reflect.TypeOf((*MockLinkRepository)(nil).GetOutlinks), arg0, arg1)
+}
+
+// GetSnapshot mocks base method.
+func (m *MockLinkRepository) GetSnapshot(arg0 int) (dal.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshot", arg0)
+	ret0, _ := ret[0].(dal.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshot indicates an expected call of GetSnapshot.
+func (mr *MockLinkRepositoryMockRecorder) GetSnapshot(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshot", reflect.TypeOf((*MockLinkRepository)(nil).GetSnapshot), arg0)
+}
+
+// GetSnapshotForUrl mocks base method.
+func (m *MockLinkRepository) GetSnapshotForUrl(arg0 int, arg1 string) (dal.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshotForUrl", arg0, arg1)
+	ret0, _ := ret[0].(dal.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshotForUrl indicates an expected call of GetSnapshotForUrl.
+func (mr *MockLinkRepositoryMockRecorder) GetSnapshotForUrl(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotForUrl", reflect.TypeOf((*MockLinkRepository)(nil).GetSnapshotForUrl), arg0, arg1)
+}
+
+// SaveCrawledPage mocks base method.
+func (m *MockLinkRepository) SaveCrawledPage(arg0 dal.Link) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCrawledPage", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCrawledPage indicates an expected call of SaveCrawledPage.
+func (mr *MockLinkRepositoryMockRecorder) SaveCrawledPage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCrawledPage", reflect.TypeOf((*MockLinkRepository)(nil).SaveCrawledPage), arg0)
+}
+
+// SaveLinkAnalysis mocks base method.
+func (m *MockLinkRepository) SaveLinkAnalysis(arg0 int, arg1 []dal.LinkAnalysis) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveLinkAnalysis", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveLinkAnalysis indicates an expected call of SaveLinkAnalysis.
+func (mr *MockLinkRepositoryMockRecorder) SaveLinkAnalysis(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveLinkAnalysis", reflect.TypeOf((*MockLinkRepository)(nil).SaveLinkAnalysis), arg0, arg1)
+}
+
+// SaveOutlinks mocks base method.
+func (m *MockLinkRepository) SaveOutlinks(arg0 int, arg1 string, arg2 []dal.Outlink) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOutlinks", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOutlinks indicates an expected call of SaveOutlinks.
+func (mr *MockLinkRepositoryMockRecorder) SaveOutlinks(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOutlinks", reflect.TypeOf((*MockLinkRepository)(nil).SaveOutlinks), arg0, arg1, arg2)
+}
+
+// StreamLinks mocks base method.
+func (m *MockLinkRepository) StreamLinks(arg0 context.Context, arg1 int, arg2 dal.LinkFilter, arg3 func(dal.Link) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamLinks", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamLinks indicates an expected call of StreamLinks.
+func (mr *MockLinkRepositoryMockRecorder) StreamLinks(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamLinks", reflect.TypeOf((*MockLinkRepository)(nil).StreamLinks), arg0, arg1, arg2, arg3)
 }
 
 // MockCrawlJobRepository is a mock of CrawlJobRepository interface.
@@ -102,6 +204,21 @@ func (mr *MockCrawlJobRepositoryMockRecorder) AddCrawlJob(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCrawlJob", reflect.TypeOf((*MockCrawlJobRepository)(nil).AddCrawlJob), arg0)
 }
 
+// GetCompletedCrawlJobForUrl mocks base method.
+func (m *MockCrawlJobRepository) GetCompletedCrawlJobForUrl(arg0 string) (dal.CrawlJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompletedCrawlJobForUrl", arg0)
+	ret0, _ := ret[0].(dal.CrawlJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCompletedCrawlJobForUrl indicates an expected call of GetCompletedCrawlJobForUrl.
+func (mr *MockCrawlJobRepositoryMockRecorder) GetCompletedCrawlJobForUrl(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompletedCrawlJobForUrl", reflect.TypeOf((*MockCrawlJobRepository)(nil).GetCompletedCrawlJobForUrl), arg0)
+}
+
 // GetCrawlJob mocks base method.
 func (m *MockCrawlJobRepository) GetCrawlJob(arg0 int) (dal.CrawlJob, error) {
 	m.ctrl.T.Helper()
@@ -147,6 +264,63 @@ func (mr *MockCrawlJobRepositoryMockRecorder) GetCrawlJobs() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCrawlJobs", reflect.TypeOf((*MockCrawlJobRepository)(nil).GetCrawlJobs))
 }
 
+// GetCrawlTraps mocks base method.
+func (m *MockCrawlJobRepository) GetCrawlTraps(arg0 int) ([]dal.CrawlTrap, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCrawlTraps", arg0)
+	ret0, _ := ret[0].([]dal.CrawlTrap)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCrawlTraps indicates an expected call of GetCrawlTraps.
+func (mr *MockCrawlJobRepositoryMockRecorder) GetCrawlTraps(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCrawlTraps", reflect.TypeOf((*MockCrawlJobRepository)(nil).GetCrawlTraps), arg0)
+}
+
+// SaveCrawlJobAuth mocks base method.
+func (m *MockCrawlJobRepository) SaveCrawlJobAuth(arg0 int, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCrawlJobAuth", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCrawlJobAuth indicates an expected call of SaveCrawlJobAuth.
+func (mr *MockCrawlJobRepositoryMockRecorder) SaveCrawlJobAuth(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCrawlJobAuth", reflect.TypeOf((*MockCrawlJobRepository)(nil).SaveCrawlJobAuth), arg0, arg1)
+}
+
+// SaveCrawlJobSnapshotStore mocks base method.
+func (m *MockCrawlJobRepository) SaveCrawlJobSnapshotStore(arg0 int, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCrawlJobSnapshotStore", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCrawlJobSnapshotStore indicates an expected call of SaveCrawlJobSnapshotStore.
+func (mr *MockCrawlJobRepositoryMockRecorder) SaveCrawlJobSnapshotStore(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCrawlJobSnapshotStore", reflect.TypeOf((*MockCrawlJobRepository)(nil).SaveCrawlJobSnapshotStore), arg0, arg1)
+}
+
+// SaveCrawlTraps mocks base method.
+func (m *MockCrawlJobRepository) SaveCrawlTraps(arg0 int, arg1 []dal.CrawlTrap) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCrawlTraps", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCrawlTraps indicates an expected call of SaveCrawlTraps.
+func (mr *MockCrawlJobRepositoryMockRecorder) SaveCrawlTraps(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCrawlTraps", reflect.TypeOf((*MockCrawlJobRepository)(nil).SaveCrawlTraps), arg0, arg1)
+}
+
 // UpdateCrawlJobStatus mocks base method.
 func (m *MockCrawlJobRepository) UpdateCrawlJobStatus(arg0 int, arg1 dal.CrawlJobStatus) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,207 @@
+// Package replay rewrites archived documents so that their links lead to the
+// archived versions of the documents they link to.
+package replay
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttributes are the attributes holding urls, by element.
+var urlAttributes = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"audio":  {"src"},
+	"base":   {"href"},
+	"embed":  {"src"},
+	"form":   {"action"},
+	"frame":  {"src"},
+	"iframe": {"src"},
+	"img":    {"src", "srcset"},
+	"input":  {"src"},
+	"link":   {"href"},
+	"object": {"data"},
+	"script": {"src"},
+	"source": {"src", "srcset"},
+	"track":  {"src"},
+	"video":  {"src", "poster"},
+}
+
+var (
+	cssUrlRegexp    = regexp.MustCompile(`url\(\s*(['"]?)([^'")]*)(['"]?)\s*\)`)
+	cssImportRegexp = regexp.MustCompile(`@import\s+(['"])([^'"]*)(['"])`)
+	refreshRegexp   = regexp.MustCompile(`(?i)^(\s*[0-9.]*\s*[;,]\s*(?:url\s*=\s*)?['"]?)([^'"]*)(['"]?\s*)$`)
+)
+
+// Rewriter rewrites links to the replay urls of their targets, which are
+// their absolute urls after a prefix such as "/replay/1/".
+type Rewriter struct {
+	Prefix string
+}
+
+// URL returns the replay url of the reference, resolved against the base
+// url. References to fragments of the same document and to urls that aren't
+// http, such as mailto: and data: urls, are returned unchanged.
+func (rw Rewriter) URL(base *url.URL, ref string) string {
+	trimmed := strings.TrimSpace(ref)
+	if trimmed == "" || trimmed[0] == '#' {
+		return ref
+	}
+
+	r, err := url.Parse(trimmed)
+	if err != nil {
+		return ref
+	}
+
+	abs := base.ResolveReference(r)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return ref
+	}
+
+	return rw.Prefix + abs.String()
+}
+
+// HTML rewrites the links of the html document, in the attributes of its
+// elements, its style sheets and its meta refreshes. The rest of the
+// document is left as it is.
+func (rw Rewriter) HTML(body []byte, base *url.URL) []byte {
+	var out bytes.Buffer
+	out.Grow(len(body))
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	inStyle := false
+	baseSet := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.Bytes()
+		}
+
+		// the tokenizer lowercases tag names in place
+		raw := append([]byte(nil), z.Raw()...)
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			inStyle = token.Data == "style" && tt == html.StartTagToken
+
+			// the first base element with a url sets the base url of the
+			// document
+			if token.Data == "base" && !baseSet {
+				if href, ok := attr(token, "href"); ok {
+					if r, err := url.Parse(strings.TrimSpace(href)); err == nil {
+						base = base.ResolveReference(r)
+						baseSet = true
+					}
+				}
+			}
+
+			if rw.rewriteAttributes(&token, base) {
+				out.WriteString(token.String())
+				continue
+			}
+		case html.EndTagToken:
+			inStyle = false
+		case html.TextToken:
+			if inStyle {
+				out.Write(rw.CSS(raw, base))
+				continue
+			}
+		}
+
+		out.Write(raw)
+	}
+}
+
+// rewriteAttributes rewrites the urls in the attributes of the element and
+// reports whether it changed any.
+func (rw Rewriter) rewriteAttributes(token *html.Token, base *url.URL) bool {
+	names := urlAttributes[token.Data]
+	isRefresh := token.Data == "meta" && strings.EqualFold(attrValue(*token, "http-equiv"), "refresh")
+
+	changed := false
+	for i, a := range token.Attr {
+		value := a.Val
+		switch {
+		case a.Key == "style":
+			value = string(rw.CSS([]byte(a.Val), base))
+		case a.Key == "content" && isRefresh:
+			value = rw.refresh(a.Val, base)
+		case a.Key == "srcset" && contains(names, a.Key):
+			value = rw.srcset(a.Val, base)
+		case contains(names, a.Key):
+			value = rw.URL(base, a.Val)
+		}
+
+		if value != a.Val {
+			token.Attr[i].Val = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// CSS rewrites the urls of the style sheet, in url() values and imports.
+func (rw Rewriter) CSS(body []byte, base *url.URL) []byte {
+	replace := func(re *regexp.Regexp, prefix string, suffix string) func([]byte) []byte {
+		return func(match []byte) []byte {
+			groups := re.FindSubmatch(match)
+			return []byte(prefix + string(groups[1]) + rw.URL(base, string(groups[2])) + string(groups[3]) + suffix)
+		}
+	}
+
+	body = cssUrlRegexp.ReplaceAllFunc(body, replace(cssUrlRegexp, "url(", ")"))
+	return cssImportRegexp.ReplaceAllFunc(body, replace(cssImportRegexp, "@import ", ""))
+}
+
+// srcset rewrites the urls of the candidates of a srcset, keeping their
+// descriptors.
+func (rw Rewriter) srcset(value string, base *url.URL) string {
+	candidates := strings.Split(value, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = rw.URL(base, fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// refresh rewrites the url of a meta refresh content value such as
+// "5; url=https://example.com/".
+func (rw Rewriter) refresh(content string, base *url.URL) string {
+	groups := refreshRegexp.FindStringSubmatch(content)
+	if groups == nil || strings.TrimSpace(groups[2]) == "" {
+		return content
+	}
+	return groups[1] + rw.URL(base, groups[2]) + groups[3]
+}
+
+func attr(token html.Token, name string) (string, bool) {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attrValue(token html.Token, name string) string {
+	value, _ := attr(token, name)
+	return value
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package replay
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriter(t *testing.T) {
+	rw := Rewriter{Prefix: "/replay/1/"}
+	base, _ := url.Parse("https://example.com/blog/post")
+
+	t.Run("Test rewrites urls resolved against the base url", func(t *testing.T) {
+		assert.Equal(t, "/replay/1/https://example.com/blog/other", rw.URL(base, "other"))
+		assert.Equal(t, "/replay/1/https://example.com/?q=1#top", rw.URL(base, "/?q=1#top"))
+		assert.Equal(t, "/replay/1/https://other.com/", rw.URL(base, "//other.com/"))
+		assert.Equal(t, "#top", rw.URL(base, "#top"))
+		assert.Equal(t, "mailto:a@example.com", rw.URL(base, "mailto:a@example.com"))
+		assert.Equal(t, "data:image/png;base64,AA==", rw.URL(base, "data:image/png;base64,AA=="))
+	})
+
+	t.Run("Test rewrites the links of html documents", func(t *testing.T) {
+		body := `<!DOCTYPE html><html><head>` +
+			`<link rel="stylesheet" href="/style.css">` +
+			`<meta http-equiv="refresh" content="5; url=/next">` +
+			`<style>body { background: url('bg.png') }</style>` +
+			`<script>var a = "<a href='/x'>";</script>` +
+			`</head><body>` +
+			`<a href="/about" class="nav">About</a>` +
+			`<img src="logo.png" srcset="logo.png 1x, logo@2x.png 2x">` +
+			`<div style="background-image: url(/hero.jpg)">text &amp; more</div>` +
+			`<form action="/search"><input name="q"></form>` +
+			`<a href="#top">Top</a>` +
+			`</body></html>`
+
+		assert.Equal(t, `<!DOCTYPE html><html><head>`+
+			`<link rel="stylesheet" href="/replay/1/https://example.com/style.css">`+
+			`<meta http-equiv="refresh" content="5; url=/replay/1/https://example.com/next">`+
+			`<style>body { background: url('/replay/1/https://example.com/blog/bg.png') }</style>`+
+			`<script>var a = "<a href='/x'>";</script>`+
+			`</head><body>`+
+			`<a href="/replay/1/https://example.com/about" class="nav">About</a>`+
+			`<img src="/replay/1/https://example.com/blog/logo.png" srcset="/replay/1/https://example.com/blog/logo.png 1x, /replay/1/https://example.com/blog/logo@2x.png 2x">`+
+			`<div style="background-image: url(/replay/1/https://example.com/hero.jpg)">text &amp; more</div>`+
+			`<form action="/replay/1/https://example.com/search"><input name="q"></form>`+
+			`<a href="#top">Top</a>`+
+			`</body></html>`,
+			string(rw.HTML([]byte(body), base)))
+	})
+
+	t.Run("Test resolves links against the base element", func(t *testing.T) {
+		body := `<head><base href="https://cdn.example.com/assets/"></head><img src="logo.png">`
+
+		assert.Equal(t, `<head><base href="/replay/1/https://cdn.example.com/assets/"></head>`+
+			`<img src="/replay/1/https://cdn.example.com/assets/logo.png">`,
+			string(rw.HTML([]byte(body), base)))
+	})
+
+	t.Run("Test rewrites the urls of style sheets", func(t *testing.T) {
+		body := `@import "print.css"; .a { background: url("/a.png") } .b { background: url(data:image/png;base64,AA==) }`
+
+		assert.Equal(t, `@import "/replay/1/https://example.com/blog/print.css"; `+
+			`.a { background: url("/replay/1/https://example.com/a.png") } `+
+			`.b { background: url(data:image/png;base64,AA==) }`,
+			string(rw.CSS([]byte(body), base)))
+	})
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Test decrypts encrypted value", func(t *testing.T) {
+		encrypted, err := c.Encrypt([]byte("secret"))
+		assert.Nil(t, err)
+		assert.NotContains(t, encrypted, "secret")
+
+		decrypted, err := c.Decrypt(encrypted)
+		assert.Nil(t, err)
+		assert.Equal(t, "secret", string(decrypted))
+	})
+
+	t.Run("Test encrypts with random nonces", func(t *testing.T) {
+		a, _ := c.Encrypt([]byte("secret"))
+		b, _ := c.Encrypt([]byte("secret"))
+
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("Test returns error with other key", func(t *testing.T) {
+		encrypted, _ := c.Encrypt([]byte("secret"))
+		other, _ := NewCipherFromBase64(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, KeySize)))
+
+		_, err := other.Decrypt(encrypted)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test returns error on invalid key size", func(t *testing.T) {
+		_, err := NewCipher([]byte("short"))
+		assert.NotNil(t, err)
+	})
+}
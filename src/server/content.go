@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/gorilla/mux"
+)
+
+// LinkContent is the response of a crawled page as it was received.
+type LinkContent struct {
+	Url        string              `json:"url"`
+	StatusCode int                 `json:"statusCode"`
+	Header     map[string][]string `json:"header"`
+	// Body is the body of the page, decompressed but not decoded from its
+	// charset. It's empty if the crawler didn't read it.
+	Body []byte `json:"body,omitempty"`
+}
+
+// getLinkContent returns the stored response of the page of a link, for
+// crawl jobs that snapshot their pages.
+func (h *LinksHandler) getLinkContent(rw http.ResponseWriter, r *http.Request) {
+
+	linkId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := h.linkRepository.GetSnapshot(linkId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if snapshot.LinkId == 0 {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	if snapshot.Header == nil {
+		http.Error(rw, "the page wasn't snapshotted", http.StatusNotFound)
+		return
+	}
+
+	content := LinkContent{
+		Url:        snapshot.Url,
+		StatusCode: snapshot.StatusCode,
+		// snapshots stored before session cookies were left out may hold them
+		Header: crawler.SnapshotHeader(snapshot.Header),
+	}
+
+	var ok bool
+	if content.Body, ok = snapshotBody(rw, h.snapshots, snapshot); !ok {
+		return
+	}
+
+	rw.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(rw).Encode(content); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// snapshotBody returns the stored body of the snapshot, empty if the crawler
+// didn't read it, or writes the error response if it can't be read.
+func snapshotBody(rw http.ResponseWriter, snapshots map[string]blobstore.BlobStore, snapshot dal.Snapshot) ([]byte, bool) {
+	if snapshot.Key == "" {
+		return nil, true
+	}
+
+	store, ok := snapshots[snapshot.Store]
+	if !ok {
+		http.Error(rw, "the snapshot store of the crawl job isn't configured", http.StatusNotFound)
+		return nil, false
+	}
+
+	body, err := store.Get(snapshot.Key)
+
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(rw, "the body of the page isn't stored", http.StatusNotFound)
+		return nil, false
+	}
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return body, true
+}
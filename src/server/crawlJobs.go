@@ -2,49 +2,207 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/alicansa/go-linkcrawler/analysis"
+	"github.com/alicansa/go-linkcrawler/blobstore"
 	"github.com/alicansa/go-linkcrawler/crawler"
 	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/alicansa/go-linkcrawler/secrets"
+	"github.com/alicansa/go-linkcrawler/warc"
 	"github.com/gorilla/mux"
 )
 
+// CrawlMode selects whether a job crawls a site or checks a list of urls.
+type CrawlMode string
+
+const (
+	// SpiderMode crawls the site from the base url and seeds.
+	SpiderMode CrawlMode = ""
+	// ListMode fetches each of the urls of the job once without following
+	// their links.
+	ListMode CrawlMode = "list"
+)
+
+// MaxListUrls is the maximum number of urls of a list mode job.
+const MaxListUrls = 100000
+
 type CrawlJobRequest struct {
+	// BaseUrl identifies the job. It's the first url of list mode jobs
+	// unless set.
 	BaseUrl string `json:"baseUrl"`
+	// Seeds are crawled from along with the base url, sharing its scope.
+	Seeds []string  `json:"seeds,omitempty"`
+	Mode  CrawlMode `json:"mode,omitempty"`
+	// Urls are the urls checked by list mode jobs.
+	Urls            []string                 `json:"urls,omitempty"`
+	PageRankDamping float64                  `json:"pageRankDamping,omitempty"`
+	PolicyLanguage  crawler.PolicyLanguage   `json:"policyLanguage,omitempty"`
+	Policy          string                   `json:"policy,omitempty"`
+	Rules           []crawler.ExtractionRule `json:"rules,omitempty"`
+	Filters         crawler.URLFilters       `json:"filters"`
+	SkipNoFollow    bool                     `json:"skipNoFollow,omitempty"`
+	UseSitemaps     bool                     `json:"useSitemaps,omitempty"`
+	MaxBodySize     int64                    `json:"maxBodySize,omitempty"`
+	MaxParseSize    int64                    `json:"maxParseSize,omitempty"`
+	Fetch           crawler.FetchConfig      `json:"fetch"`
+	Scope           crawler.ScopeConfig      `json:"scope"`
+	Traps           crawler.TrapConfig       `json:"traps"`
+	// Canonicalization rewrites the links of the job before they're
+	// deduplicated, storing the url they were found at.
+	Canonicalization crawler.CanonicalizationConfig `json:"canonicalization"`
+	// Auth is write only, it's stored encrypted and never returned.
+	Auth crawler.AuthConfig `json:"auth"`
+	// Recrawl adds a job even if one was added for the base url, requesting
+	// the pages crawled by the last one conditionally so that only the
+	// pages modified since are downloaded.
+	Recrawl bool `json:"recrawl,omitempty"`
+	// Snapshots names the store the bodies of the crawled pages are kept
+	// in, out of the ones configured on the server. Bodies aren't kept if
+	// it isn't set.
+	Snapshots string `json:"snapshots,omitempty"`
+	// Warc archives the crawl of the job in WARC files, downloadable once
+	// the job is completed.
+	Warc bool `json:"warc,omitempty"`
+	// WarcMaxFileSize is the size in bytes above which WARC files are
+	// rotated, warc.DefaultMaxFileSize if not set.
+	WarcMaxFileSize int64 `json:"warcMaxFileSize,omitempty"`
+}
+
+// seeds returns the urls the job is crawled from, which are the base url
+// followed by the other seeds or the listed urls in list mode.
+func (job CrawlJobRequest) seeds() []string {
+	if job.Mode == ListMode {
+		return job.Urls
+	}
+	return append([]string{job.BaseUrl}, job.Seeds...)
 }
 
+// validateMode returns an error if the urls of the job don't fit its mode.
+func (job CrawlJobRequest) validateMode() error {
+	switch job.Mode {
+	case SpiderMode:
+		if job.BaseUrl == "" {
+			return errors.New("baseUrl is required")
+		}
+		if len(job.Urls) > 0 {
+			return errors.New("urls are only checked in list mode")
+		}
+		for _, seed := range job.Seeds {
+			if _, err := url.Parse(seed); err != nil || seed == "" {
+				return fmt.Errorf("invalid seed %q", seed)
+			}
+		}
+	case ListMode:
+		if len(job.Urls) == 0 {
+			return errors.New("list mode requires urls")
+		}
+		if len(job.Urls) > MaxListUrls {
+			return fmt.Errorf("list mode checks at most %d urls", MaxListUrls)
+		}
+		if len(job.Seeds) > 0 || job.UseSitemaps {
+			return errors.New("list mode doesn't crawl from seeds or sitemaps")
+		}
+		if job.Recrawl {
+			return errors.New("list mode checks every url again, it doesn't recrawl")
+		}
+		for _, u := range job.Urls {
+			if !isAbsoluteUrl(u) {
+				return fmt.Errorf("invalid url %q", u)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported mode %q", job.Mode)
+	}
+	return nil
+}
+
+// defaultPolicies are used for jobs that specify a policy language but no
+// policy. Links are filtered once resolved so the policies only select anchors.
+var defaultPolicies = map[crawler.PolicyLanguage]string{
+	crawler.XPathPolicyLanguage: "//a[@href]",
+	crawler.CSSPolicyLanguage:   "a[href]",
+}
+
+// topPagesInSummary is the number of pages with the highest PageRank
+// listed in the analysis summary of a crawl job.
+const topPagesInSummary = 10
+
 type CrawlJob struct {
 	BaseUrl     string             `json:"baseUrl"`
 	LastUpdated string             `json:"lastUpdated"`
 	Status      dal.CrawlJobStatus `json:"status"`
 }
 
+// CrawlJobResult is a crawl job along with the crawler traps found by its
+// crawl, whose links weren't followed.
+type CrawlJobResult struct {
+	dal.CrawlJob
+	Traps []dal.CrawlTrap `json:"traps,omitempty"`
+}
+
 type CrawlJobsHandler struct {
 	crawlJobRepository dal.CrawlJobRepository
 	linkRepository     dal.LinkRepository
-	newCrawler         func(pe crawler.CrawlPolicyExecuter) crawler.WebCrawler
+	newCrawler         func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler
+	// credentials encrypts the auth configs of jobs, which are rejected if
+	// it isn't set
+	credentials *secrets.Cipher
+	// guard rejects jobs crawling blocked addresses, if set
+	guard *crawler.AddressGuard
+	// snapshots are the stores jobs may keep the bodies of their pages in,
+	// by name
+	snapshots map[string]blobstore.BlobStore
+	// warcDir is the directory the WARC files of jobs are written to, which
+	// are rejected if it isn't set
+	warcDir string
 }
 
 func NewCrawlJobHandler(
 	cjr dal.CrawlJobRepository,
 	lr dal.LinkRepository,
-	ncf func(pe crawler.CrawlPolicyExecuter) crawler.WebCrawler) *CrawlJobsHandler {
+	ncf func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler,
+	credentials *secrets.Cipher,
+	guard *crawler.AddressGuard,
+	snapshots map[string]blobstore.BlobStore,
+	warcDir string) *CrawlJobsHandler {
 	return &CrawlJobsHandler{
 		crawlJobRepository: cjr,
 		linkRepository:     lr,
 		newCrawler:         ncf,
+		credentials:        credentials,
+		guard:              guard,
+		snapshots:          snapshots,
+		warcDir:            warcDir,
 	}
 }
 
 func (h *CrawlJobsHandler) registerCrawlJobsHandler(r *mux.Router) {
 	r.HandleFunc("/crawlJobs/{id:[0-9]+}", h.getCrawlJob).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/analysis", h.getCrawlJobAnalysis).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/duplicates", h.getCrawlJobDuplicates).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/warc", h.getCrawlJobWarc).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/har", h.getCrawlJobHar).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/export", h.exportCrawlJobLinks).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/sitemap.xml", h.getCrawlJobSitemap).Methods("GET")
+	r.HandleFunc("/crawlJobs/{id:[0-9]+}/sitemap-{part:[0-9]+}.xml", h.getCrawlJobSitemapPart).Methods("GET")
 	r.HandleFunc("/crawlJobs", h.getCrawlJobs).Methods("GET")
 	r.HandleFunc("/crawlJobs", h.addCrawlJob).Methods("POST")
 }
 
+// registerCrawlJobsUploadHandler registers the routes that accept uploads in
+// other formats than json.
+func (h *CrawlJobsHandler) registerCrawlJobsUploadHandler(r *mux.Router) {
+	r.HandleFunc("/crawlJobs/list", h.addListCrawlJob).Methods("POST")
+}
+
 func (h *CrawlJobsHandler) getCrawlJob(rw http.ResponseWriter, r *http.Request) {
 
 	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
@@ -66,8 +224,61 @@ func (h *CrawlJobsHandler) getCrawlJob(rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	traps, err := h.crawlJobRepository.GetCrawlTraps(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(rw).Encode(CrawlJobResult{CrawlJob: job, Traps: traps}); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *CrawlJobsHandler) getCrawlJobAnalysis(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	// only pages are part of the link graph
+	links, err := h.linkRepository.GetLinks(jobId, dal.LinkFilter{Kind: string(crawler.NavigationLink)})
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pages := make([]analysis.PageMetrics, 0, len(links))
+	for _, link := range links {
+		pages = append(pages, analysis.PageMetrics{
+			Url:          link.Url,
+			ClickDepth:   link.ClickDepth,
+			PageRank:     link.PageRank,
+			InboundLinks: link.InboundLinks,
+			Orphan:       link.Orphan,
+		})
+	}
+
 	rw.Header().Set("Content-type", "application/json")
-	if err := json.NewEncoder(rw).Encode(job); err != nil {
+	if err := json.NewEncoder(rw).Encode(analysis.Summarize(pages, topPagesInSummary)); err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -89,25 +300,171 @@ func (h *CrawlJobsHandler) getCrawlJobs(rw http.ResponseWriter, r *http.Request)
 func (h *CrawlJobsHandler) addCrawlJob(rw http.ResponseWriter, r *http.Request) {
 
 	var job CrawlJobRequest
-	if err := json.NewDecoder(r.Body).Decode(&job); err != nil || job.BaseUrl == "" {
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
 		http.Error(rw, "Invalid json body", http.StatusBadRequest)
 		return
 	}
 
-	// check if job base url exists
-	// if so return the job id
-	existingJob, err := h.crawlJobRepository.GetCrawlJobForUrl(job.BaseUrl)
+	h.startCrawlJob(rw, r, job)
+}
+
+// startCrawlJob validates the job, adds it unless a job was already added
+// for its base url, writes its id and crawls it in the background.
+func (h *CrawlJobsHandler) startCrawlJob(rw http.ResponseWriter, r *http.Request, job CrawlJobRequest) {
+
+	if err := job.validateMode(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if job.Mode == ListMode && job.BaseUrl == "" {
+		job.BaseUrl = job.Urls[0]
+	}
+
+	analysisOptions := analysis.DefaultOptions()
+	if job.PageRankDamping != 0 {
+		if job.PageRankDamping < 0 || job.PageRankDamping >= 1 {
+			http.Error(rw, "pageRankDamping must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		analysisOptions.Damping = job.PageRankDamping
+	}
+
+	if job.MaxBodySize < 0 || job.MaxParseSize < 0 {
+		http.Error(rw, "maxBodySize and maxParseSize must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := job.Fetch.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := job.Scope.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := job.Canonicalization.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := job.Traps.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := job.Auth.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !job.Auth.IsZero() && h.credentials == nil {
+		http.Error(rw, "authenticated crawls require the server to have a credentials key", http.StatusBadRequest)
+		return
+	}
+
+	var snapshots blobstore.BlobStore
+	if job.Snapshots != "" {
+		var ok bool
+		if snapshots, ok = h.snapshots[job.Snapshots]; !ok {
+			http.Error(rw, fmt.Sprintf("unknown snapshot store %q", job.Snapshots), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if job.WarcMaxFileSize < 0 {
+		http.Error(rw, "warcMaxFileSize must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if job.Warc && h.warcDir == "" {
+		http.Error(rw, "archived crawls require the server to have a warc directory", http.StatusBadRequest)
+		return
+	}
+
+	if h.guard != nil {
+		// crawled addresses are checked again when connecting, this only
+		// rejects jobs that can't crawl anything early. Listed urls are only
+		// checked when fetched as they may be many.
+		checked := []string{job.Fetch.Proxy}
+		if job.Mode != ListMode {
+			checked = append(checked, job.seeds()...)
+		}
+		for _, u := range checked {
+			if err := h.guard.CheckUrl(r.Context(), u); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	pe, err := newPolicyExecuter(job)
 
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if existingJob != (dal.CrawlJob{}) {
-		if err := json.NewEncoder(rw).Encode(existingJob.JobId); err != nil {
+	// check if job base url exists
+	// if so return the job id, unless it's recrawled. Lists are checked
+	// again every time.
+	var history crawler.PageHistory
+	if job.Mode != ListMode {
+		existingJob, err := h.crawlJobRepository.GetCrawlJobForUrl(job.BaseUrl)
+
+		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if existingJob != (dal.CrawlJob{}) {
+			if !job.Recrawl {
+				if err := json.NewEncoder(rw).Encode(existingJob.JobId); err != nil {
+					http.Error(rw, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			// the pages of jobs in progress or failed may be missing, so
+			// recrawls compare with the last completed job
+			if existingJob.Status != dal.Completed {
+				existingJob, err = h.crawlJobRepository.GetCompletedCrawlJobForUrl(job.BaseUrl)
+
+				if err != nil {
+					http.Error(rw, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			if existingJob != (dal.CrawlJob{}) {
+				history = &jobHistory{
+					linkRepository: h.linkRepository,
+					jobId:          existingJob.JobId,
+					snapshots:      job.Snapshots,
+				}
+			}
+		}
+	}
+
+	// the auth config is encrypted before the job is added, so that a job
+	// isn't added for credentials that can't be stored
+	var encryptedAuth string
+	if !job.Auth.IsZero() {
+		if encryptedAuth, err = h.encryptAuth(job.Auth); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// the directory of archives is checked before the job is added, whose
+	// id its files are named after
+	if job.Warc {
+		if err := warc.CheckDir(h.warcDir); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		return
 	}
 
 	// add job with in progress status
@@ -118,18 +475,61 @@ func (h *CrawlJobsHandler) addCrawlJob(rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if encryptedAuth != "" {
+		if err := h.crawlJobRepository.SaveCrawlJobAuth(jobId, encryptedAuth); err != nil {
+			h.failCrawlJob(rw, jobId, err)
+			return
+		}
+	}
+
+	if job.Snapshots != "" {
+		if err := h.crawlJobRepository.SaveCrawlJobSnapshotStore(jobId, job.Snapshots); err != nil {
+			h.failCrawlJob(rw, jobId, err)
+			return
+		}
+	}
+
+	var archive *warc.Writer
+	if job.Warc {
+		if archive, err = warc.NewWriter(h.warcDir, warcPrefix(jobId), job.WarcMaxFileSize); err != nil {
+			h.failCrawlJob(rw, jobId, err)
+			return
+		}
+	}
+
 	if err := json.NewEncoder(rw).Encode(jobId); err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 	}
 
-	pe := crawler.NewPolicyExecutor(
-		"//a[@href[not(contains(.,'http')) and not(contains(.,'mailto:')) and not(contains(.,'tel:'))]]")
-	c := h.newCrawler(pe)
-
-	onLinksDiscovered := func(links []string) error {
+	c := h.newCrawler(pe, crawler.CrawlOptions{
+		SkipNoFollow:     job.SkipNoFollow,
+		UseSitemaps:      job.UseSitemaps,
+		MaxBodySize:      job.MaxBodySize,
+		MaxParseSize:     job.MaxParseSize,
+		Fetch:            job.Fetch,
+		Auth:             job.Auth,
+		Scope:            job.Scope,
+		ListMode:         job.Mode == ListMode,
+		Traps:            job.Traps,
+		Canonicalization: job.Canonicalization,
+		History:          history,
+		Snapshots:        snapshots,
+		Warc:             archive,
+	})
+
+	onLinksDiscovered := func(links []crawler.Link) error {
 		// add links to the db
 		for _, link := range links {
-			_, err := h.linkRepository.AddLink(link, jobId)
+			_, err := h.linkRepository.AddLink(dal.Link{
+				Url:         link.Url,
+				CrawlJobId:  jobId,
+				Kind:        string(link.Kind),
+				InSitemap:   link.Source == crawler.SitemapSource,
+				Linked:      link.Source == crawler.LinkedSource,
+				External:    link.External,
+				Seed:        link.Seed,
+				OriginalUrl: link.OriginalUrl,
+			})
 
 			if err != nil {
 				return err
@@ -139,21 +539,204 @@ func (h *CrawlJobsHandler) addCrawlJob(rw http.ResponseWriter, r *http.Request)
 		return nil
 	}
 
+	// collect the internal link graph between pages for the analysis and
+	// store what was learned about each page
+	graph := analysis.NewGraph()
+	onPageCrawled := func(page crawler.CrawledPage) error {
+		var targets []string
+		for _, link := range page.Links {
+			if link.Kind == crawler.NavigationLink {
+				targets = append(targets, link.Url)
+			}
+		}
+		graph.AddEdges(page.Url, targets)
+
+		var lastModified string
+		if !page.LastModified.IsZero() {
+			lastModified = page.LastModified.UTC().Format(time.RFC3339)
+		}
+
+		err := h.linkRepository.SaveCrawledPage(dal.Link{
+			Url:          page.Url,
+			OriginalUrl:  page.OriginalUrl,
+			FetchUrl:     page.FetchUrl,
+			CrawlJobId:   jobId,
+			StatusCode:   page.StatusCode,
+			Canonical:    page.Canonical,
+			NoIndex:      page.NoIndex,
+			NoFollow:     page.NoFollow,
+			ContentType:  page.ContentType,
+			LastModified: lastModified,
+			Parsed:       page.Parsed,
+			Charset:      page.Charset,
+			SizeLimit:    string(page.SizeLimit),
+			FetchError:   page.FetchError,
+			ParseError:   page.ParseError,
+			Seed:         page.Seed,
+			ETag:         page.ETag,
+			NotModified:  page.NotModified,
+			ContentHash:  page.ContentHash,
+			SimHash:      formatSimHash(page.SimHash),
+			SnapshotKey:  page.SnapshotKey,
+			Header:       page.Header,
+			Timings:      linkTimings(page.Timings),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// the links are kept for the pages to be recrawled
+		outlinks := pageOutlinks(page)
+		if len(outlinks) == 0 {
+			return nil
+		}
+		return h.linkRepository.SaveOutlinks(jobId, page.Url, outlinks)
+	}
+
 	go func() {
 		var wg sync.WaitGroup
 		wg.Add(1)
 
+		status := dal.Completed
 		go func() {
 			defer wg.Done()
 			//crawl
-			_, err := c.Crawl(job.BaseUrl, onLinksDiscovered)
+			_, err := c.Crawl(job.seeds(), onLinksDiscovered, onPageCrawled)
 			if err != nil {
 				log.Println(err.Error())
+				status = dal.Failed
 			}
 		}()
 
 		wg.Wait()
-		// once crawl finished then update the job status
-		h.crawlJobRepository.UpdateCrawlJobStatus(jobId, dal.Completed)
+		if archive != nil {
+			if err := archive.Close(); err != nil {
+				log.Println(err.Error())
+			}
+		}
+		// analyse the link graph before the job is marked as completed, the
+		// pages of a list aren't a link graph
+		if job.Mode != ListMode {
+			if err := h.saveCrawlTraps(jobId, c.Traps()); err != nil {
+				log.Println(err.Error())
+			}
+			if err := h.saveLinkAnalysis(jobId, job, graph, analysisOptions); err != nil {
+				log.Println(err.Error())
+			}
+		}
+		// once crawl finished then update the job status, failed if the
+		// crawl stopped on an error
+		h.crawlJobRepository.UpdateCrawlJobStatus(jobId, status)
 	}()
 }
+
+// newPolicyExecuter creates a composite policy executer from the rules and
+// filters of the job. A job can either list its rules or give a single policy,
+// otherwise the default rules are used.
+func newPolicyExecuter(job CrawlJobRequest) (crawler.CrawlPolicyExecuter, error) {
+	rules := job.Rules
+
+	if job.PolicyLanguage != "" || job.Policy != "" {
+		if len(rules) > 0 {
+			return nil, errors.New("either a policy or rules can be specified")
+		}
+
+		language := job.PolicyLanguage
+		if language == "" {
+			language = crawler.XPathPolicyLanguage
+		}
+
+		policy := job.Policy
+		if policy == "" {
+			policy = defaultPolicies[language]
+		}
+
+		rules = []crawler.ExtractionRule{{Language: language, Policy: policy}}
+	}
+
+	if len(rules) == 0 {
+		rules = crawler.DefaultExtractionRules
+	}
+
+	filters := job.Filters
+	if len(filters.Schemes) == 0 {
+		filters.Schemes = crawler.DefaultSchemes
+	}
+
+	return crawler.NewCompositePolicyExecutor(rules, filters)
+}
+
+func (h *CrawlJobsHandler) saveLinkAnalysis(
+	jobId int,
+	job CrawlJobRequest,
+	graph *analysis.Graph,
+	opts analysis.Options) error {
+
+	// the scope and canonicalization rules may rewrite the seeds, such as
+	// to https
+	seeds, err := crawler.CanonicalSeeds(job.seeds(), job.Scope, job.Canonicalization)
+
+	if err != nil {
+		return err
+	}
+
+	metrics := analysis.Analyze(graph, seeds, opts)
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	linkAnalysis := make([]dal.LinkAnalysis, 0, len(metrics))
+	for _, m := range metrics {
+		linkAnalysis = append(linkAnalysis, dal.LinkAnalysis{
+			Url:          m.Url,
+			ClickDepth:   m.ClickDepth,
+			PageRank:     m.PageRank,
+			InboundLinks: m.InboundLinks,
+			Orphan:       m.Orphan,
+		})
+	}
+
+	return h.linkRepository.SaveLinkAnalysis(jobId, linkAnalysis)
+}
+
+// saveCrawlTraps stores the crawler traps found by the crawl of a job.
+func (h *CrawlJobsHandler) saveCrawlTraps(jobId int, traps []crawler.Trap) error {
+	if len(traps) == 0 {
+		return nil
+	}
+
+	crawlTraps := make([]dal.CrawlTrap, 0, len(traps))
+	for _, trap := range traps {
+		crawlTraps = append(crawlTraps, dal.CrawlTrap{
+			Pattern: trap.Pattern,
+			Reason:  string(trap.Reason),
+			Count:   trap.Count,
+			Example: trap.Example,
+			Urls:    trap.Urls,
+		})
+	}
+
+	return h.crawlJobRepository.SaveCrawlTraps(jobId, crawlTraps)
+}
+
+// encryptAuth returns the auth config of a job encrypted, to be stored.
+func (h *CrawlJobsHandler) encryptAuth(auth crawler.AuthConfig) (string, error) {
+	plaintext, err := json.Marshal(auth)
+
+	if err != nil {
+		return "", err
+	}
+
+	return h.credentials.Encrypt(plaintext)
+}
+
+// failCrawlJob marks a job whose crawl couldn't be started as failed, rather
+// than leaving it in progress, and responds with the error.
+func (h *CrawlJobsHandler) failCrawlJob(rw http.ResponseWriter, jobId int, err error) {
+	if err := h.crawlJobRepository.UpdateCrawlJobStatus(jobId, dal.Failed); err != nil {
+		log.Println(err.Error())
+	}
+	http.Error(rw, err.Error(), http.StatusInternalServerError)
+}
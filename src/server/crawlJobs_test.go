@@ -2,16 +2,29 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/alicansa/go-linkcrawler/analysis"
+	"github.com/alicansa/go-linkcrawler/blobstore"
 	"github.com/alicansa/go-linkcrawler/crawler"
 	"github.com/alicansa/go-linkcrawler/dal"
 	"github.com/alicansa/go-linkcrawler/mocks"
+	"github.com/alicansa/go-linkcrawler/secrets"
+	"github.com/alicansa/go-linkcrawler/sitemap"
+	"github.com/alicansa/go-linkcrawler/warc"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -23,6 +36,12 @@ type CrawlJobsTest struct {
 	mockCrawlJobRepo *mocks.MockCrawlJobRepository
 	mockLinkRepo     *mocks.MockLinkRepository
 	mockWebCrawler   *mocks.MockWebCrawler
+	newCrawler       func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler
+	credentials      *secrets.Cipher
+	snapshots        blobstore.BlobStore
+	warcDir          string
+	// traps are returned by the mock crawler once a job is crawled
+	traps []crawler.Trap
 }
 
 func TestCrawlJobs(t *testing.T) {
@@ -34,11 +53,75 @@ func TestCrawlJobs(t *testing.T) {
 	t.Run("Test getCrawlJob returns internal server error on db issue", cjt.testGetCrawlJobReturnsInternalServerErrorOnDbError)
 	t.Run("Test getCrawlJob returns not found if job doesn't exist", cjt.testGetCrawlJobReturnsNotFoundIfJobDoesntExist)
 	t.Run("Test successful getCrawlJob call", cjt.testSuccessfulGetCrawlJob)
+	t.Run("Test successful getCrawlJob call with traps", cjt.testSuccessfulGetCrawlJobWithTraps)
 	t.Run("Test getCrawlJobs returns internal server error on db issue", cjt.testGetCrawlJobsReturnsInternalServerErrorOnDbError)
 	t.Run("Test successful getCrawlJobs call", cjt.testSuccessfulGetCrawlJobs)
 	t.Run("Test add crawlJobs returns bad request on invalid json", cjt.testAddCrawlJobReturnsBadRequestOnInvalidJson)
 	t.Run("Test add crawlJobs returns job id if url already added", cjt.testAddCrawlJobReturnsJobIdIfAlreadyAdded)
 	t.Run("Test successful add crawlJobs", cjt.testSuccessfulAddCrawlJob)
+	t.Run("Test add crawlJobs returns bad request on invalid damping", cjt.testAddCrawlJobReturnsBadRequestOnInvalidDamping)
+	t.Run("Test add crawlJobs returns bad request on unsupported policy language", cjt.testAddCrawlJobReturnsBadRequestOnUnsupportedPolicyLanguage)
+	t.Run("Test add crawlJobs returns bad request on invalid policy", cjt.testAddCrawlJobReturnsBadRequestOnInvalidPolicy)
+	t.Run("Test successful add crawlJobs with css policy", cjt.testSuccessfulAddCrawlJobWithCSSPolicy)
+	t.Run("Test add crawlJobs returns bad request on policy and rules", cjt.testAddCrawlJobReturnsBadRequestOnPolicyAndRules)
+	t.Run("Test add crawlJobs returns bad request on invalid filter", cjt.testAddCrawlJobReturnsBadRequestOnInvalidFilter)
+	t.Run("Test successful add crawlJobs with rules and filters", cjt.testSuccessfulAddCrawlJobWithRulesAndFilters)
+	t.Run("Test successful add crawlJobs with skip nofollow", cjt.testSuccessfulAddCrawlJobWithSkipNoFollow)
+	t.Run("Test successful add crawlJobs with sitemaps", cjt.testSuccessfulAddCrawlJobWithSitemaps)
+	t.Run("Test add crawlJobs returns bad request on negative size limit", cjt.testAddCrawlJobReturnsBadRequestOnNegativeSizeLimit)
+	t.Run("Test successful add crawlJobs with size limits", cjt.testSuccessfulAddCrawlJobWithSizeLimits)
+	t.Run("Test add crawlJobs returns bad request on invalid fetch config", cjt.testAddCrawlJobReturnsBadRequestOnInvalidFetchConfig)
+	t.Run("Test successful add crawlJobs with fetch config", cjt.testSuccessfulAddCrawlJobWithFetchConfig)
+	t.Run("Test add crawlJobs returns bad request on invalid scope", cjt.testAddCrawlJobReturnsBadRequestOnInvalidScope)
+	t.Run("Test successful add crawlJobs with scope", cjt.testSuccessfulAddCrawlJobWithScope)
+	t.Run("Test add crawlJobs returns bad request on invalid seed", cjt.testAddCrawlJobReturnsBadRequestOnInvalidSeed)
+	t.Run("Test successful add crawlJobs with seeds", cjt.testSuccessfulAddCrawlJobWithSeeds)
+	t.Run("Test add crawlJobs returns bad request on unknown snapshot store", cjt.testAddCrawlJobReturnsBadRequestOnUnknownSnapshotStore)
+	t.Run("Test successful add crawlJobs with snapshots", cjt.testSuccessfulAddCrawlJobWithSnapshots)
+	t.Run("Test add crawlJobs marks job failed if snapshot store can't be stored", cjt.testAddCrawlJobMarksJobFailedIfSnapshotStoreCantBeStored)
+	t.Run("Test add crawlJobs returns bad request on warc without warc directory", cjt.testAddCrawlJobReturnsBadRequestOnWarcWithoutWarcDir)
+	t.Run("Test successful add crawlJobs with warc", cjt.testSuccessfulAddCrawlJobWithWarc)
+	t.Run("Test add crawlJobs doesn't add job if warc directory isn't writable", cjt.testAddCrawlJobDoesntAddJobIfWarcDirIsntWritable)
+	t.Run("Test add crawlJobs returns bad request on invalid traps", cjt.testAddCrawlJobReturnsBadRequestOnInvalidTraps)
+	t.Run("Test successful add crawlJobs saves traps", cjt.testSuccessfulAddCrawlJobSavesTraps)
+	t.Run("Test add crawlJobs returns bad request on invalid canonicalization", cjt.testAddCrawlJobReturnsBadRequestOnInvalidCanonicalization)
+	t.Run("Test successful add crawlJobs with canonicalization", cjt.testSuccessfulAddCrawlJobWithCanonicalization)
+	t.Run("Test successful recrawl of crawlJob", cjt.testSuccessfulRecrawlOfCrawlJob)
+	t.Run("Test recrawl compares with last completed crawlJob", cjt.testRecrawlComparesWithLastCompletedCrawlJob)
+	t.Run("Test addCrawlJob marks job failed if crawl fails", cjt.testAddCrawlJobMarksJobFailedIfCrawlFails)
+	t.Run("Test job history returns previous pages with their links", cjt.testJobHistoryReturnsPreviousPagesWithLinks)
+	t.Run("Test job history returns snapshots of previous pages", cjt.testJobHistoryReturnsSnapshotsOfPreviousPages)
+	t.Run("Test add crawlJobs returns bad request on invalid list", cjt.testAddCrawlJobReturnsBadRequestOnInvalidList)
+	t.Run("Test successful add crawlJobs in list mode", cjt.testSuccessfulAddCrawlJobInListMode)
+	t.Run("Test successful upload of csv url list", cjt.testSuccessfulUploadOfCsvUrlList)
+	t.Run("Test successful upload of url list form", cjt.testSuccessfulUploadOfUrlListForm)
+	t.Run("Test upload returns unsupported media type", cjt.testUploadReturnsUnsupportedMediaType)
+	t.Run("Test add crawlJobs returns bad request on invalid auth", cjt.testAddCrawlJobReturnsBadRequestOnInvalidAuth)
+	t.Run("Test add crawlJobs returns bad request on auth without credentials key", cjt.testAddCrawlJobReturnsBadRequestOnAuthWithoutCredentialsKey)
+	t.Run("Test successful add crawlJobs with auth", cjt.testSuccessfulAddCrawlJobWithAuth)
+	t.Run("Test add crawlJobs marks job failed if auth can't be stored", cjt.testAddCrawlJobMarksJobFailedIfAuthCantBeStored)
+	t.Run("Test add crawlJobs returns bad request on blocked address", cjt.testAddCrawlJobReturnsBadRequestOnBlockedAddress)
+	t.Run("Test getCrawlJobAnalysis returns not found if job doesn't exist", cjt.testGetCrawlJobAnalysisReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test successful getCrawlJobAnalysis call", cjt.testSuccessfulGetCrawlJobAnalysis)
+	t.Run("Test getCrawlJobWarc returns not found if job doesn't exist", cjt.testGetCrawlJobWarcReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test getCrawlJobWarc returns conflict if job is in progress", cjt.testGetCrawlJobWarcReturnsConflictIfJobIsInProgress)
+	t.Run("Test successful getCrawlJobWarc call", cjt.testSuccessfulGetCrawlJobWarc)
+	t.Run("Test getCrawlJobHar returns not found if job doesn't exist", cjt.testGetCrawlJobHarReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test successful getCrawlJobHar call", cjt.testSuccessfulGetCrawlJobHar)
+	t.Run("Test export returns bad request on invalid format", cjt.testExportReturnsBadRequestOnInvalidFormat)
+	t.Run("Test export returns bad request on invalid column", cjt.testExportReturnsBadRequestOnInvalidColumn)
+	t.Run("Test export returns not found if job doesn't exist", cjt.testExportReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test export returns internal server error on db error", cjt.testExportReturnsInternalServerErrorOnDbError)
+	t.Run("Test export stops when client goes away", cjt.testExportStopsWhenClientGoesAway)
+	t.Run("Test successful csv export", cjt.testSuccessfulCsvExport)
+	t.Run("Test successful jsonl export", cjt.testSuccessfulJsonlExport)
+	t.Run("Test getCrawlJobSitemap returns not found if job doesn't exist", cjt.testGetCrawlJobSitemapReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test getCrawlJobSitemap returns conflict if job is in progress", cjt.testGetCrawlJobSitemapReturnsConflictIfJobIsInProgress)
+	t.Run("Test successful getCrawlJobSitemap call", cjt.testSuccessfulGetCrawlJobSitemap)
+	t.Run("Test getCrawlJobSitemap returns index of parts for large crawls", cjt.testGetCrawlJobSitemapReturnsIndexForLargeCrawls)
+	t.Run("Test getCrawlJobDuplicates returns bad request on invalid threshold", cjt.testGetCrawlJobDuplicatesReturnsBadRequestOnInvalidThreshold)
+	t.Run("Test getCrawlJobDuplicates returns not found if job doesn't exist", cjt.testGetCrawlJobDuplicatesReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test successful getCrawlJobDuplicates call", cjt.testSuccessfulGetCrawlJobDuplicates)
 }
 
 func (cjt *CrawlJobsTest) setupSuite(t *testing.T) func(t *testing.T) {
@@ -52,17 +135,44 @@ func (cjt *CrawlJobsTest) setupSuite(t *testing.T) func(t *testing.T) {
 	mockWebCrawler := mocks.NewMockWebCrawler(cjt.controller)
 	cjt.mockWebCrawler = mockWebCrawler
 
+	credentials, err := secrets.NewCipher(bytes.Repeat([]byte{1}, secrets.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cjt.credentials = credentials
+
+	guard, err := crawler.NewAddressGuard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cjt.snapshots = snapshots
+	cjt.warcDir = t.TempDir()
+
 	//create router and link it up
 	r := mux.NewRouter()
 	crawlJobsHandler := NewCrawlJobHandler(
 		mockCrawlJobRepo,
 		mockLinkRepo,
-		func(pe crawler.CrawlPolicyExecuter) crawler.WebCrawler {
+		func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler {
+			// tests can capture the policy executer by overriding newCrawler
+			if cjt.newCrawler != nil {
+				return cjt.newCrawler(pe, opts)
+			}
 			return mockWebCrawler
 		},
+		credentials,
+		guard,
+		map[string]blobstore.BlobStore{"local": snapshots},
+		cjt.warcDir,
 	)
 
 	crawlJobsHandler.registerCrawlJobsHandler(r)
+	crawlJobsHandler.registerCrawlJobsUploadHandler(r)
 	cjt.server = httptest.NewServer(r)
 
 	return func(t *testing.T) {
@@ -107,6 +217,7 @@ func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJob(t *testing.T) {
 		JobId:       123,
 	}
 	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlTraps(123).Return(nil, nil).Times(1)
 
 	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123")
 
@@ -126,6 +237,40 @@ func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJob(t *testing.T) {
 	assert.Equal(t, job, respJob)
 }
 
+func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJobWithTraps(t *testing.T) {
+
+	job := dal.CrawlJob{
+		BaseUrl:     "test",
+		LastUpdated: "10:11:14",
+		Status:      dal.Completed,
+		JobId:       123,
+	}
+	traps := []dal.CrawlTrap{{
+		Pattern: "https://test.com/calendar?*",
+		Reason:  "queryVariants",
+		Count:   12,
+		Example: "https://test.com/calendar?month=2031-01",
+		Urls:    []string{"https://test.com/calendar?month=2031-01", "https://test.com/calendar?month=2031-02"},
+	}}
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlTraps(123).Return(traps, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var respJob CrawlJobResult
+	if err = json.NewDecoder(resp.Body).Decode(&respJob); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, CrawlJobResult{CrawlJob: job, Traps: traps}, respJob)
+}
+
 func (cjt *CrawlJobsTest) testGetCrawlJobsReturnsInternalServerErrorOnDbError(t *testing.T) {
 
 	var emptyJobs []dal.CrawlJob
@@ -237,7 +382,8 @@ func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJob(t *testing.T) {
 	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").Return(dal.CrawlJob{}, nil)
 	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob("test").Return(123, nil)
 	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(123, dal.Completed).Return(nil)
-	cjt.mockWebCrawler.EXPECT().Crawl("test", gomock.Any()).Return(discoveredLinks, nil).Times(1)
+	cjt.mockWebCrawler.EXPECT().Crawl([]string{"test"}, gomock.Any(), gomock.Any()).Return(discoveredLinks, nil).Times(1)
+	cjt.mockWebCrawler.EXPECT().Traps().Return(nil).Times(1)
 
 	request := CrawlJobRequest{
 		BaseUrl: "test",
@@ -268,3 +414,1385 @@ func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJob(t *testing.T) {
 
 	assert.Equal(t, "123\n", result)
 }
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidDamping(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","pageRankDamping":1.5}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnUnsupportedPolicyLanguage(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","policyLanguage":"regex"}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidPolicy(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","policyLanguage":"css","policy":"a[href"}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// crawlerArgs are the arguments the handler created the crawler of a job with.
+type crawlerArgs struct {
+	pe    crawler.CrawlPolicyExecuter
+	opts  crawler.CrawlOptions
+	seeds []string
+}
+
+// addCrawlJobAndWait posts a job for the "test" base url and waits for its
+// crawl to complete, returning the response and the crawler arguments.
+func (cjt *CrawlJobsTest) addCrawlJobAndWait(t *testing.T, jobId int, body string) (*http.Response, crawlerArgs) {
+
+	var args crawlerArgs
+	cjt.newCrawler = func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler {
+		args = crawlerArgs{pe: pe, opts: opts}
+		return cjt.mockWebCrawler
+	}
+	defer func() { cjt.newCrawler = nil }()
+
+	done := make(chan struct{})
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").Return(dal.CrawlJob{}, nil)
+	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob("test").Return(jobId, nil)
+	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(jobId, dal.Completed).
+		Do(func(int, dal.CrawlJobStatus) { close(done) }).
+		Return(nil)
+	cjt.mockWebCrawler.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(seeds []string, _ func([]crawler.Link) error, _ func(crawler.CrawledPage) error) {
+			args.seeds = seeds
+		}).
+		Return(nil, nil).Times(1)
+	cjt.mockWebCrawler.EXPECT().Traps().Return(cjt.traps).Times(1)
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-done
+	return resp, args
+}
+
+// addCrawlJobThatFailsToStart sends the request of a job that fails to be
+// started once it was added, which must be marked as failed without being
+// crawled.
+func (cjt *CrawlJobsTest) addCrawlJobThatFailsToStart(t *testing.T, jobId int, body string) *http.Response {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").Return(dal.CrawlJob{}, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob("test").Return(jobId, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(jobId, dal.Failed).Return(nil).Times(1)
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithCSSPolicy(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 124, `{"baseUrl":"test","policyLanguage":"css"}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cpe, ok := args.pe.(*crawler.CompositePolicyExecutor)
+	assert.True(t, ok)
+	assert.Equal(t, []crawler.ExtractionRule{{Language: crawler.CSSPolicyLanguage, Policy: "a[href]"}}, cpe.Rules)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnPolicyAndRules(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","policy":"//a[@href]","rules":[{"policy":"//area[@href]"}]}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidFilter(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","filters":{"exclude":[{"type":"regex","pattern":"("}]}}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithRulesAndFilters(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 125, `{
+		"baseUrl":"test",
+		"rules":[{"policy":"//a[@href]"},{"language":"css","policy":"iframe[src]","attribute":"src"}],
+		"filters":{"include":[{"type":"prefix","pattern":"/docs/"}]}
+	}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cpe, ok := args.pe.(*crawler.CompositePolicyExecutor)
+	assert.True(t, ok)
+	assert.Len(t, cpe.Rules, 2)
+	assert.Equal(t, crawler.DefaultSchemes, cpe.Filters.Schemes)
+	assert.Equal(t, []crawler.URLFilter{{Type: crawler.PrefixURLFilter, Pattern: "/docs/"}}, cpe.Filters.Include)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithSkipNoFollow(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 126, `{"baseUrl":"test","skipNoFollow":true}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, args.opts.SkipNoFollow)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithSitemaps(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 127, `{"baseUrl":"test","useSitemaps":true}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, args.opts.UseSitemaps)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnNegativeSizeLimit(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","maxBodySize":-1}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithSizeLimits(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 128, `{"baseUrl":"test","maxBodySize":1048576,"maxParseSize":65536}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(1048576), args.opts.MaxBodySize)
+	assert.Equal(t, int64(65536), args.opts.MaxParseSize)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidFetchConfig(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","fetch":{"proxy":"ftp://proxy:21"}}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithFetchConfig(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 129, `{"baseUrl":"test","fetch":{"timeout":"5s","userAgent":"test-agent"}}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, crawler.FetchConfig{
+		Timeout:   crawler.Duration(5 * time.Second),
+		UserAgent: "test-agent",
+	}, args.opts.Fetch)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidScope(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","scope":{"pathPrefix":"docs"}}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithScope(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 131, `{
+		"baseUrl":"test",
+		"scope":{"hosts":["blog.test"],"includeSubdomains":true,"aliases":[["test","www.test"]],"scheme":"upgrade","pathPrefix":"/docs/"}
+	}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, crawler.ScopeConfig{
+		Hosts:             []string{"blog.test"},
+		IncludeSubdomains: true,
+		Aliases:           [][]string{{"test", "www.test"}},
+		Scheme:            crawler.UpgradeScheme,
+		PathPrefix:        "/docs/",
+	}, args.opts.Scope)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidSeed(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","seeds":[""]}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithSeeds(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 132, `{"baseUrl":"test","seeds":["test/en/","test/landing"]}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"test", "test/en/", "test/landing"}, args.seeds)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnUnknownSnapshotStore(t *testing.T) {
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(`{"baseUrl":"test","snapshots":"s3"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithSnapshots(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().SaveCrawlJobSnapshotStore(139, "local").Return(nil).Times(1)
+
+	resp, args := cjt.addCrawlJobAndWait(t, 139, `{"baseUrl":"test","snapshots":"local"}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, cjt.snapshots, args.opts.Snapshots)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobMarksJobFailedIfSnapshotStoreCantBeStored(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().SaveCrawlJobSnapshotStore(145, "local").Return(errors.New("db error")).Times(1)
+
+	resp := cjt.addCrawlJobThatFailsToStart(t, 145, `{"baseUrl":"test","snapshots":"local"}`)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnWarcWithoutWarcDir(t *testing.T) {
+
+	handler := NewCrawlJobHandler(cjt.mockCrawlJobRepo, cjt.mockLinkRepo, nil, nil, nil, nil, "")
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/crawlJobs",
+		strings.NewReader(`{"baseUrl":"test","warc":true}`))
+	rec := httptest.NewRecorder()
+
+	handler.addCrawlJob(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithWarc(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 140, `{"baseUrl":"test","warc":true,"warcMaxFileSize":4096}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, args.opts.Warc)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobDoesntAddJobIfWarcDirIsntWritable(t *testing.T) {
+
+	// the directory can't be created under a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").Return(dal.CrawlJob{}, nil).Times(1)
+
+	handler := NewCrawlJobHandler(cjt.mockCrawlJobRepo, cjt.mockLinkRepo, nil, nil, nil, nil, filepath.Join(file, "warc"))
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/crawlJobs",
+		strings.NewReader(`{"baseUrl":"test","warc":true}`))
+	rec := httptest.NewRecorder()
+
+	handler.addCrawlJob(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidTraps(t *testing.T) {
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(`{"baseUrl":"test","traps":{"maxPathDepth":-1}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobSavesTraps(t *testing.T) {
+
+	cjt.traps = []crawler.Trap{{
+		Pattern: "https://test.com/a/b/a/b/a/b/*",
+		Reason:  crawler.RepeatedSegmentsTrap,
+		Count:   3,
+		Example: "https://test.com/a/b/a/b/a/b/",
+		Urls:    []string{"https://test.com/a/b/a/b/a/b/", "https://test.com/a/b/a/b/a/b/a/"},
+	}}
+	defer func() { cjt.traps = nil }()
+
+	cjt.mockCrawlJobRepo.EXPECT().SaveCrawlTraps(136, []dal.CrawlTrap{{
+		Pattern: "https://test.com/a/b/a/b/a/b/*",
+		Reason:  "repeatedSegments",
+		Count:   3,
+		Example: "https://test.com/a/b/a/b/a/b/",
+		Urls:    []string{"https://test.com/a/b/a/b/a/b/", "https://test.com/a/b/a/b/a/b/a/"},
+	}}).Return(nil).Times(1)
+
+	resp, args := cjt.addCrawlJobAndWait(t, 136, `{"baseUrl":"test","traps":{"maxRepeatedSegments":1,"sessionParams":["visit"]}}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, crawler.TrapConfig{MaxRepeatedSegments: 1, SessionParams: []string{"visit"}}, args.opts.Traps)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidCanonicalization(t *testing.T) {
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(`{"baseUrl":"test","canonicalization":{"stripParams":["utm_["]}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithCanonicalization(t *testing.T) {
+
+	resp, args := cjt.addCrawlJobAndWait(t, 137, `{"baseUrl":"test","canonicalization":{"stripParams":["utm_*"],"sortParams":true,"ignoreParams":["ref"],"lowercasePaths":true}}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, crawler.CanonicalizationConfig{
+		StripParams:    []string{"utm_*"},
+		SortParams:     true,
+		IgnoreParams:   []string{"ref"},
+		LowercasePaths: true,
+	}, args.opts.Canonicalization)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulRecrawlOfCrawlJob(t *testing.T) {
+
+	var opts crawler.CrawlOptions
+	cjt.newCrawler = func(pe crawler.CrawlPolicyExecuter, o crawler.CrawlOptions) crawler.WebCrawler {
+		opts = o
+		return cjt.mockWebCrawler
+	}
+	defer func() { cjt.newCrawler = nil }()
+
+	page := crawler.CrawledPage{
+		Url:         "https://test.com/",
+		StatusCode:  http.StatusOK,
+		ETag:        `"v1"`,
+		NotModified: true,
+		Links: []crawler.Link{
+			{Url: "https://test.com/a", OriginalUrl: "https://test.com/a?utm_source=x", Kind: crawler.NavigationLink},
+		},
+		ExternalLinks: []crawler.Link{
+			{Url: "https://other.com/", Kind: crawler.NavigationLink, Rel: []string{"nofollow"}, External: true},
+		},
+	}
+
+	done := make(chan struct{})
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").Return(dal.CrawlJob{BaseUrl: "test", JobId: 123, Status: dal.Completed}, nil)
+	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob("test").Return(138, nil)
+	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(138, dal.Completed).
+		Do(func(int, dal.CrawlJobStatus) { close(done) }).
+		Return(nil)
+	cjt.mockWebCrawler.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ []string, _ func([]crawler.Link) error, onPageCrawled func(crawler.CrawledPage) error) (map[string]struct{}, error) {
+			return nil, onPageCrawled(page)
+		}).Times(1)
+	cjt.mockWebCrawler.EXPECT().Traps().Return(nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().SaveCrawledPage(dal.Link{
+		Url:         "https://test.com/",
+		CrawlJobId:  138,
+		StatusCode:  http.StatusOK,
+		ETag:        `"v1"`,
+		NotModified: true,
+	}).Return(nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().SaveOutlinks(138, "https://test.com/", []dal.Outlink{
+		{Url: "https://test.com/a?utm_source=x", Kind: "navigation"},
+		{Url: "https://other.com/", Kind: "navigation", Rel: []string{"nofollow"}, External: true},
+	}).Return(nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().SaveLinkAnalysis(138, gomock.Any()).Return(nil).Times(1)
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(`{"baseUrl":"test","recrawl":true}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-done
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, &jobHistory{linkRepository: cjt.mockLinkRepo, jobId: 123}, opts.History)
+}
+
+func (cjt *CrawlJobsTest) testRecrawlComparesWithLastCompletedCrawlJob(t *testing.T) {
+
+	var opts crawler.CrawlOptions
+	cjt.newCrawler = func(pe crawler.CrawlPolicyExecuter, o crawler.CrawlOptions) crawler.WebCrawler {
+		opts = o
+		return cjt.mockWebCrawler
+	}
+	defer func() { cjt.newCrawler = nil }()
+
+	done := make(chan struct{})
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").
+		Return(dal.CrawlJob{BaseUrl: "test", JobId: 125, Status: dal.Failed}, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().GetCompletedCrawlJobForUrl("test").
+		Return(dal.CrawlJob{BaseUrl: "test", JobId: 123, Status: dal.Completed}, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob("test").Return(146, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(146, dal.Completed).
+		Do(func(int, dal.CrawlJobStatus) { close(done) }).
+		Return(nil).Times(1)
+	cjt.mockWebCrawler.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).Times(1)
+	cjt.mockWebCrawler.EXPECT().Traps().Return(nil).Times(1)
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(`{"baseUrl":"test","recrawl":true}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	<-done
+	assert.Equal(t, &jobHistory{linkRepository: cjt.mockLinkRepo, jobId: 123}, opts.History)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobMarksJobFailedIfCrawlFails(t *testing.T) {
+
+	done := make(chan struct{})
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJobForUrl("test").Return(dal.CrawlJob{}, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob("test").Return(147, nil).Times(1)
+	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(147, dal.Failed).
+		Do(func(int, dal.CrawlJobStatus) { close(done) }).
+		Return(nil).Times(1)
+	cjt.mockWebCrawler.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("db error")).Times(1)
+	cjt.mockWebCrawler.EXPECT().Traps().Return(nil).Times(1)
+
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		strings.NewReader(`{"baseUrl":"test"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	<-done
+}
+
+func (cjt *CrawlJobsTest) testJobHistoryReturnsPreviousPagesWithLinks(t *testing.T) {
+
+	history := &jobHistory{linkRepository: cjt.mockLinkRepo, jobId: 123}
+	cjt.mockLinkRepo.EXPECT().GetLinks(123, dal.LinkFilter{Url: "https://test.com/"}).Return([]dal.Link{{
+		Url:          "https://test.com/",
+		StatusCode:   http.StatusOK,
+		ContentType:  "text/html",
+		LastModified: "2022-01-02T03:04:05Z",
+		ETag:         `"v1"`,
+		Parsed:       true,
+	}}, nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().GetOutlinks(123, "https://test.com/").Return([]dal.Outlink{
+		{Url: "https://test.com/a", Kind: "navigation"},
+		{Url: "https://other.com/", Kind: "navigation", External: true},
+	}, nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().GetLinks(123, dal.LinkFilter{Url: "https://test.com/new"}).Return(nil, nil).Times(1)
+
+	page, ok, err := history.PreviousPage("https://test.com/")
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, crawler.CrawledPage{
+		Url:           "https://test.com/",
+		StatusCode:    http.StatusOK,
+		ContentType:   "text/html",
+		LastModified:  time.Date(2022, time.January, 2, 3, 4, 5, 0, time.UTC),
+		ETag:          `"v1"`,
+		Parsed:        true,
+		Links:         []crawler.Link{{Url: "https://test.com/a", Kind: crawler.NavigationLink}},
+		ExternalLinks: []crawler.Link{{Url: "https://other.com/", Kind: crawler.NavigationLink, External: true}},
+	}, page)
+
+	_, ok, err = history.PreviousPage("https://test.com/new")
+
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func (cjt *CrawlJobsTest) testJobHistoryReturnsSnapshotsOfPreviousPages(t *testing.T) {
+
+	history := &jobHistory{linkRepository: cjt.mockLinkRepo, jobId: 123, snapshots: "local"}
+	for _, url := range []string{"https://test.com/", "https://test.com/elsewhere"} {
+		cjt.mockLinkRepo.EXPECT().GetLinks(123, dal.LinkFilter{Url: url}).Return([]dal.Link{{
+			Url:         url,
+			StatusCode:  http.StatusOK,
+			ETag:        `"v1"`,
+			SnapshotKey: "abc",
+		}}, nil).Times(1)
+		cjt.mockLinkRepo.EXPECT().GetOutlinks(123, url).Return(nil, nil).Times(1)
+	}
+	cjt.mockLinkRepo.EXPECT().GetSnapshot(gomock.Any()).Return(dal.Snapshot{
+		Store:  "local",
+		Key:    "abc",
+		Header: map[string][]string{"Content-Type": {"text/html"}},
+	}, nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().GetSnapshot(gomock.Any()).Return(dal.Snapshot{
+		Store: "s3",
+		Key:   "abc",
+	}, nil).Times(1)
+
+	page, ok, err := history.PreviousPage("https://test.com/")
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", page.SnapshotKey)
+	assert.Equal(t, http.Header{"Content-Type": {"text/html"}}, page.Header)
+
+	// snapshots of other stores aren't kept
+	page, ok, err = history.PreviousPage("https://test.com/elsewhere")
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, page.SnapshotKey)
+	assert.Nil(t, page.Header)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidList(t *testing.T) {
+
+	for _, body := range []string{
+		`{"mode":"list"}`,
+		`{"mode":"list","urls":["/relative"]}`,
+		`{"mode":"list","urls":["https://test.com/"],"useSitemaps":true}`,
+		`{"mode":"list","urls":["https://test.com/"],"recrawl":true}`,
+		`{"baseUrl":"test","urls":["https://test.com/"]}`,
+		`{"baseUrl":"test","mode":"sample"}`,
+	} {
+		resp, err := http.Post(
+			cjt.server.URL+"/crawlJobs",
+			"application/json",
+			strings.NewReader(body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+}
+
+// addListCrawlJobAndWait sends the request of a list mode job and waits for
+// its crawl to complete, returning the response and the crawler arguments.
+func (cjt *CrawlJobsTest) addListCrawlJobAndWait(
+	t *testing.T,
+	jobId int,
+	baseUrl string,
+	send func() (*http.Response, error)) (*http.Response, crawlerArgs) {
+
+	var args crawlerArgs
+	cjt.newCrawler = func(pe crawler.CrawlPolicyExecuter, opts crawler.CrawlOptions) crawler.WebCrawler {
+		args = crawlerArgs{pe: pe, opts: opts}
+		return cjt.mockWebCrawler
+	}
+	defer func() { cjt.newCrawler = nil }()
+
+	done := make(chan struct{})
+	cjt.mockCrawlJobRepo.EXPECT().AddCrawlJob(baseUrl).Return(jobId, nil)
+	cjt.mockCrawlJobRepo.EXPECT().UpdateCrawlJobStatus(jobId, dal.Completed).
+		Do(func(int, dal.CrawlJobStatus) { close(done) }).
+		Return(nil)
+	cjt.mockWebCrawler.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(seeds []string, _ func([]crawler.Link) error, _ func(crawler.CrawledPage) error) {
+			args.seeds = seeds
+		}).
+		Return(nil, nil).Times(1)
+
+	resp, err := send()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-done
+	return resp, args
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobInListMode(t *testing.T) {
+
+	resp, args := cjt.addListCrawlJobAndWait(t, 133, "https://test.com/a", func() (*http.Response, error) {
+		return http.Post(
+			cjt.server.URL+"/crawlJobs",
+			"application/json",
+			strings.NewReader(`{"mode":"list","urls":["https://test.com/a","https://other.com/b"]}`))
+	})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, args.opts.ListMode)
+	assert.Equal(t, []string{"https://test.com/a", "https://other.com/b"}, args.seeds)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulUploadOfCsvUrlList(t *testing.T) {
+
+	csv := "name,URL\nhome,https://test.com/\n\nabout, https://test.com/about\n"
+	resp, args := cjt.addListCrawlJobAndWait(t, 134, "https://test.com/", func() (*http.Response, error) {
+		return http.Post(cjt.server.URL+"/crawlJobs/list", "text/csv", strings.NewReader(csv))
+	})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, args.opts.ListMode)
+	assert.Equal(t, []string{"https://test.com/", "https://test.com/about"}, args.seeds)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulUploadOfUrlListForm(t *testing.T) {
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("job", `{"baseUrl":"spreadsheet","skipNoFollow":true}`)
+	file, err := form.CreateFormFile("urls", "urls.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("https://test.com/\nhttps://test.com/about\n"))
+	form.Close()
+
+	resp, args := cjt.addListCrawlJobAndWait(t, 135, "spreadsheet", func() (*http.Response, error) {
+		return http.Post(cjt.server.URL+"/crawlJobs/list", form.FormDataContentType(), &body)
+	})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, args.opts.ListMode)
+	assert.True(t, args.opts.SkipNoFollow)
+	assert.Equal(t, []string{"https://test.com/", "https://test.com/about"}, args.seeds)
+}
+
+func (cjt *CrawlJobsTest) testUploadReturnsUnsupportedMediaType(t *testing.T) {
+
+	resp, err := http.Post(cjt.server.URL+"/crawlJobs/list", "application/json", strings.NewReader(`{}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnInvalidAuth(t *testing.T) {
+
+	reader := strings.NewReader(`{"baseUrl":"test","auth":{"type":"bearer"}}`)
+	resp, err := http.Post(
+		cjt.server.URL+"/crawlJobs",
+		"application/json",
+		reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnAuthWithoutCredentialsKey(t *testing.T) {
+
+	handler := NewCrawlJobHandler(cjt.mockCrawlJobRepo, cjt.mockLinkRepo, nil, nil, nil, nil, "")
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/crawlJobs",
+		strings.NewReader(`{"baseUrl":"test","auth":{"type":"bearer","token":"secret"}}`))
+	rec := httptest.NewRecorder()
+
+	handler.addCrawlJob(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulAddCrawlJobWithAuth(t *testing.T) {
+
+	var encrypted string
+	cjt.mockCrawlJobRepo.EXPECT().SaveCrawlJobAuth(130, gomock.Any()).
+		Do(func(_ int, encryptedAuth string) { encrypted = encryptedAuth }).
+		Return(nil).
+		Times(1)
+
+	resp, args := cjt.addCrawlJobAndWait(t, 130, `{"baseUrl":"test","auth":{"type":"basic","username":"user","password":"secret"}}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, crawler.AuthConfig{Type: crawler.BasicAuth, Username: "user", Password: "secret"}, args.opts.Auth)
+	assert.NotContains(t, encrypted, "secret")
+
+	decrypted, err := cjt.credentials.Decrypt(encrypted)
+	assert.Nil(t, err)
+
+	var auth crawler.AuthConfig
+	assert.Nil(t, json.Unmarshal(decrypted, &auth))
+	assert.Equal(t, args.opts.Auth, auth)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobMarksJobFailedIfAuthCantBeStored(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().SaveCrawlJobAuth(144, gomock.Any()).Return(errors.New("db error")).Times(1)
+
+	resp := cjt.addCrawlJobThatFailsToStart(t, 144, `{"baseUrl":"test","auth":{"type":"bearer","token":"secret"}}`)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testAddCrawlJobReturnsBadRequestOnBlockedAddress(t *testing.T) {
+
+	for _, body := range []string{
+		`{"baseUrl":"http://169.254.169.254/latest/meta-data/"}`,
+		`{"baseUrl":"http://127.0.0.1:5432/"}`,
+		`{"baseUrl":"https://example.com/","fetch":{"proxy":"http://10.0.0.1:3128"}}`,
+	} {
+		resp, err := http.Post(
+			cjt.server.URL+"/crawlJobs",
+			"application/json",
+			strings.NewReader(body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		assert.Contains(t, string(message), "is not allowed", body)
+	}
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobAnalysisReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/analysis")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJobAnalysis(t *testing.T) {
+
+	job := dal.CrawlJob{
+		BaseUrl:     "test",
+		LastUpdated: "10:11:14",
+		Status:      dal.Completed,
+		JobId:       123,
+	}
+	links := []dal.Link{
+		{Url: "test/", LinkId: 1, CrawlJobId: 123, ClickDepth: 0, PageRank: 0.3},
+		{Url: "test/a", LinkId: 2, CrawlJobId: 123, ClickDepth: 1, PageRank: 0.6, InboundLinks: 2},
+		{Url: "test/b", LinkId: 3, CrawlJobId: 123, ClickDepth: -1, PageRank: 0.1, Orphan: true},
+	}
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().GetLinks(123, dal.LinkFilter{Kind: "navigation"}).Return(links, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/analysis")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var summary analysis.Summary
+	if err = json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, summary.PageCount)
+	assert.Equal(t, 1, summary.MaxClickDepth)
+	assert.Equal(t, 1, summary.UnreachablePages)
+	assert.Equal(t, []string{"test/b"}, summary.OrphanPages)
+	assert.Equal(t, "test/a", summary.TopPages[0].Url)
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobSitemapReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/sitemap.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobSitemapReturnsConflictIfJobIsInProgress(t *testing.T) {
+
+	job := dal.CrawlJob{BaseUrl: "test", Status: dal.InProgress, JobId: 123}
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(2)
+
+	for _, path := range []string{"/crawlJobs/123/sitemap.xml", "/crawlJobs/123/sitemap-1.xml"} {
+		resp, err := http.Get(cjt.server.URL + path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, path)
+	}
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJobSitemap(t *testing.T) {
+
+	job := dal.CrawlJob{BaseUrl: "test", Status: dal.Completed, JobId: 123}
+	links := []dal.Link{
+		{Url: "https://test/", StatusCode: 200, ContentType: "text/html", LastModified: "2022-01-02T03:04:05Z"},
+		{Url: "https://test/a", StatusCode: 200, ContentType: "text/html", Canonical: "https://test/a"},
+		{Url: "https://test/copy", StatusCode: 200, ContentType: "text/html", Canonical: "https://test/a"},
+		{Url: "https://test/hidden", StatusCode: 200, ContentType: "text/html", NoIndex: true},
+		{Url: "https://test/missing", StatusCode: 404, ContentType: "text/html"},
+		{Url: "https://test/doc.pdf", StatusCode: 200, ContentType: "application/pdf"},
+	}
+	filter := dal.LinkFilter{Kind: "navigation", SortBy: dal.SortByUrl}
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().GetLinks(123, filter).Return(links, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/sitemap.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, sitemaps, err := crawler.ParseSitemap(bytes.NewReader(body))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://test/", "https://test/a"}, urls)
+	assert.Empty(t, sitemaps)
+	assert.Contains(t, string(body), "<lastmod>2022-01-02T03:04:05Z</lastmod>")
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobSitemapReturnsIndexForLargeCrawls(t *testing.T) {
+
+	job := dal.CrawlJob{BaseUrl: "test", Status: dal.Completed, JobId: 123}
+	links := make([]dal.Link, sitemap.MaxUrls+1)
+	for i := range links {
+		links[i] = dal.Link{Url: fmt.Sprintf("https://test/%d", i), StatusCode: 200, ContentType: "text/html"}
+	}
+	filter := dal.LinkFilter{Kind: "navigation", SortBy: dal.SortByUrl}
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(2)
+	cjt.mockLinkRepo.EXPECT().GetLinks(123, filter).Return(links, nil).Times(2)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/sitemap.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	urls, sitemaps, err := crawler.ParseSitemap(resp.Body)
+
+	assert.Nil(t, err)
+	assert.Empty(t, urls)
+	assert.Equal(t, []string{"sitemap-1.xml", "sitemap-2.xml"}, sitemaps)
+
+	// the parts are linked relative to the index
+	resp, err = http.Get(cjt.server.URL + "/crawlJobs/123/" + sitemaps[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, _, err = crawler.ParseSitemap(resp.Body)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("https://test/%d", sitemap.MaxUrls)}, urls)
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobDuplicatesReturnsBadRequestOnInvalidThreshold(t *testing.T) {
+
+	for _, threshold := range []string{"a", "0", "0.5", "1.5"} {
+		resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/duplicates?threshold=" + threshold)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobDuplicatesReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/duplicates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJobDuplicates(t *testing.T) {
+
+	job := dal.CrawlJob{
+		BaseUrl:     "test",
+		LastUpdated: "10:11:14",
+		Status:      dal.Completed,
+		JobId:       123,
+	}
+	links := []dal.Link{
+		{Url: "test/", LinkId: 1, CrawlJobId: 123, ContentHash: "h1", SimHash: "ff00ff00ff00ff00"},
+		{Url: "test/?print=1", LinkId: 2, CrawlJobId: 123, ContentHash: "h1", SimHash: "ff00ff00ff00ff00"},
+		{Url: "test/a", LinkId: 3, CrawlJobId: 123, ContentHash: "h2", SimHash: "ff00ff00ff00ff03"},
+		{Url: "test/b", LinkId: 4, CrawlJobId: 123, ContentHash: "h3", SimHash: "00ff00ff00ff00ff"},
+		{Url: "test/c", LinkId: 5, CrawlJobId: 123},
+	}
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(123).Return(job, nil).Times(1)
+	cjt.mockLinkRepo.EXPECT().GetLinks(123, dal.LinkFilter{Kind: "navigation"}).Return(links, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/123/duplicates?threshold=0.95")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var duplicates analysis.Duplicates
+	if err = json.NewDecoder(resp.Body).Decode(&duplicates); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []analysis.DuplicateGroup{{ContentHash: "h1", Urls: []string{"test/", "test/?print=1"}}}, duplicates.Exact)
+	assert.Equal(t, []analysis.NearDuplicateCluster{{Urls: []string{"test/", "test/?print=1", "test/a"}, Similarity: 1 - 2.0/64}}, duplicates.NearDuplicates)
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobWarcReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(141).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/141/warc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobWarcReturnsConflictIfJobIsInProgress(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(141).
+		Return(dal.CrawlJob{JobId: 141, BaseUrl: "test", Status: dal.InProgress}, nil).
+		Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/141/warc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJobWarc(t *testing.T) {
+
+	// two records that don't fit in a file together
+	w, err := warc.NewWriter(cjt.warcDir, warcPrefix(141), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range []string{"https://test/a", "https://test/b"} {
+		if _, err := w.Write(warc.Record{Type: warc.Resource, TargetURI: uri, Content: []byte(uri)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(141).
+		Return(dal.CrawlJob{JobId: 141, BaseUrl: "test", Status: dal.Completed}, nil).
+		Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/141/warc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/warc", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="crawl-141.warc.gz"`, resp.Header.Get("Content-Disposition"))
+
+	// the files concatenate to a single gzip stream of all their records
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, strings.Count(string(content), "WARC-Type: warcinfo"))
+	assert.Contains(t, string(content), "WARC-Target-URI: https://test/a")
+	assert.Contains(t, string(content), "WARC-Target-URI: https://test/b")
+}
+
+func (cjt *CrawlJobsTest) testGetCrawlJobHarReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(142).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/142/har")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulGetCrawlJobHar(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(142).
+		Return(dal.CrawlJob{JobId: 142, BaseUrl: "https://test.com/", Status: dal.Completed}, nil).
+		Times(1)
+	cjt.mockLinkRepo.EXPECT().GetLinks(142, dal.LinkFilter{}).
+		Return([]dal.Link{
+			{
+				Url:         "https://test.com/search?page=2&q=a",
+				FetchUrl:    "https://test.com/search?q=a&page=2&ref=nav",
+				StatusCode:  200,
+				ContentType: "text/html",
+				NotModified: true,
+				// a reused connection
+				Timings: &dal.Timings{
+					StartedAt:       "2022-01-02T03:04:05.250Z",
+					Send:            0.5,
+					TimeToFirstByte: 40,
+					Download:        10,
+				},
+			},
+			// never fetched
+			{Url: "https://test.com/logo.png", Kind: "image"},
+			{
+				Url:         "https://test.com/",
+				StatusCode:  200,
+				ContentType: "text/html",
+				Timings: &dal.Timings{
+					StartedAt:       "2022-01-02T03:04:05.000Z",
+					DNS:             5,
+					Connect:         10,
+					TLS:             20,
+					Send:            1,
+					TimeToFirstByte: 100,
+					Download:        50,
+				},
+			},
+		}, nil).
+		Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/142/har")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `attachment; filename="crawl-142.har"`, resp.Header.Get("Content-Disposition"))
+
+	var har Har
+	if err := json.NewDecoder(resp.Body).Decode(&har); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "1.2", har.Log.Version)
+	if !assert.Len(t, har.Log.Entries, 2) {
+		return
+	}
+
+	// entries are ordered by the time they started at
+	home := har.Log.Entries[0]
+	assert.Equal(t, "2022-01-02T03:04:05.000Z", home.StartedDateTime)
+	assert.Equal(t, "https://test.com/", home.Request.Url)
+	assert.Equal(t, "GET", home.Request.Method)
+	assert.Equal(t, 200, home.Response.Status)
+	assert.Equal(t, "OK", home.Response.StatusText)
+	assert.Equal(t, "text/html", home.Response.Content.MimeType)
+	assert.Equal(t, HarTimings{Blocked: -1, DNS: 5, Connect: 30, Send: 1, Wait: 100, Receive: 50, SSL: 20}, home.Timings)
+	assert.Equal(t, float64(186), home.Time)
+
+	// the fetch of a page that wasn't modified is reported as it was answered
+	search := har.Log.Entries[1]
+	assert.Equal(t, http.StatusNotModified, search.Response.Status)
+	assert.Equal(t, "Not Modified", search.Response.StatusText)
+	// the request is the one sent, before canonicalization rewrote its url
+	assert.Equal(t, "https://test.com/search?q=a&page=2&ref=nav", search.Request.Url)
+	assert.Equal(t, []HarNameValue{{Name: "page", Value: "2"}, {Name: "q", Value: "a"}, {Name: "ref", Value: "nav"}}, search.Request.QueryString)
+	assert.Equal(t, HarTimings{Blocked: -1, DNS: -1, Connect: -1, Send: 0.5, Wait: 40, Receive: 10, SSL: -1}, search.Timings)
+	assert.Equal(t, 50.5, search.Time)
+}
+
+func (cjt *CrawlJobsTest) testExportReturnsBadRequestOnInvalidFormat(t *testing.T) {
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/143/export?format=xlsx")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testExportReturnsBadRequestOnInvalidColumn(t *testing.T) {
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/143/export?columns=url,header")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testExportReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(143).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/143/export")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testExportReturnsInternalServerErrorOnDbError(t *testing.T) {
+
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(143).
+		Return(dal.CrawlJob{JobId: 143, BaseUrl: "test", Status: dal.Completed}, nil).
+		Times(1)
+	cjt.mockLinkRepo.EXPECT().StreamLinks(gomock.Any(), 143, dal.LinkFilter{}, gomock.Any()).
+		Return(errors.New("db error")).
+		Times(1)
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/143/export")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func (cjt *CrawlJobsTest) testExportStopsWhenClientGoesAway(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopped := make(chan bool, 1)
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(143).
+		Return(dal.CrawlJob{JobId: 143, BaseUrl: "test", Status: dal.Completed}, nil).
+		Times(1)
+	cjt.mockLinkRepo.EXPECT().StreamLinks(gomock.Any(), 143, dal.LinkFilter{}, gomock.Any()).
+		DoAndReturn(func(streamCtx context.Context, _ int, _ dal.LinkFilter, _ func(dal.Link) error) error {
+			cancel()
+			select {
+			case <-streamCtx.Done():
+				stopped <- true
+				return streamCtx.Err()
+			case <-time.After(5 * time.Second):
+				stopped <- false
+				return nil
+			}
+		}).
+		Times(1)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cjt.server.URL+"/crawlJobs/143/export", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = http.DefaultClient.Do(req)
+
+	assert.NotNil(t, err)
+	assert.True(t, <-stopped)
+}
+
+// expectExportedLinks expects the links of job 143 to be streamed with the
+// filter.
+func (cjt *CrawlJobsTest) expectExportedLinks(filter dal.LinkFilter, links []dal.Link) {
+	cjt.mockCrawlJobRepo.EXPECT().GetCrawlJob(143).
+		Return(dal.CrawlJob{JobId: 143, BaseUrl: "test", Status: dal.Completed}, nil).
+		Times(1)
+	cjt.mockLinkRepo.EXPECT().StreamLinks(gomock.Any(), 143, filter, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int, _ dal.LinkFilter, onLink func(dal.Link) error) error {
+			for _, link := range links {
+				if err := onLink(link); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Times(1)
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulCsvExport(t *testing.T) {
+
+	cjt.expectExportedLinks(
+		dal.LinkFilter{Kind: "navigation", SortBy: dal.SortByUrl},
+		[]dal.Link{
+			{Url: "https://test.com/", StatusCode: 200, NoIndex: false, PageRank: 0.25},
+			{Url: "https://test.com/a,b", StatusCode: 404, NoIndex: true},
+		})
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/143/export?format=csv&kind=navigation&sort=url&columns=url,statusCode,noIndex,pageRank")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="crawl-143-links.csv"`, resp.Header.Get("Content-Disposition"))
+	assert.Equal(t, "url,statusCode,noIndex,pageRank\n"+
+		"https://test.com/,200,false,0.25\n"+
+		"\"https://test.com/a,b\",404,true,0\n", string(body))
+}
+
+func (cjt *CrawlJobsTest) testSuccessfulJsonlExport(t *testing.T) {
+
+	cjt.expectExportedLinks(
+		dal.LinkFilter{Scope: dal.ScopeExternal},
+		[]dal.Link{
+			{Url: "https://other.com/", External: true},
+			{Url: "https://other.com/\"quoted\"", External: true},
+		})
+
+	resp, err := http.Get(cjt.server.URL + "/crawlJobs/143/export?format=jsonl&scope=external&columns=url,external")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `{"url":"https://other.com/","external":true}`+"\n"+
+		`{"url":"https://other.com/\"quoted\"","external":true}`+"\n", string(body))
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alicansa/go-linkcrawler/analysis"
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/gorilla/mux"
+)
+
+// getCrawlJobDuplicates groups the pages of a crawl job with the same content
+// and clusters the ones with similar visible text, as similar as the
+// "threshold" query parameter or the default threshold.
+func (h *CrawlJobsHandler) getCrawlJobDuplicates(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	threshold := analysis.DefaultSimilarityThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		threshold, err = strconv.ParseFloat(value, 64)
+		if err != nil || threshold < analysis.MinSimilarityThreshold || threshold > 1 {
+			http.Error(rw, fmt.Sprintf("threshold must be a number from %v to 1", analysis.MinSimilarityThreshold), http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	links, err := h.linkRepository.GetLinks(jobId, dal.LinkFilter{Kind: string(crawler.NavigationLink)})
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pages := make([]analysis.PageFingerprint, 0, len(links))
+	for _, link := range links {
+		pages = append(pages, analysis.PageFingerprint{
+			Url:         link.Url,
+			ContentHash: link.ContentHash,
+			SimHash:     parseSimHash(link.SimHash),
+		})
+	}
+
+	rw.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(rw).Encode(analysis.FindDuplicates(pages, threshold)); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// formatSimHash returns the SimHash as stored, hex encoded, or an empty
+// string if the page has none.
+func formatSimHash(simHash uint64) string {
+	if simHash == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", simHash)
+}
+
+func parseSimHash(simHash string) uint64 {
+	value, _ := strconv.ParseUint(simHash, 16, 64)
+	return value
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/gorilla/mux"
+)
+
+// exportFlushSize is the number of rows written between flushes of an
+// export, so that clients receive it as it's read.
+const exportFlushSize = 1000
+
+// exportColumn is a column of link exports, named as the field of links is
+// in json.
+type exportColumn struct {
+	name  string
+	value func(link dal.Link) interface{}
+}
+
+// exportColumns are the columns of link exports, in the order they are
+// exported by default.
+var exportColumns = []exportColumn{
+	{"linkId", func(l dal.Link) interface{} { return l.LinkId }},
+	{"url", func(l dal.Link) interface{} { return l.Url }},
+	{"kind", func(l dal.Link) interface{} { return l.Kind }},
+	{"statusCode", func(l dal.Link) interface{} { return l.StatusCode }},
+	{"contentType", func(l dal.Link) interface{} { return l.ContentType }},
+	{"canonical", func(l dal.Link) interface{} { return l.Canonical }},
+	{"noIndex", func(l dal.Link) interface{} { return l.NoIndex }},
+	{"noFollow", func(l dal.Link) interface{} { return l.NoFollow }},
+	{"clickDepth", func(l dal.Link) interface{} { return l.ClickDepth }},
+	{"pageRank", func(l dal.Link) interface{} { return l.PageRank }},
+	{"inboundLinks", func(l dal.Link) interface{} { return l.InboundLinks }},
+	{"orphan", func(l dal.Link) interface{} { return l.Orphan }},
+	{"inSitemap", func(l dal.Link) interface{} { return l.InSitemap }},
+	{"linked", func(l dal.Link) interface{} { return l.Linked }},
+	{"external", func(l dal.Link) interface{} { return l.External }},
+	{"lastModified", func(l dal.Link) interface{} { return l.LastModified }},
+	{"etag", func(l dal.Link) interface{} { return l.ETag }},
+	{"notModified", func(l dal.Link) interface{} { return l.NotModified }},
+	{"contentHash", func(l dal.Link) interface{} { return l.ContentHash }},
+	{"simHash", func(l dal.Link) interface{} { return l.SimHash }},
+	{"parsed", func(l dal.Link) interface{} { return l.Parsed }},
+	{"charset", func(l dal.Link) interface{} { return l.Charset }},
+	{"sizeLimit", func(l dal.Link) interface{} { return l.SizeLimit }},
+	{"fetchError", func(l dal.Link) interface{} { return l.FetchError }},
+	{"parseError", func(l dal.Link) interface{} { return l.ParseError }},
+	{"seed", func(l dal.Link) interface{} { return l.Seed }},
+	{"originalUrl", func(l dal.Link) interface{} { return l.OriginalUrl }},
+	{"snapshotKey", func(l dal.Link) interface{} { return l.SnapshotKey }},
+}
+
+// exportColumnsFromQuery returns the columns named by the comma separated
+// "columns" query parameter, or all of them if it isn't set.
+func exportColumnsFromQuery(value string) ([]exportColumn, error) {
+	if value == "" {
+		return exportColumns, nil
+	}
+
+	byName := make(map[string]exportColumn, len(exportColumns))
+	for _, column := range exportColumns {
+		byName[column.name] = column
+	}
+
+	var columns []exportColumn
+	for _, name := range strings.Split(value, ",") {
+		column, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid column %q", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// linkExporter writes the links of an export in a format.
+type linkExporter interface {
+	writeHeader() error
+	writeLink(link dal.Link) error
+	flush() error
+}
+
+type csvExporter struct {
+	w       *csv.Writer
+	columns []exportColumn
+}
+
+func (e *csvExporter) writeHeader() error {
+	names := make([]string, 0, len(e.columns))
+	for _, column := range e.columns {
+		names = append(names, column.name)
+	}
+	return e.w.Write(names)
+}
+
+func (e *csvExporter) writeLink(link dal.Link) error {
+	record := make([]string, 0, len(e.columns))
+	for _, column := range e.columns {
+		record = append(record, fmt.Sprint(column.value(link)))
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExporter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonlExporter writes a json object per line, with its fields in the
+// order of the columns.
+type jsonlExporter struct {
+	w       http.ResponseWriter
+	columns []exportColumn
+}
+
+func (e *jsonlExporter) writeHeader() error {
+	return nil
+}
+
+func (e *jsonlExporter) writeLink(link dal.Link) error {
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, column := range e.columns {
+		value, err := json.Marshal(column.value(link))
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		line.WriteString(strconv.Quote(column.name))
+		line.WriteByte(':')
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+
+	_, err := e.w.Write(line.Bytes())
+	return err
+}
+
+func (e *jsonlExporter) flush() error {
+	return nil
+}
+
+// exportCrawlJobLinks streams the links of a crawl job as csv or json lines,
+// as the "format" query parameter selects, with the columns of the "columns"
+// query parameter. The links are filtered and sorted as the links endpoint
+// does.
+func (h *CrawlJobsHandler) exportCrawlJobLinks(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := linkFilterFromQuery(query)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	columns, err := exportColumnsFromQuery(query.Get("columns"))
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var exporter linkExporter
+	var contentType string
+	format := query.Get("format")
+	switch format {
+	case "", "csv":
+		format = "csv"
+		exporter = &csvExporter{w: csv.NewWriter(rw), columns: columns}
+		contentType = "text/csv; charset=utf-8"
+	case "jsonl":
+		exporter = &jsonlExporter{w: rw, columns: columns}
+		contentType = "application/x-ndjson"
+	default:
+		http.Error(rw, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	// the response is only started once the first link is read, so that
+	// failing to query the links is still reported as an error
+	started := false
+	start := func() error {
+		started = true
+		rw.Header().Set("Content-type", contentType)
+		rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="crawl-%d-links.%s"`, jobId, format))
+		return exporter.writeHeader()
+	}
+
+	// the links stop being read once the client goes away
+	rows := 0
+	err = h.linkRepository.StreamLinks(r.Context(), jobId, filter, func(link dal.Link) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := exporter.writeLink(link); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushSize == 0 {
+			return flushExport(rw, exporter)
+		}
+		return nil
+	})
+
+	if err != nil && !started {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err != nil {
+		// the response has started, so it can only be cut short
+		log.Println(err.Error())
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			log.Println(err.Error())
+			return
+		}
+	}
+
+	if err := exporter.flush(); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// flushExport sends the rows written so far to the client.
+func flushExport(rw http.ResponseWriter, exporter linkExporter) error {
+	if err := exporter.flush(); err != nil {
+		return err
+	}
+
+	if f, ok := rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
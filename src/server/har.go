@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/gorilla/mux"
+)
+
+// harTimeFormat is the ISO 8601 format of the times of HAR files.
+const harTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Har is a HAR 1.2 file, as browser dev tools import them.
+type Har struct {
+	Log HarLog `json:"log"`
+}
+
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarEntry struct {
+	StartedDateTime string `json:"startedDateTime"`
+	// Time is the total time of the request in milliseconds, the sum of its
+	// timings.
+	Time     float64     `json:"time"`
+	Request  HarRequest  `json:"request"`
+	Response HarResponse `json:"response"`
+	Cache    struct{}    `json:"cache"`
+	Timings  HarTimings  `json:"timings"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HarRequest is a request of a HAR file. The crawler doesn't keep the
+// headers of its requests, which may hold credentials.
+type HarRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectUrl string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// HarTimings are the timings of a request in milliseconds, -1 for the
+// phases that don't apply to it. Connect includes the ssl handshake.
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// getCrawlJobHar exports the fetches of the pages of a crawl job as a HAR
+// file, in the order they were started.
+func (h *CrawlJobsHandler) getCrawlJobHar(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	links, err := h.linkRepository.GetLinks(jobId, dal.LinkFilter{})
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	har := Har{Log: HarLog{
+		Version: "1.2",
+		Creator: HarCreator{Name: "go-linkcrawler"},
+		Entries: harEntries(links),
+	}}
+
+	rw.Header().Set("Content-type", "application/json")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="crawl-%d.har"`, jobId))
+	if err := json.NewEncoder(rw).Encode(har); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// harEntries returns the entries of the links that were fetched, ordered by
+// the time they were started at.
+func harEntries(links []dal.Link) []HarEntry {
+	entries := []HarEntry{}
+	for _, link := range links {
+		if link.Timings == nil {
+			continue
+		}
+
+		// pages that weren't modified keep the status of their previous
+		// crawl, while their fetch was answered as not modified
+		status := link.StatusCode
+		if link.NotModified {
+			status = http.StatusNotModified
+		}
+
+		// the request was sent to the url the page was fetched at, before
+		// canonicalization rewrote it
+		requestUrl := link.Url
+		if link.FetchUrl != "" {
+			requestUrl = link.FetchUrl
+		}
+
+		timings := harTimings(*link.Timings)
+		entries = append(entries, HarEntry{
+			StartedDateTime: link.Timings.StartedAt,
+			Time:            harTotal(timings),
+			Request: HarRequest{
+				Method:      http.MethodGet,
+				Url:         requestUrl,
+				Cookies:     []HarNameValue{},
+				Headers:     []HarNameValue{},
+				QueryString: harQueryString(requestUrl),
+				HeadersSize: -1,
+				BodySize:    0,
+			},
+			Response: HarResponse{
+				Status:      status,
+				StatusText:  http.StatusText(status),
+				Cookies:     []HarNameValue{},
+				Headers:     []HarNameValue{},
+				Content:     HarContent{Size: -1, MimeType: link.ContentType},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			Timings: timings,
+		})
+	}
+
+	// the times are all in utc, in the same format
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime < entries[j].StartedDateTime
+	})
+	return entries
+}
+
+func harTimings(timings dal.Timings) HarTimings {
+	orSkipped := func(ms float64) float64 {
+		if ms == 0 {
+			return -1
+		}
+		return ms
+	}
+
+	return HarTimings{
+		Blocked: -1,
+		DNS:     orSkipped(timings.DNS),
+		Connect: orSkipped(timings.Connect + timings.TLS),
+		Send:    timings.Send,
+		Wait:    timings.TimeToFirstByte,
+		Receive: timings.Download,
+		SSL:     orSkipped(timings.TLS),
+	}
+}
+
+// harTotal returns the total time of the timings, in which the ssl handshake
+// is part of the connection.
+func harTotal(timings HarTimings) float64 {
+	var total float64
+	for _, ms := range []float64{timings.Blocked, timings.DNS, timings.Connect, timings.Send, timings.Wait, timings.Receive} {
+		if ms > 0 {
+			total += ms
+		}
+	}
+	return total
+}
+
+func harQueryString(rawUrl string) []HarNameValue {
+	query := []HarNameValue{}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return query
+	}
+
+	values := u.Query()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range values[name] {
+			query = append(query, HarNameValue{Name: name, Value: value})
+		}
+	}
+	return query
+}
+
+// linkTimings returns the timings of a fetch as stored with its link.
+func linkTimings(timings *crawler.Timings) *dal.Timings {
+	if timings == nil {
+		return nil
+	}
+
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	return &dal.Timings{
+		StartedAt:       timings.StartedAt.UTC().Format(harTimeFormat),
+		DNS:             ms(timings.DNS),
+		Connect:         ms(timings.Connect),
+		TLS:             ms(timings.TLS),
+		Send:            ms(timings.Send),
+		TimeToFirstByte: ms(timings.TimeToFirstByte),
+		Download:        ms(timings.Download),
+	}
+}
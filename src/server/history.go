@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+)
+
+// jobHistory is the page history of a completed crawl job, used to recrawl
+// its site.
+type jobHistory struct {
+	linkRepository dal.LinkRepository
+	jobId          int
+	// snapshots names the snapshot store of the recrawl, whose previous
+	// snapshots are kept for the pages that weren't modified
+	snapshots string
+}
+
+func (h *jobHistory) PreviousPage(url string) (crawler.CrawledPage, bool, error) {
+	links, err := h.linkRepository.GetLinks(h.jobId, dal.LinkFilter{Url: url})
+
+	if err != nil || len(links) == 0 || links[0].StatusCode == 0 {
+		return crawler.CrawledPage{}, false, err
+	}
+
+	link := links[0]
+	page := crawler.CrawledPage{
+		Url:         link.Url,
+		StatusCode:  link.StatusCode,
+		Canonical:   link.Canonical,
+		NoIndex:     link.NoIndex,
+		NoFollow:    link.NoFollow,
+		ContentType: link.ContentType,
+		ETag:        link.ETag,
+		ContentHash: link.ContentHash,
+		SimHash:     parseSimHash(link.SimHash),
+		Charset:     link.Charset,
+		Parsed:      link.Parsed,
+		SizeLimit:   crawler.SizeLimit(link.SizeLimit),
+	}
+	page.LastModified, _ = time.Parse(time.RFC3339, link.LastModified)
+
+	// only ok pages are requested conditionally
+	if link.StatusCode != http.StatusOK {
+		return page, true, nil
+	}
+
+	if h.snapshots != "" && link.SnapshotKey != "" {
+		snapshot, err := h.linkRepository.GetSnapshot(link.LinkId)
+
+		if err != nil {
+			return crawler.CrawledPage{}, false, err
+		}
+
+		// keys are only meaningful in the store they were put in
+		if snapshot.Store == h.snapshots {
+			page.SnapshotKey = snapshot.Key
+			page.Header = snapshot.Header
+		}
+	}
+
+	outlinks, err := h.linkRepository.GetOutlinks(h.jobId, url)
+
+	if err != nil {
+		return crawler.CrawledPage{}, false, err
+	}
+
+	for _, outlink := range outlinks {
+		l := crawler.Link{
+			Url:      outlink.Url,
+			Kind:     crawler.LinkKind(outlink.Kind),
+			Rel:      outlink.Rel,
+			External: outlink.External,
+		}
+
+		if outlink.External {
+			page.ExternalLinks = append(page.ExternalLinks, l)
+			continue
+		}
+		page.Links = append(page.Links, l)
+	}
+
+	return page, true, nil
+}
+
+// pageOutlinks returns the links found on the page as they were found, so
+// that a recrawl rewrites them as its own rules do.
+func pageOutlinks(page crawler.CrawledPage) []dal.Outlink {
+	var outlinks []dal.Outlink
+	for _, links := range [][]crawler.Link{page.Links, page.ExternalLinks} {
+		for _, link := range links {
+			u := link.Url
+			if link.OriginalUrl != "" {
+				u = link.OriginalUrl
+			}
+
+			outlinks = append(outlinks, dal.Outlink{
+				Url:      u,
+				Kind:     string(link.Kind),
+				Rel:      link.Rel,
+				External: link.External,
+			})
+		}
+	}
+	return outlinks
+}
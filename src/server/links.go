@@ -2,25 +2,33 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/crawler"
 	"github.com/alicansa/go-linkcrawler/dal"
 	"github.com/gorilla/mux"
 )
 
 type LinksHandler struct {
 	linkRepository dal.LinkRepository
+	// snapshots are the stores the bodies of the pages are kept in, by name
+	snapshots map[string]blobstore.BlobStore
 }
 
-func NewLinksHandler(lr dal.LinkRepository) *LinksHandler {
+func NewLinksHandler(lr dal.LinkRepository, snapshots map[string]blobstore.BlobStore) *LinksHandler {
 	return &LinksHandler{
 		linkRepository: lr,
+		snapshots:      snapshots,
 	}
 }
 
 func (h *LinksHandler) registerLinksHandler(r *mux.Router) {
 	r.HandleFunc("/links", h.getLinks)
+	r.HandleFunc("/links/{id:[0-9]+}/content", h.getLinkContent).Methods("GET")
 }
 
 func (h *LinksHandler) getLinks(rw http.ResponseWriter, req *http.Request) {
@@ -35,7 +43,14 @@ func (h *LinksHandler) getLinks(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	links, err := h.linkRepository.GetLinks(crawlJobId)
+	filter, err := linkFilterFromQuery(req.URL.Query())
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	links, err := h.linkRepository.GetLinks(crawlJobId, filter)
 
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
@@ -47,3 +62,52 @@ func (h *LinksHandler) getLinks(rw http.ResponseWriter, req *http.Request) {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 	}
 }
+
+// linkFilterFromQuery reads the kind, foundVia, scope, sort and order query
+// parameters of a links request.
+func linkFilterFromQuery(query url.Values) (dal.LinkFilter, error) {
+	var filter dal.LinkFilter
+
+	switch kind := crawler.LinkKind(query.Get("kind")); kind {
+	case "":
+	case crawler.NavigationLink, crawler.ImageLink, crawler.ScriptLink,
+		crawler.StylesheetLink, crawler.MediaLink, crawler.FormLink:
+		filter.Kind = string(kind)
+	default:
+		return filter, fmt.Errorf("invalid link kind %q", kind)
+	}
+
+	switch foundVia := dal.LinkFoundVia(query.Get("foundVia")); foundVia {
+	case "":
+	case dal.FoundViaSitemapOnly, dal.FoundViaLinksOnly, dal.FoundViaBoth:
+		filter.FoundVia = foundVia
+	default:
+		return filter, fmt.Errorf("invalid found via filter %q", foundVia)
+	}
+
+	switch scope := dal.LinkScope(query.Get("scope")); scope {
+	case "":
+	case dal.ScopeInternal, dal.ScopeExternal:
+		filter.Scope = scope
+	default:
+		return filter, fmt.Errorf("invalid scope filter %q", scope)
+	}
+
+	switch sortBy := dal.LinkSortField(query.Get("sort")); sortBy {
+	case "":
+	case dal.SortByUrl, dal.SortByClickDepth, dal.SortByPageRank, dal.SortByInboundLinks:
+		filter.SortBy = sortBy
+	default:
+		return filter, fmt.Errorf("invalid sort field %q", sortBy)
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("invalid sort order %q", order)
+	}
+
+	return filter, nil
+}
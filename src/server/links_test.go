@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 
+	"github.com/alicansa/go-linkcrawler/blobstore"
 	"github.com/alicansa/go-linkcrawler/dal"
 	"github.com/alicansa/go-linkcrawler/mocks"
 	"github.com/golang/mock/gomock"
@@ -19,6 +20,7 @@ type LinksTest struct {
 	linksRepo  *mocks.MockLinkRepository
 	server     *httptest.Server
 	controller *gomock.Controller
+	snapshots  blobstore.BlobStore
 }
 
 func TestLinks(t *testing.T) {
@@ -30,14 +32,32 @@ func TestLinks(t *testing.T) {
 	t.Run("Test returns bad request on invalid job id", lt.testInvalidJobId)
 	t.Run("Test returns internal server error on db error", lt.testLinkRepositoryError)
 	t.Run("Test successfully returns links", lt.testSuccessfulGetLinks)
+	t.Run("Test returns bad request on invalid sort field", lt.testInvalidSortField)
+	t.Run("Test successfully returns sorted links", lt.testSuccessfulGetSortedLinks)
+	t.Run("Test returns bad request on invalid link kind", lt.testInvalidLinkKind)
+	t.Run("Test successfully returns links of kind", lt.testSuccessfulGetLinksOfKind)
+	t.Run("Test returns bad request on invalid found via filter", lt.testInvalidFoundVia)
+	t.Run("Test successfully returns links in sitemap but not linked", lt.testSuccessfulGetSitemapOnlyLinks)
+	t.Run("Test returns bad request on invalid scope filter", lt.testInvalidScope)
+	t.Run("Test successfully returns external links", lt.testSuccessfulGetExternalLinks)
+	t.Run("Test get link content returns not found if link doesn't exist", lt.testGetLinkContentReturnsNotFoundIfLinkDoesntExist)
+	t.Run("Test get link content returns not found if page wasn't snapshotted", lt.testGetLinkContentReturnsNotFoundIfNotSnapshotted)
+	t.Run("Test get link content returns not found if body isn't stored", lt.testGetLinkContentReturnsNotFoundIfBodyIsntStored)
+	t.Run("Test successfully returns link content", lt.testSuccessfulGetLinkContent)
 }
 
 func (lt *LinksTest) setupSuite(t *testing.T) func(t *testing.T) {
 	lt.controller = gomock.NewController(t)
 	mockLinkRepo := mocks.NewMockLinkRepository(lt.controller)
 	lt.linksRepo = mockLinkRepo
+	snapshots, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt.snapshots = snapshots
+
 	r := mux.NewRouter()
-	linksHandler := NewLinksHandler(mockLinkRepo)
+	linksHandler := NewLinksHandler(mockLinkRepo, map[string]blobstore.BlobStore{"local": snapshots})
 	linksHandler.registerLinksHandler(r)
 	lt.server = httptest.NewServer(r)
 
@@ -58,7 +78,7 @@ func (lt *LinksTest) testInvalidJobId(t *testing.T) {
 
 func (lt *LinksTest) testLinkRepositoryError(t *testing.T) {
 
-	lt.linksRepo.EXPECT().GetLinks(123).Return(nil, errors.New("db error")).Times(1)
+	lt.linksRepo.EXPECT().GetLinks(123, dal.LinkFilter{}).Return(nil, errors.New("db error")).Times(1)
 
 	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123")
 	if err != nil {
@@ -71,9 +91,9 @@ func (lt *LinksTest) testLinkRepositoryError(t *testing.T) {
 func (lt *LinksTest) testSuccessfulGetLinks(t *testing.T) {
 
 	expectedLinks := []dal.Link{
-		{Url: "test.com/test", LinkId: 12345, CrawlJobId: 123},
+		{Url: "test.com/test", LinkId: 12345, CrawlJobId: 123, Kind: "navigation"},
 	}
-	lt.linksRepo.EXPECT().GetLinks(123).Return(expectedLinks, nil).Times(1)
+	lt.linksRepo.EXPECT().GetLinks(123, dal.LinkFilter{}).Return(expectedLinks, nil).Times(1)
 
 	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123")
 	if err != nil {
@@ -94,3 +114,223 @@ func (lt *LinksTest) testSuccessfulGetLinks(t *testing.T) {
 	assert.Len(t, decodedLinks, 1)
 	assert.Equal(t, expectedLinks, decodedLinks)
 }
+
+func (lt *LinksTest) testInvalidSortField(t *testing.T) {
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&sort=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func (lt *LinksTest) testSuccessfulGetSortedLinks(t *testing.T) {
+
+	expectedLinks := []dal.Link{
+		{Url: "test.com/a", LinkId: 12345, CrawlJobId: 123, PageRank: 0.7},
+		{Url: "test.com/b", LinkId: 12346, CrawlJobId: 123, PageRank: 0.3},
+	}
+	filter := dal.LinkFilter{
+		SortBy:     dal.SortByPageRank,
+		Descending: true,
+	}
+	lt.linksRepo.EXPECT().GetLinks(123, filter).Return(expectedLinks, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&sort=pageRank&order=desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var decodedLinks []dal.Link
+	if err := json.NewDecoder(res.Body).Decode(&decodedLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expectedLinks, decodedLinks)
+}
+
+func (lt *LinksTest) testInvalidLinkKind(t *testing.T) {
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&kind=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func (lt *LinksTest) testSuccessfulGetLinksOfKind(t *testing.T) {
+
+	expectedLinks := []dal.Link{
+		{Url: "test.com/logo.png", LinkId: 12345, CrawlJobId: 123, Kind: "image"},
+	}
+	lt.linksRepo.EXPECT().GetLinks(123, dal.LinkFilter{Kind: "image"}).Return(expectedLinks, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&kind=image")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var decodedLinks []dal.Link
+	if err := json.NewDecoder(res.Body).Decode(&decodedLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expectedLinks, decodedLinks)
+}
+
+func (lt *LinksTest) testInvalidFoundVia(t *testing.T) {
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&foundVia=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func (lt *LinksTest) testSuccessfulGetSitemapOnlyLinks(t *testing.T) {
+
+	expectedLinks := []dal.Link{
+		{Url: "test.com/unlinked", LinkId: 12345, CrawlJobId: 123, Kind: "navigation", InSitemap: true},
+	}
+	filter := dal.LinkFilter{FoundVia: dal.FoundViaSitemapOnly}
+	lt.linksRepo.EXPECT().GetLinks(123, filter).Return(expectedLinks, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&foundVia=sitemapOnly")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var decodedLinks []dal.Link
+	if err := json.NewDecoder(res.Body).Decode(&decodedLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expectedLinks, decodedLinks)
+}
+
+func (lt *LinksTest) testInvalidScope(t *testing.T) {
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&scope=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func (lt *LinksTest) testSuccessfulGetExternalLinks(t *testing.T) {
+
+	expectedLinks := []dal.Link{
+		{Url: "https://other.com/", LinkId: 12346, CrawlJobId: 123, Kind: "navigation", Linked: true, External: true},
+	}
+	filter := dal.LinkFilter{Scope: dal.ScopeExternal}
+	lt.linksRepo.EXPECT().GetLinks(123, filter).Return(expectedLinks, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links?crawlJobId=123&scope=external")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var decodedLinks []dal.Link
+	if err := json.NewDecoder(res.Body).Decode(&decodedLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expectedLinks, decodedLinks)
+}
+
+func (lt *LinksTest) testGetLinkContentReturnsNotFoundIfLinkDoesntExist(t *testing.T) {
+
+	lt.linksRepo.EXPECT().GetSnapshot(12345).Return(dal.Snapshot{}, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links/12345/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func (lt *LinksTest) testGetLinkContentReturnsNotFoundIfNotSnapshotted(t *testing.T) {
+
+	lt.linksRepo.EXPECT().GetSnapshot(12345).Return(dal.Snapshot{LinkId: 12345, CrawlJobId: 123, Url: "test.com/test"}, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links/12345/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func (lt *LinksTest) testGetLinkContentReturnsNotFoundIfBodyIsntStored(t *testing.T) {
+
+	snapshot := dal.Snapshot{
+		LinkId:     12345,
+		CrawlJobId: 123,
+		Url:        "test.com/test",
+		StatusCode: http.StatusOK,
+		Store:      "local",
+		Key:        blobstore.Key([]byte("missing")),
+		Header:     map[string][]string{"Content-Type": {"text/html"}},
+	}
+	lt.linksRepo.EXPECT().GetSnapshot(12345).Return(snapshot, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links/12345/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func (lt *LinksTest) testSuccessfulGetLinkContent(t *testing.T) {
+
+	body := []byte("<html><body>test</body></html>")
+	key, err := lt.snapshots.Put(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := dal.Snapshot{
+		LinkId:     12345,
+		CrawlJobId: 123,
+		Url:        "test.com/test",
+		StatusCode: http.StatusOK,
+		Store:      "local",
+		Key:        key,
+		Header:     map[string][]string{"Content-Type": {"text/html"}, "Set-Cookie": {"session=1"}},
+	}
+	lt.linksRepo.EXPECT().GetSnapshot(12345).Return(snapshot, nil).Times(1)
+
+	res, err := http.Get(lt.server.URL + "/links/12345/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-type"))
+
+	var content LinkContent
+	if err := json.NewDecoder(res.Body).Decode(&content); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, LinkContent{
+		Url:        "test.com/test",
+		StatusCode: http.StatusOK,
+		Header:     map[string][]string{"Content-Type": {"text/html"}},
+		Body:       body,
+	}, content)
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/alicansa/go-linkcrawler/replay"
+	"github.com/gorilla/mux"
+)
+
+// replayedHeaders are the headers of stored responses that are replayed as
+// they were received. Others, such as Content-Encoding, no longer apply to
+// the stored body.
+var replayedHeaders = []string{"Content-Type", "Content-Language", "Last-Modified"}
+
+// replayPolicy is the content security policy of replayed responses. They
+// are served from the origin of the api, so they are sandboxed in an origin of
+// their own, without running their scripts.
+const replayPolicy = "sandbox"
+
+// ReplayHandler serves the stored responses of crawl jobs that snapshot their
+// pages as they were crawled, with their links rewritten to their stored
+// responses so that browsing stays within the crawl.
+type ReplayHandler struct {
+	linkRepository     dal.LinkRepository
+	crawlJobRepository dal.CrawlJobRepository
+	// snapshots are the stores the bodies of the pages are kept in, by name
+	snapshots map[string]blobstore.BlobStore
+}
+
+func NewReplayHandler(
+	lr dal.LinkRepository,
+	cjr dal.CrawlJobRepository,
+	snapshots map[string]blobstore.BlobStore) *ReplayHandler {
+	return &ReplayHandler{
+		linkRepository:     lr,
+		crawlJobRepository: cjr,
+		snapshots:          snapshots,
+	}
+}
+
+func (h *ReplayHandler) registerReplayHandler(r *mux.Router) {
+	r.HandleFunc("/replay/{jobId:[0-9]+}", h.replayCrawlJob).Methods("GET")
+	r.HandleFunc("/replay/{jobId:[0-9]+}/", h.replayCrawlJob).Methods("GET")
+	r.HandleFunc("/replay/{jobId:[0-9]+}/{url:.+}", h.replayUrl).Methods("GET")
+}
+
+// replayPrefix returns the path the replay urls of a crawl job start with.
+func replayPrefix(jobId int) string {
+	return fmt.Sprintf("/replay/%d/", jobId)
+}
+
+// replayCrawlJob redirects to the replay of the base url of a crawl job.
+func (h *ReplayHandler) replayCrawlJob(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["jobId"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	// http.Redirect would clean the double slashes of the path
+	rw.Header().Set("Location", replayPrefix(jobId)+job.BaseUrl)
+	rw.WriteHeader(http.StatusFound)
+}
+
+// replayUrl serves the stored response of the url after the prefix of the
+// crawl job, with its query, as it was received. The links of html pages and
+// style sheets are rewritten to their replay urls.
+func (h *ReplayHandler) replayUrl(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["jobId"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the url is taken from the escaped path, as the path variable is
+	// unescaped
+	prefix := replayPrefix(jobId)
+	rawUrl := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	if r.URL.RawQuery != "" {
+		rawUrl += "?" + r.URL.RawQuery
+	}
+
+	pageUrl, err := crawler.NormalizeUrl(rawUrl)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := h.linkRepository.GetSnapshotForUrl(jobId, pageUrl)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if snapshot.LinkId == 0 {
+		http.Error(rw, "the url wasn't crawled", http.StatusNotFound)
+		return
+	}
+
+	if snapshot.Header == nil {
+		http.Error(rw, "the page wasn't snapshotted", http.StatusNotFound)
+		return
+	}
+
+	body, ok := snapshotBody(rw, h.snapshots, snapshot)
+
+	if !ok {
+		return
+	}
+
+	base, err := url.Parse(snapshot.Url)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := http.Header(snapshot.Header)
+	rewriter := replay.Rewriter{Prefix: prefix}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		body = rewriter.HTML(body, base)
+	case "text/css":
+		body = rewriter.CSS(body, base)
+	}
+
+	rw.Header().Set("Content-Security-Policy", replayPolicy)
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			rw.Header().Set(name, value)
+		}
+	}
+
+	if location := header.Get("Location"); location != "" {
+		rw.Header().Set("Location", rewriter.URL(base, location))
+	}
+
+	statusCode := snapshot.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	rw.WriteHeader(statusCode)
+	rw.Write(body)
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/alicansa/go-linkcrawler/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type ReplayTest struct {
+	linksRepo     *mocks.MockLinkRepository
+	crawlJobsRepo *mocks.MockCrawlJobRepository
+	server        *httptest.Server
+	client        *http.Client
+	controller    *gomock.Controller
+	snapshots     blobstore.BlobStore
+}
+
+func TestReplay(t *testing.T) {
+	// setup + teardown
+	rt := &ReplayTest{}
+	tds := rt.setupSuite(t)
+	defer tds(t)
+
+	t.Run("Test replay of crawl job redirects to its base url", rt.testReplayOfCrawlJobRedirectsToBaseUrl)
+	t.Run("Test replay of crawl job returns not found if job doesn't exist", rt.testReplayOfCrawlJobReturnsNotFoundIfJobDoesntExist)
+	t.Run("Test replay returns not found if url wasn't crawled", rt.testReplayReturnsNotFoundIfUrlWasntCrawled)
+	t.Run("Test replay returns not found if page wasn't snapshotted", rt.testReplayReturnsNotFoundIfNotSnapshotted)
+	t.Run("Test successful replay of html page rewrites its links", rt.testSuccessfulReplayOfHtmlPage)
+	t.Run("Test successful replay of redirect", rt.testSuccessfulReplayOfRedirect)
+}
+
+func (rt *ReplayTest) setupSuite(t *testing.T) func(t *testing.T) {
+	rt.controller = gomock.NewController(t)
+	rt.linksRepo = mocks.NewMockLinkRepository(rt.controller)
+	rt.crawlJobsRepo = mocks.NewMockCrawlJobRepository(rt.controller)
+	snapshots, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.snapshots = snapshots
+
+	// the replay routes are served by the server, which mustn't clean the
+	// urls in their paths
+	stores := map[string]blobstore.BlobStore{"local": snapshots}
+	s := NewServer(
+		NewLinksHandler(rt.linksRepo, stores),
+		NewCrawlJobHandler(rt.crawlJobsRepo, rt.linksRepo, nil, nil, nil, stores, ""),
+		NewReplayHandler(rt.linksRepo, rt.crawlJobsRepo, stores))
+	rt.server = httptest.NewServer(s.server.Handler)
+
+	// redirects are checked rather than followed
+	rt.client = &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	return func(t *testing.T) {
+		rt.server.Close()
+	}
+}
+
+func (rt *ReplayTest) testReplayOfCrawlJobRedirectsToBaseUrl(t *testing.T) {
+
+	rt.crawlJobsRepo.EXPECT().GetCrawlJob(1).
+		Return(dal.CrawlJob{JobId: 1, BaseUrl: "https://test.com/", Status: dal.Completed}, nil).
+		Times(1)
+
+	resp, err := rt.client.Get(rt.server.URL + "/replay/1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/replay/1/https://test.com/", resp.Header.Get("Location"))
+}
+
+func (rt *ReplayTest) testReplayOfCrawlJobReturnsNotFoundIfJobDoesntExist(t *testing.T) {
+
+	rt.crawlJobsRepo.EXPECT().GetCrawlJob(2).Return(dal.CrawlJob{}, nil).Times(1)
+
+	resp, err := rt.client.Get(rt.server.URL + "/replay/2/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (rt *ReplayTest) testReplayReturnsNotFoundIfUrlWasntCrawled(t *testing.T) {
+
+	rt.linksRepo.EXPECT().GetSnapshotForUrl(1, "https://test.com/missing").Return(dal.Snapshot{}, nil).Times(1)
+
+	resp, err := rt.client.Get(rt.server.URL + "/replay/1/https://test.com/missing#section")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (rt *ReplayTest) testReplayReturnsNotFoundIfNotSnapshotted(t *testing.T) {
+
+	rt.linksRepo.EXPECT().GetSnapshotForUrl(1, "https://test.com/").
+		Return(dal.Snapshot{LinkId: 1, CrawlJobId: 1, Url: "https://test.com/", StatusCode: 200}, nil).
+		Times(1)
+
+	resp, err := rt.client.Get(rt.server.URL + "/replay/1/https://test.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func (rt *ReplayTest) testSuccessfulReplayOfHtmlPage(t *testing.T) {
+
+	key, err := rt.snapshots.Put([]byte(`<html><a href="/about">About</a><img src="logo.png"></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt.linksRepo.EXPECT().GetSnapshotForUrl(1, "https://test.com/blog/?q=a%20b").
+		Return(dal.Snapshot{
+			LinkId:     3,
+			CrawlJobId: 1,
+			Url:        "https://test.com/blog/?q=a%20b",
+			StatusCode: 200,
+			Store:      "local",
+			Key:        key,
+			Header: map[string][]string{
+				"Content-Type":     {"text/html; charset=utf-8"},
+				"Content-Encoding": {"gzip"},
+				"Set-Cookie":       {"session=1"},
+			},
+		}, nil).
+		Times(1)
+
+	resp, err := rt.client.Get(rt.server.URL + "/replay/1/https://test.com/blog/?q=a%20b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", resp.Header.Get("Set-Cookie"))
+	assert.Equal(t, "sandbox", resp.Header.Get("Content-Security-Policy"))
+	assert.Equal(t,
+		`<html><a href="/replay/1/https://test.com/about">About</a><img src="/replay/1/https://test.com/blog/logo.png"></html>`,
+		string(body))
+}
+
+func (rt *ReplayTest) testSuccessfulReplayOfRedirect(t *testing.T) {
+
+	rt.linksRepo.EXPECT().GetSnapshotForUrl(1, "https://test.com/old").
+		Return(dal.Snapshot{
+			LinkId:     4,
+			CrawlJobId: 1,
+			Url:        "https://test.com/old",
+			StatusCode: http.StatusMovedPermanently,
+			Store:      "local",
+			Header:     map[string][]string{"Location": {"/new"}},
+		}, nil).
+		Times(1)
+
+	resp, err := rt.client.Get(rt.server.URL + "/replay/1/https://test.com/old")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/replay/1/https://test.com/new", resp.Header.Get("Location"))
+}
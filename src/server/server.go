@@ -27,7 +27,8 @@ const ShutdownTimeout = 600 * time.Second
 
 func NewServer(
 	lr *LinksHandler,
-	cjh *CrawlJobsHandler) *Server {
+	cjh *CrawlJobsHandler,
+	rh *ReplayHandler) *Server {
 	// configure server and return a pointer to it
 	s := &Server{
 		server: &http.Server{},
@@ -44,6 +45,16 @@ func NewServer(
 		lr.registerLinksHandler(r)
 		cjh.registerCrawlJobsHandler(r)
 	}
+	{
+		// url lists are uploaded as csv, text or forms
+		r := router.PathPrefix("/").Subrouter()
+		cjh.registerCrawlJobsUploadHandler(r)
+	}
+
+	// replay urls end in the urls they replay, whose double slashes must
+	// not be cleaned
+	s.router.SkipClean(true)
+	rh.registerReplayHandler(s.router)
 
 	return s
 }
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicansa/go-linkcrawler/blobstore"
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/alicansa/go-linkcrawler/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type ServerTest struct {
+	linksRepo     *mocks.MockLinkRepository
+	crawlJobsRepo *mocks.MockCrawlJobRepository
+	webCrawler    *mocks.MockWebCrawler
+	server        *httptest.Server
+	controller    *gomock.Controller
+}
+
+func TestServer(t *testing.T) {
+	// setup + teardown
+	st := &ServerTest{}
+	tds := st.setupSuite(t)
+	defer tds(t)
+
+	t.Run("Test api requires json requests", st.testApiRequiresJsonRequests)
+	t.Run("Test successful upload of csv url list", st.testSuccessfulUploadOfCsvUrlList)
+}
+
+func (st *ServerTest) setupSuite(t *testing.T) func(t *testing.T) {
+	st.controller = gomock.NewController(t)
+	st.linksRepo = mocks.NewMockLinkRepository(st.controller)
+	st.crawlJobsRepo = mocks.NewMockCrawlJobRepository(st.controller)
+	st.webCrawler = mocks.NewMockWebCrawler(st.controller)
+
+	guard, err := crawler.NewAddressGuard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]blobstore.BlobStore{}
+	s := NewServer(
+		NewLinksHandler(st.linksRepo, stores),
+		NewCrawlJobHandler(
+			st.crawlJobsRepo,
+			st.linksRepo,
+			func(crawler.CrawlPolicyExecuter, crawler.CrawlOptions) crawler.WebCrawler { return st.webCrawler },
+			nil,
+			guard,
+			stores,
+			""),
+		NewReplayHandler(st.linksRepo, st.crawlJobsRepo, stores))
+	st.server = httptest.NewServer(s.server.Handler)
+
+	return func(t *testing.T) {
+		st.server.Close()
+	}
+}
+
+func (st *ServerTest) testApiRequiresJsonRequests(t *testing.T) {
+
+	resp, err := http.Post(st.server.URL+"/api/crawlJobs", "text/csv", strings.NewReader("https://test.com/"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func (st *ServerTest) testSuccessfulUploadOfCsvUrlList(t *testing.T) {
+
+	done := make(chan struct{})
+	st.crawlJobsRepo.EXPECT().AddCrawlJob("https://test.com/").Return(1, nil).Times(1)
+	st.crawlJobsRepo.EXPECT().UpdateCrawlJobStatus(1, dal.Completed).
+		Do(func(int, dal.CrawlJobStatus) { close(done) }).
+		Return(nil).Times(1)
+	st.webCrawler.EXPECT().Crawl([]string{"https://test.com/", "https://test.com/about"}, gomock.Any(), gomock.Any()).
+		Return(nil, nil).Times(1)
+
+	resp, err := http.Post(
+		st.server.URL+"/api/crawlJobs/list",
+		"text/csv",
+		strings.NewReader("https://test.com/\nhttps://test.com/about\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the crawl is only started once the upload was accepted
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	<-done
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alicansa/go-linkcrawler/crawler"
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/alicansa/go-linkcrawler/sitemap"
+	"github.com/gorilla/mux"
+)
+
+// htmlContentTypes are the content types of pages listed in sitemaps.
+var htmlContentTypes = map[string]struct{}{
+	"text/html":             {},
+	"application/xhtml+xml": {},
+}
+
+// getCrawlJobSitemap serves the sitemap of the indexable pages of a crawl
+// job, or a sitemap index of its parts if they don't fit in one sitemap.
+func (h *CrawlJobsHandler) getCrawlJobSitemap(rw http.ResponseWriter, r *http.Request) {
+
+	parts, ok := h.crawlJobSitemaps(rw, r)
+
+	if !ok {
+		return
+	}
+
+	rw.Header().Set("Content-type", "application/xml")
+
+	if len(parts) == 1 {
+		sitemap.WriteUrlset(rw, parts[0])
+		return
+	}
+
+	// the parts are served next to the index, which links them relatively
+	// as the public url of the server isn't known
+	index := make([]sitemap.Url, 0, len(parts))
+	for i := range parts {
+		index = append(index, sitemap.Url{Loc: fmt.Sprintf("sitemap-%d.xml", i+1)})
+	}
+
+	sitemap.WriteIndex(rw, index)
+}
+
+// getCrawlJobSitemapPart serves a part of a sitemap split into an index.
+func (h *CrawlJobsHandler) getCrawlJobSitemapPart(rw http.ResponseWriter, r *http.Request) {
+
+	part, err := strconv.Atoi(mux.Vars(r)["part"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parts, ok := h.crawlJobSitemaps(rw, r)
+
+	if !ok {
+		return
+	}
+
+	if part < 1 || part > len(parts) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-type", "application/xml")
+	sitemap.WriteUrlset(rw, parts[part-1])
+}
+
+// crawlJobSitemaps returns the sitemaps of the crawl job of the request,
+// writing the error response and returning false if there is none.
+func (h *CrawlJobsHandler) crawlJobSitemaps(rw http.ResponseWriter, r *http.Request) ([][]sitemap.Url, bool) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return nil, false
+	}
+
+	// the pages of a crawl in progress aren't all known yet
+	if job.Status == dal.InProgress {
+		http.Error(rw, "crawl job is in progress", http.StatusConflict)
+		return nil, false
+	}
+
+	links, err := h.linkRepository.GetLinks(jobId, dal.LinkFilter{
+		Kind:   string(crawler.NavigationLink),
+		SortBy: dal.SortByUrl,
+	})
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return sitemap.Split(sitemapUrls(links)), true
+}
+
+// sitemapUrls returns the indexable pages among the links: html pages that
+// responded ok, aren't noindex and are their own canonical.
+func sitemapUrls(links []dal.Link) []sitemap.Url {
+	var urls []sitemap.Url
+	for _, link := range links {
+		if link.StatusCode != http.StatusOK || link.NoIndex {
+			continue
+		}
+
+		if _, ok := htmlContentTypes[link.ContentType]; !ok {
+			continue
+		}
+
+		if link.Canonical != "" && link.Canonical != link.Url {
+			continue
+		}
+
+		urls = append(urls, sitemap.Url{Loc: link.Url, LastMod: link.LastModified})
+	}
+	return urls
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxUrlListSize is the maximum size in bytes of an uploaded url list.
+const maxUrlListSize = 32 << 20
+
+// addListCrawlJob adds a list mode job for the urls of an uploaded csv, sent
+// as the body of a text/csv request or as the "urls" file of a multipart
+// form. The options of the job can be sent as json in the "job" field of the
+// form.
+func (h *CrawlJobsHandler) addListCrawlJob(rw http.ResponseWriter, r *http.Request) {
+
+	r.Body = http.MaxBytesReader(rw, r.Body, maxUrlListSize)
+
+	var job CrawlJobRequest
+	var urls []string
+	var err error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv", "text/plain":
+		urls, err = readUrlList(r.Body)
+	case "multipart/form-data":
+		job, urls, err = readUrlListForm(r)
+	default:
+		http.Error(rw, "url lists must be uploaded as text/csv or multipart/form-data", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if job.Mode != SpiderMode && job.Mode != ListMode {
+		http.Error(rw, fmt.Sprintf("unsupported mode %q", job.Mode), http.StatusBadRequest)
+		return
+	}
+
+	job.Mode = ListMode
+	job.Urls = append(job.Urls, urls...)
+	h.startCrawlJob(rw, r, job)
+}
+
+// readUrlListForm returns the job options and the urls of a multipart form.
+func readUrlListForm(r *http.Request) (CrawlJobRequest, []string, error) {
+	var job CrawlJobRequest
+
+	if err := r.ParseMultipartForm(maxUrlListSize); err != nil {
+		return job, nil, fmt.Errorf("invalid form: %w", err)
+	}
+
+	if options := r.FormValue("job"); options != "" {
+		if err := json.Unmarshal([]byte(options), &job); err != nil {
+			return job, nil, errors.New("Invalid json job")
+		}
+	}
+
+	file, _, err := r.FormFile("urls")
+	if err != nil {
+		return job, nil, errors.New("the form has no urls file")
+	}
+	defer file.Close()
+
+	urls, err := readUrlList(file)
+	return job, urls, err
+}
+
+// readUrlList returns the urls of a csv, read from its "url" column if its
+// header names one, or from its first column. A first row that isn't a url
+// is taken as a header and blank cells are skipped.
+func readUrlList(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var urls []string
+	column := 0
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+
+		if row == 0 && !isAbsoluteUrl(strings.TrimSpace(record[0])) {
+			for i, field := range record {
+				if strings.EqualFold(strings.TrimSpace(field), "url") {
+					column = i
+				}
+			}
+			continue
+		}
+
+		if column >= len(record) {
+			continue
+		}
+
+		if u := strings.TrimSpace(record[column]); u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls, nil
+}
+
+func isAbsoluteUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/alicansa/go-linkcrawler/dal"
+	"github.com/alicansa/go-linkcrawler/warc"
+	"github.com/gorilla/mux"
+)
+
+// warcPrefix returns the prefix of the names of the WARC files of a crawl job.
+func warcPrefix(jobId int) string {
+	return fmt.Sprintf("job-%d", jobId)
+}
+
+// getCrawlJobWarc serves the WARC files of a completed crawl job as one
+// file, which gzipped WARC files concatenate to.
+func (h *CrawlJobsHandler) getCrawlJobWarc(rw http.ResponseWriter, r *http.Request) {
+
+	jobId, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.crawlJobRepository.GetCrawlJob(jobId)
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == (dal.CrawlJob{}) {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	// the last file is still being written to
+	if job.Status == dal.InProgress {
+		http.Error(rw, "crawl job is in progress", http.StatusConflict)
+		return
+	}
+
+	if h.warcDir == "" {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	files, err := warc.Files(h.warcDir, warcPrefix(jobId))
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(files) == 0 {
+		http.Error(rw, "", http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-type", "application/warc")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="crawl-%d.warc.gz"`, jobId))
+
+	for _, file := range files {
+		if err := copyFile(rw, file); err != nil {
+			// the response has started, so it can only be cut short
+			log.Println(err.Error())
+			return
+		}
+	}
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,97 @@
+// Package sitemap writes sitemaps following the sitemaps.org protocol.
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+const (
+	Namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	// MaxUrls is the maximum number of urls of a sitemap or an index.
+	MaxUrls = 50000
+	// MaxSize is the maximum uncompressed size of a sitemap in bytes.
+	MaxSize = 50 * 1024 * 1024
+)
+
+const (
+	urlsetHeader = xml.Header + `<urlset xmlns="` + Namespace + `">` + "\n"
+	urlsetFooter = "</urlset>\n"
+	indexHeader  = xml.Header + `<sitemapindex xmlns="` + Namespace + `">` + "\n"
+	indexFooter  = "</sitemapindex>\n"
+)
+
+// Url is an entry of a sitemap or of a sitemap index. LastMod is a W3C
+// datetime and is omitted if empty.
+type Url struct {
+	Loc     string
+	LastMod string
+}
+
+// Split splits the urls into as few sitemaps as possible, each of them
+// within MaxUrls and MaxSize. It returns a single empty sitemap if there are
+// no urls.
+func Split(urls []Url) [][]Url {
+	return split(urls, MaxUrls, MaxSize)
+}
+
+func split(urls []Url, maxUrls int, maxSize int) [][]Url {
+	sitemaps := [][]Url{{}}
+	size := len(urlsetHeader) + len(urlsetFooter)
+
+	for _, u := range urls {
+		entrySize := len(entry("url", u))
+		current := sitemaps[len(sitemaps)-1]
+
+		if len(current) > 0 && (len(current) >= maxUrls || size+entrySize > maxSize) {
+			sitemaps = append(sitemaps, nil)
+			size = len(urlsetHeader) + len(urlsetFooter)
+		}
+
+		sitemaps[len(sitemaps)-1] = append(sitemaps[len(sitemaps)-1], u)
+		size += entrySize
+	}
+
+	return sitemaps
+}
+
+// WriteUrlset writes a sitemap listing the urls.
+func WriteUrlset(w io.Writer, urls []Url) error {
+	return write(w, urlsetHeader, "url", urls, urlsetFooter)
+}
+
+// WriteIndex writes a sitemap index listing the sitemaps.
+func WriteIndex(w io.Writer, sitemaps []Url) error {
+	return write(w, indexHeader, "sitemap", sitemaps, indexFooter)
+}
+
+func write(w io.Writer, header string, element string, urls []Url, footer string) error {
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	for _, u := range urls {
+		if _, err := w.Write(entry(element, u)); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, footer)
+	return err
+}
+
+// entry returns the xml of a single url or sitemap element.
+func entry(element string, u Url) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<" + element + "><loc>")
+	xml.EscapeText(&buf, []byte(u.Loc))
+	buf.WriteString("</loc>")
+	if u.LastMod != "" {
+		buf.WriteString("<lastmod>")
+		xml.EscapeText(&buf, []byte(u.LastMod))
+		buf.WriteString("</lastmod>")
+	}
+	buf.WriteString("</" + element + ">\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,60 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteUrlset(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteUrlset(&buf, []Url{
+		{Loc: "https://example.com/?a=1&b=2", LastMod: "2022-01-02T03:04:05Z"},
+		{Loc: "https://example.com/about"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, xml.Header+
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+"\n"+
+		"<url><loc>https://example.com/?a=1&amp;b=2</loc><lastmod>2022-01-02T03:04:05Z</lastmod></url>\n"+
+		"<url><loc>https://example.com/about</loc></url>\n"+
+		"</urlset>\n", buf.String())
+}
+
+func TestWriteIndex(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteIndex(&buf, []Url{{Loc: "https://example.com/sitemap-1.xml"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, xml.Header+
+		`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+"\n"+
+		"<sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>\n"+
+		"</sitemapindex>\n", buf.String())
+}
+
+func TestSplit(t *testing.T) {
+	urls := []Url{
+		{Loc: "https://example.com/a"},
+		{Loc: "https://example.com/b"},
+		{Loc: "https://example.com/c"},
+	}
+
+	t.Run("Test returns a single empty sitemap without urls", func(t *testing.T) {
+		assert.Equal(t, [][]Url{{}}, Split(nil))
+	})
+
+	t.Run("Test keeps urls within the limits in one sitemap", func(t *testing.T) {
+		assert.Equal(t, [][]Url{urls}, Split(urls))
+	})
+
+	t.Run("Test splits on number of urls", func(t *testing.T) {
+		assert.Equal(t, [][]Url{urls[:2], urls[2:]}, split(urls, 2, MaxSize))
+	})
+
+	t.Run("Test splits on size", func(t *testing.T) {
+		maxSize := len(urlsetHeader) + len(urlsetFooter) + 2*len(entry("url", urls[0]))
+		assert.Equal(t, [][]Url{urls[:2], urls[2:]}, split(urls, MaxUrls, maxSize))
+	})
+}
@@ -0,0 +1,276 @@
+// Package warc writes WARC 1.1 files, the format web archives store crawls
+// in.
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxFileSize is the size above which files are rotated unless
+// configured otherwise, the size recommended by the WARC specification.
+const DefaultMaxFileSize = 1024 * 1024 * 1024
+
+// RecordType is the type of a WARC record.
+type RecordType string
+
+const (
+	WarcInfo RecordType = "warcinfo"
+	Request  RecordType = "request"
+	Response RecordType = "response"
+	Resource RecordType = "resource"
+	Metadata RecordType = "metadata"
+)
+
+// Content types of the blocks of the records.
+const (
+	HTTPRequestContentType  = "application/http;msgtype=request"
+	HTTPResponseContentType = "application/http;msgtype=response"
+	WarcFieldsContentType   = "application/warc-fields"
+)
+
+// Record is a WARC record, whose block is its content.
+type Record struct {
+	Type RecordType
+	// Id is generated if not set.
+	Id        string
+	TargetURI string
+	// Date is the time the record was captured at, now if not set.
+	Date        time.Time
+	ContentType string
+	// ConcurrentTo is the id of the record captured along with this one,
+	// such as the response of a request.
+	ConcurrentTo string
+	// Truncated is the reason the block was truncated, such as "length",
+	// if it was.
+	Truncated string
+	Content   []byte
+}
+
+// NewRecordId returns a new record id, a random uuid urn.
+func NewRecordId() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	// version 4, variant 10
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Writer writes records to gzipped WARC files in a directory, each record
+// compressed as a gzip member of its own. Files are named after a prefix
+// and a sequence number, and a file is rotated once writing a record would
+// take it above the maximum file size.
+type Writer struct {
+	mx          sync.Mutex
+	dir         string
+	prefix      string
+	maxFileSize int64
+
+	file     *os.File
+	fileSize int64
+	// records is the number of records written to the file but for its
+	// warcinfo record
+	records  int
+	sequence int
+}
+
+// CheckDir creates the directory files are written to if it doesn't exist,
+// and checks that files can be created in it.
+func CheckDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// NewWriter returns a writer of files in the directory, which is created if
+// it doesn't exist. The maximum file size is DefaultMaxFileSize if not
+// positive.
+func NewWriter(dir string, prefix string, maxFileSize int64) (*Writer, error) {
+	if err := CheckDir(dir); err != nil {
+		return nil, err
+	}
+
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+
+	return &Writer{dir: dir, prefix: prefix, maxFileSize: maxFileSize}, nil
+}
+
+// Write writes the records to the same file, in order, and returns their
+// ids.
+func (w *Writer) Write(records ...Record) ([]string, error) {
+	ids := make([]string, 0, len(records))
+
+	var members bytes.Buffer
+	for _, record := range records {
+		if record.Id == "" {
+			record.Id = NewRecordId()
+		}
+		ids = append(ids, record.Id)
+
+		if err := writeMember(&members, record, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	// records larger than the maximum file size are written to a file of
+	// their own
+	if w.file == nil || (w.records > 0 && w.fileSize+int64(members.Len()) > w.maxFileSize) {
+		if err := w.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := w.file.Write(members.Bytes())
+	w.fileSize += int64(n)
+	w.records += len(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// rotate closes the current file and opens the next one, starting with a
+// warcinfo record.
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+
+	name := fmt.Sprintf("%s-%05d.warc.gz", w.prefix, w.sequence)
+	file, err := os.Create(filepath.Join(w.dir, name))
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.fileSize = 0
+	w.records = 0
+	w.sequence++
+
+	info := Record{
+		Type:        WarcInfo,
+		Id:          NewRecordId(),
+		ContentType: WarcFieldsContentType,
+		Content:     []byte("software: go-linkcrawler\r\nformat: WARC File Format 1.1\r\n"),
+	}
+
+	var member bytes.Buffer
+	if err := writeMember(&member, info, [][2]string{{"WARC-Filename", name}}); err != nil {
+		return err
+	}
+
+	n, err := w.file.Write(member.Bytes())
+	w.fileSize += int64(n)
+	return err
+}
+
+// Close closes the current file.
+func (w *Writer) Close() error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Files returns the paths of the WARC files written in the directory with
+// the prefix, in the order they were written.
+func Files(dir string, prefix string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"-*.warc.gz"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writeMember writes the record as a gzip member.
+func writeMember(b *bytes.Buffer, record Record, extraHeaders [][2]string) error {
+	date := record.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	headers := [][2]string{
+		{"WARC-Type", string(record.Type)},
+		{"WARC-Record-ID", record.Id},
+		{"WARC-Date", date.UTC().Format("2006-01-02T15:04:05.000000Z")},
+	}
+
+	if record.TargetURI != "" {
+		headers = append(headers, [2]string{"WARC-Target-URI", record.TargetURI})
+	}
+
+	if record.ConcurrentTo != "" {
+		headers = append(headers, [2]string{"WARC-Concurrent-To", record.ConcurrentTo})
+	}
+
+	if record.Truncated != "" {
+		headers = append(headers, [2]string{"WARC-Truncated", record.Truncated})
+	}
+
+	headers = append(headers, extraHeaders...)
+	headers = append(headers, [2]string{"WARC-Block-Digest", digest(record.Content)})
+
+	// the payload of http responses is their body
+	if record.Type == Response && record.ContentType == HTTPResponseContentType {
+		if i := bytes.Index(record.Content, []byte("\r\n\r\n")); i >= 0 {
+			headers = append(headers, [2]string{"WARC-Payload-Digest", digest(record.Content[i+4:])})
+		}
+	}
+
+	if record.ContentType != "" {
+		headers = append(headers, [2]string{"Content-Type", record.ContentType})
+	}
+
+	headers = append(headers, [2]string{"Content-Length", strconv.Itoa(len(record.Content))})
+
+	zw := gzip.NewWriter(b)
+	zw.Write([]byte("WARC/1.1\r\n"))
+	for _, header := range headers {
+		zw.Write([]byte(header[0] + ": " + header[1] + "\r\n"))
+	}
+	zw.Write([]byte("\r\n"))
+	zw.Write(record.Content)
+	zw.Write([]byte("\r\n\r\n"))
+
+	return zw.Close()
+}
+
+// digest returns the labelled base32 SHA-1 digest of the content, as
+// archives conventionally digest blocks.
+func digest(content []byte) string {
+	sum := sha1.Sum(content)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,193 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type readRecord struct {
+	header  textproto.MIMEHeader
+	content string
+}
+
+// readRecords reads the records of a WARC file, checking each is a gzip
+// member of its own.
+func readRecords(t *testing.T, path string) []readRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []readRecord
+	for {
+		zr.Multistream(false)
+		member, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tr := textproto.NewReader(bufio.NewReader(strings.NewReader(string(member))))
+		version, _ := tr.ReadLine()
+		assert.Equal(t, "WARC/1.1", version)
+
+		header, err := tr.ReadMIMEHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		rest, _ := io.ReadAll(tr.R)
+		assert.Equal(t, "\r\n\r\n", string(rest[length:]))
+		records = append(records, readRecord{header: header, content: string(rest[:length])})
+
+		if err := zr.Reset(br); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return records
+}
+
+func TestWriter(t *testing.T) {
+
+	t.Run("Test writes records after a warcinfo record", func(t *testing.T) {
+		dir := t.TempDir()
+		w, err := NewWriter(dir, "crawl", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html></html>"
+		ids, err := w.Write(
+			Record{Type: Request, TargetURI: "https://test/", ContentType: HTTPRequestContentType,
+				ConcurrentTo: "<urn:uuid:response>", Content: []byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")},
+			Record{Type: Response, Id: "<urn:uuid:response>", TargetURI: "https://test/",
+				ContentType: HTTPResponseContentType, Content: []byte(response)})
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+
+		assert.Len(t, ids, 2)
+		assert.Regexp(t, `^<urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}>$`, ids[0])
+		assert.Equal(t, "<urn:uuid:response>", ids[1])
+
+		files, err := Files(dir, "crawl")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "crawl-00000.warc.gz")}, files)
+
+		records := readRecords(t, files[0])
+		assert.Len(t, records, 3)
+		assert.Equal(t, "warcinfo", records[0].header.Get("WARC-Type"))
+		assert.Equal(t, "crawl-00000.warc.gz", records[0].header.Get("WARC-Filename"))
+
+		assert.Equal(t, "request", records[1].header.Get("WARC-Type"))
+		assert.Equal(t, ids[0], records[1].header.Get("WARC-Record-ID"))
+		assert.Equal(t, "<urn:uuid:response>", records[1].header.Get("WARC-Concurrent-To"))
+		assert.Equal(t, "https://test/", records[1].header.Get("WARC-Target-URI"))
+
+		assert.Equal(t, "response", records[2].header.Get("WARC-Type"))
+		assert.Equal(t, response, records[2].content)
+		assert.Equal(t, digest([]byte(response)), records[2].header.Get("WARC-Block-Digest"))
+		assert.Equal(t, digest([]byte("<html></html>")), records[2].header.Get("WARC-Payload-Digest"))
+		assert.Regexp(t, `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}Z$`, records[2].header.Get("WARC-Date"))
+	})
+
+	t.Run("Test rotates files by size", func(t *testing.T) {
+		dir := t.TempDir()
+		w, err := NewWriter(dir, "crawl", 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// random content doesn't compress, so that two records fit in a
+		// file but not three
+		for i := 0; i < 3; i++ {
+			content := make([]byte, 1400)
+			rand.Read(content)
+			_, err := w.Write(Record{Type: Resource, Content: content})
+			assert.Nil(t, err)
+		}
+		_, err = w.Write(Record{Type: Metadata, ContentType: WarcFieldsContentType, Content: []byte("outlink: https://test/\r\n")})
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+
+		files, err := Files(dir, "crawl")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "crawl-00000.warc.gz"),
+			filepath.Join(dir, "crawl-00001.warc.gz"),
+		}, files)
+
+		for _, file := range files {
+			records := readRecords(t, file)
+			assert.Len(t, records, 3)
+			assert.Equal(t, "warcinfo", records[0].header.Get("WARC-Type"))
+
+			info, _ := os.Stat(file)
+			assert.LessOrEqual(t, info.Size(), int64(4096))
+		}
+	})
+
+	t.Run("Test writes records larger than the maximum file size", func(t *testing.T) {
+		dir := t.TempDir()
+		w, err := NewWriter(dir, "crawl", 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err = w.Write(Record{Type: Metadata, ContentType: WarcFieldsContentType, Content: []byte("outlink: https://test/\r\n")})
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, w.Close())
+
+		// each record is in a file of its own, after its warcinfo record
+		files, err := Files(dir, "crawl")
+		assert.Nil(t, err)
+		assert.Len(t, files, 2)
+		for _, file := range files {
+			assert.Len(t, readRecords(t, file), 2)
+		}
+	})
+}
+
+func TestCheckDir(t *testing.T) {
+	t.Run("Test creates directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "warc")
+
+		assert.Nil(t, CheckDir(dir))
+
+		entries, err := os.ReadDir(dir)
+		assert.Nil(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Test returns error if files can't be created", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.NotNil(t, CheckDir(filepath.Join(file, "warc")))
+
+		_, err := NewWriter(filepath.Join(file, "warc"), "crawl", 0)
+		assert.NotNil(t, err)
+	})
+}